@@ -13,10 +13,12 @@ import (
 	"github.com/redis/go-redis/v9"
 
 	"socksproxies.com/server/internal/api"
+	"socksproxies.com/server/internal/checker"
 	"socksproxies.com/server/internal/config"
 	"socksproxies.com/server/internal/geoip"
 	"socksproxies.com/server/internal/proxylist"
 	"socksproxies.com/server/internal/rate"
+	"socksproxies.com/server/internal/scheduler"
 	"socksproxies.com/server/internal/store"
 	"socksproxies.com/server/internal/ws"
 )
@@ -46,6 +48,13 @@ func main() {
 		defer geo.Close()
 	}
 
+	asnClasses, err := geoip.LoadASNClasses(cfg.ASNClassPath)
+	if err != nil {
+		log.Printf("asn classification disabled: %v", err)
+	} else if asnClasses != nil {
+		log.Printf("asn classification: %d networks", asnClasses.Len())
+	}
+
 	// Performance: Optimized Redis connection pool
 	redisClient := redis.NewClient(&redis.Options{
 		Addr:         cfg.RedisAddr,
@@ -87,6 +96,9 @@ func main() {
 
 	router.GET("/api/health", apiHandler.Health)
 	router.GET("/api/whoami", apiHandler.Whoami)
+	router.GET("/api/judge", apiHandler.Judge)
+	router.GET("/api/judge/payload", apiHandler.JudgePayload)
+	router.GET("/api/judge/fixture", apiHandler.JudgeFixture)
 	router.POST("/api/cache/warm", api.RequireAPIKey(cfg.APIKeys), apiHandler.WarmCacheEndpoint)
 	router.GET("/api/proxies", apiHandler.ListProxyListPublic)
 	router.GET("/api/proxies/stats", apiHandler.GetProxyStats)
@@ -96,6 +108,8 @@ func main() {
 	router.POST("/api/proxies/export/jobs", apiHandler.CreateExportJob)
 	router.GET("/api/proxies/export/jobs/:id", apiHandler.GetExportJob)
 	router.GET("/api/proxies/export/jobs/:id/download", apiHandler.DownloadExportJob)
+	router.GET("/api/proxies/:ip/:port", apiHandler.GetProxyDetail)
+	router.GET("/api/proxies/:ip/:port/history", apiHandler.GetProxyHistory)
 	router.GET("/api/v1/proxies", apiHandler.ListProxyListAuth)
 	router.GET("/api/facets/countries", apiHandler.ListProxyFacetsCountries)
 	router.GET("/api/facets/ports", apiHandler.ListProxyFacetsPorts)
@@ -105,8 +119,63 @@ func main() {
 	router.GET("/api/facets/asns", apiHandler.ListProxyFacetsASNs)
 	router.GET("/api/asn/:asn", apiHandler.GetASNDetails)
 
-	wsHandler := ws.NewHandler(cfg, storage, geo, apiHandler.GetLimiter(), ws.WithAlert(obs.Alert))
+	syncCtx, cancelSync := context.WithCancel(context.Background())
+	defer cancelSync()
+
+	judges := checker.NewJudgePool(cfg.JudgeURLs,
+		checker.WithConsensus(cfg.JudgeConsensus),
+		checker.WithHealthInterval(cfg.JudgeHealthInterval),
+	)
+	go judges.Start(syncCtx)
+
+	var dnsProbe *checker.DNSProbe
+	if cfg.DNSProbeZone != "" {
+		probe, err := checker.NewDNSProbe(cfg.DNSProbeListen, cfg.DNSProbeZone, cfg.DNSProbeTarget)
+		if err != nil {
+			log.Printf("dns probe disabled: %v", err)
+		} else {
+			dnsProbe = probe
+			go dnsProbe.Serve(syncCtx)
+		}
+	}
+
+	// One worker pool serves every WebSocket session and REST check.
+	checkPool := scheduler.New(cfg.CheckWorkers, cfg.CheckClientQueue)
+	defer checkPool.Close()
+	checkJobs := ws.NewJobManager(cfg, redisClient)
+	defer checkJobs.Close()
+	// Proxies checked per caller per day, across every transport.
+	checkQuota := rate.NewLimiterWithConfig(counter, rate.LimiterConfig{
+		FreeLimit:      cfg.CheckDailyQuota.Free,
+		BasicLimit:     cfg.CheckDailyQuota.Basic,
+		ProLimit:       cfg.CheckDailyQuota.Pro,
+		WindowDuration: 24 * time.Hour,
+	})
+	// Proxy list changes, fanned out to /ws/feed subscribers on every instance.
+	proxyFeed := ws.NewFeed(cfg, redisClient)
+	defer proxyFeed.Close()
+
+	wsHandler := ws.NewHandler(cfg, storage, geo, apiHandler.GetLimiter(),
+		ws.WithAlert(obs.Alert),
+		ws.WithJudgePool(judges),
+		ws.WithDNSProbe(dnsProbe),
+		ws.WithASNClasses(asnClasses),
+		ws.WithScheduler(checkPool),
+		ws.WithJobManager(checkJobs),
+		ws.WithCheckQuota(checkQuota),
+		ws.WithFeed(proxyFeed),
+	)
 	router.GET("/ws", wsHandler.Handle)
+	router.GET("/ws/feed", wsHandler.ServeFeed)
+	router.POST("/api/check", wsHandler.Check)
+	router.POST("/api/checks", wsHandler.StartCheck)
+	router.GET("/api/checks/:id/events", wsHandler.CheckEvents)
+	checks := router.Group("/api/v1/checks", api.RequireAPIKey(cfg.APIKeys))
+	checks.POST("", wsHandler.CreateCheckJob)
+	checks.POST("/upload", wsHandler.UploadCheckJob)
+	checks.GET("/:id", wsHandler.GetCheckJob)
+	checks.GET("/:id/download", wsHandler.DownloadCheckJob)
+	checks.GET("/:id/export/:format", wsHandler.ExportCheckJob)
 
 	if cfg.ProxyListPath != "" {
 		go func() {
@@ -119,9 +188,6 @@ func main() {
 		}()
 	}
 
-	syncCtx, cancelSync := context.WithCancel(context.Background())
-	defer cancelSync()
-
 	if cfg.ProxySourceURL != "" {
 		syncer := proxylist.NewSyncer(proxylist.SyncConfig{
 			SourceURL:      cfg.ProxySourceURL,
@@ -131,6 +197,7 @@ func main() {
 			Retention:      time.Duration(cfg.ProxyRetentionHours) * time.Hour,
 			RequestTimeout: 30 * time.Second,
 			AfterSync:      apiHandler.WarmProxyCaches,
+			OnChange:       proxyFeed.Publish,
 		}, storage, redisClient, geo)
 		go syncer.Start(syncCtx)
 	}
@@ -58,7 +58,7 @@ func (h *Handler) WarmProxyCaches(ctx context.Context) {
 	if records, err := h.proxyStore.ListRecentProxies(warmCtx, warmRecentLimit); err == nil {
 		data := make([]ProxyListItem, 0, len(records))
 		for _, record := range records {
-			data = append(data, transformProxyRecord(record))
+			data = append(data, NewProxyListItem(record))
 		}
 		meta := gin.H{
 			"cached":    true,
@@ -91,7 +91,7 @@ func (h *Handler) WarmProxyCaches(ctx context.Context) {
 		if records, total, err := h.proxyStore.ListProxyList(warmCtx, mainFilters); err == nil {
 			data := make([]ProxyListItem, 0, len(records))
 			for _, record := range records {
-				data = append(data, transformProxyRecord(record))
+				data = append(data, NewProxyListItem(record))
 			}
 			meta := ProxyListMeta{
 				Total:    total,
@@ -142,7 +142,7 @@ func (h *Handler) WarmProxyCaches(ctx context.Context) {
 		}
 		data := make([]ProxyListItem, 0, len(records))
 		for _, record := range records {
-			data = append(data, transformProxyRecord(record))
+			data = append(data, NewProxyListItem(record))
 		}
 		meta := ProxyListMeta{
 			Total:    total,
@@ -1,6 +1,9 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -53,3 +56,111 @@ func TestWhoamiEndpoint(t *testing.T) {
 		t.Fatalf("expected status 200 got %d", rec.Code)
 	}
 }
+
+func TestJudgeEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Load()
+	store, err := store.Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("store open: %v", err)
+	}
+
+	h := NewHandler(cfg, store, nil)
+	router := NewRouter(cfg)
+	router.GET("/api/judge", h.Judge)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/judge", nil)
+	req.RemoteAddr = "203.0.113.7:4321"
+	req.Header.Set("Via", "1.1 squid")
+	req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7")
+	req.Header.Set("Forwarded", `for="203.0.113.7:4321";proto=http`)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d", rec.Code)
+	}
+
+	var resp JudgeResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.IP != "203.0.113.7" {
+		t.Errorf("expected ip 203.0.113.7, got %q", resp.IP)
+	}
+	if resp.Headers["Via"] != "1.1 squid" {
+		t.Errorf("expected Via to be echoed, got %q", resp.Headers["Via"])
+	}
+	if resp.Headers["X-Forwarded-For"] != "198.51.100.1" {
+		t.Errorf("expected client address stripped from X-Forwarded-For, got %q", resp.Headers["X-Forwarded-For"])
+	}
+	if _, ok := resp.Headers["Forwarded"]; ok {
+		t.Errorf("expected Forwarded naming only the client to be dropped")
+	}
+	if _, ok := resp.Headers["X-Forwarded-Proto"]; ok {
+		t.Errorf("expected X-Forwarded-Proto not to be echoed")
+	}
+}
+
+func TestJudgePayloadEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Load()
+	store, err := store.Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("store open: %v", err)
+	}
+
+	h := NewHandler(cfg, store, nil)
+	router := NewRouter(cfg)
+	router.GET("/api/judge/payload", h.JudgePayload)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/judge/payload?size=100000", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d", rec.Code)
+	}
+	if rec.Body.Len() != 100000 {
+		t.Errorf("expected 100000 bytes, got %d", rec.Body.Len())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/judge/payload?size=-1", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for invalid size, got %d", rec.Code)
+	}
+}
+
+func TestJudgeFixtureEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Load()
+	h := NewHandler(cfg, nil, nil)
+	router := NewRouter(cfg)
+	router.GET("/api/judge/fixture", h.JudgeFixture)
+
+	fetch := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/judge/fixture", nil))
+		return rec
+	}
+
+	first, second := fetch(), fetch()
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected status 200 got %d", first.Code)
+	}
+	if first.Body.String() != second.Body.String() {
+		t.Error("expected the fixture to be identical on every request")
+	}
+	sum := sha256.Sum256(first.Body.Bytes())
+	if got := first.Header().Get("X-Fixture-Checksum"); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("checksum header %q does not match the body", got)
+	}
+	for _, name := range []string{"X-Frame-Options", "X-Content-Type-Options", "Content-Security-Policy"} {
+		if first.Header().Get(name) == "" {
+			t.Errorf("expected %s to be set", name)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// judgeHeaders are the request headers proxies commonly add and that reveal
+// either the presence of a proxy or the address of the original client.
+var judgeHeaders = []string{
+	"Forwarded",
+	"Forwarded-For",
+	"X-Forwarded-For",
+	"X-Forwarded",
+	"X-Forwarded-Host",
+	"X-Forwarded-Server",
+	"X-Real-IP",
+	"X-Client-IP",
+	"Client-IP",
+	"True-Client-IP",
+	"X-Cluster-Client-IP",
+	"X-Originating-IP",
+	"X-Remote-IP",
+	"X-Remote-Addr",
+	"X-ProxyUser-IP",
+	"X-Proxy-ID",
+	"X-Bluecoat-Via",
+	"Via",
+	"Proxy-Connection",
+	"Proxy-Agent",
+}
+
+const (
+	defaultPayloadBytes = 256 << 10
+	maxPayloadBytes     = 10 << 20
+)
+
+// payloadChunk is random so proxies cannot shrink the transfer by compressing
+// it; it is written repeatedly to build payloads of any size.
+var payloadChunk = func() []byte {
+	buf := make([]byte, 32<<10)
+	_, _ = rand.Read(buf)
+	return buf
+}()
+
+// fixturePage is the page the checker's tamper test fetches through proxies
+// and compares byte for byte with a direct fetch. It must stay deterministic.
+const fixturePage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>socks5proxies.com tamper fixture</title>
+</head>
+<body>
+<h1>Tamper fixture</h1>
+<p>This page is used to detect proxies that modify content in transit.</p>
+</body>
+</html>
+`
+
+var fixtureChecksum = func() string {
+	sum := sha256.Sum256([]byte(fixturePage))
+	return hex.EncodeToString(sum[:])
+}()
+
+type JudgeResponse struct {
+	IP        string            `json:"ip"`
+	Headers   map[string]string `json:"headers"`
+	Timestamp string            `json:"timestamp"`
+}
+
+// Judge echoes the caller's address and any proxy-revealing headers so the
+// checker can classify proxies as transparent, anonymous or elite.
+func (h *Handler) Judge(c *gin.Context) {
+	ip := clientIP(c)
+
+	headers := make(map[string]string)
+	for _, name := range judgeHeaders {
+		values := c.Request.Header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		if value := stripClientAddress(name, strings.Join(values, ", "), ip); value != "" {
+			headers[name] = value
+		}
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, JudgeResponse{
+		IP:        ip,
+		Headers:   headers,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// stripClientAddress drops forwarding entries that only repeat the caller's
+// own address. Our reverse proxy appends them to X-Forwarded-For and friends,
+// and they would otherwise make every elite proxy look anonymous.
+func stripClientAddress(name, value, ip string) string {
+	if ip == "" {
+		return strings.TrimSpace(value)
+	}
+
+	parts := strings.Split(value, ",")
+	kept := parts[:0]
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if forwardedAddress(name, part) == ip {
+			continue
+		}
+		kept = append(kept, part)
+	}
+	return strings.Join(kept, ", ")
+}
+
+func forwardedAddress(name, element string) string {
+	if !strings.EqualFold(name, "Forwarded") {
+		return trimAddress(element)
+	}
+	for _, pair := range strings.Split(element, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && strings.EqualFold(key, "for") {
+			return trimAddress(strings.Trim(value, `"`))
+		}
+	}
+	return ""
+}
+
+func trimAddress(value string) string {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	if parsed := net.ParseIP(value); parsed != nil {
+		return parsed.String()
+	}
+	return value
+}
+
+// JudgeFixture serves the fixture page with the security headers that
+// rewriting proxies tend to drop; the checker compares both with a direct
+// fetch.
+func (h *Handler) JudgeFixture(c *gin.Context) {
+	c.Header("Cache-Control", "no-store, no-transform")
+	c.Header("Content-Security-Policy", "default-src 'none'")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("X-Fixture-Checksum", fixtureChecksum)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(fixturePage))
+}
+
+// JudgePayload streams size bytes of incompressible data for the checker's
+// throughput test.
+func (h *Handler) JudgePayload(c *gin.Context) {
+	size := int64(defaultPayloadBytes)
+	if raw := c.Query("size"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed <= 0 {
+			RespondError(c, http.StatusBadRequest, "INVALID_SIZE", "size must be a positive number of bytes", nil)
+			return
+		}
+		size = parsed
+	}
+	if size > maxPayloadBytes {
+		size = maxPayloadBytes
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Length", strconv.FormatInt(size, 10))
+	c.Status(http.StatusOK)
+
+	for remaining := size; remaining > 0; {
+		chunk := payloadChunk
+		if remaining < int64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+		if _, err := c.Writer.Write(chunk); err != nil {
+			return
+		}
+		remaining -= int64(len(chunk))
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"regexp"
 	"runtime/debug"
+	"slices"
 	"strings"
 	"time"
 
@@ -163,8 +164,15 @@ func SecurityHeadersMiddleware() gin.HandlerFunc {
 	}
 }
 
-func MaxBodySizeMiddleware(maxSize int64) gin.HandlerFunc {
+// MaxBodySizeMiddleware buffers and caps request bodies. Requests to the
+// streaming paths are passed through; their handlers enforce their own limits.
+func MaxBodySizeMiddleware(maxSize int64, streamingPaths ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if slices.Contains(streamingPaths, c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
 		if c.Request.Body != nil && c.Request.ContentLength > maxSize {
 			RespondError(c, http.StatusRequestEntityTooLarge,
 				"REQUEST_TOO_LARGE",
@@ -102,7 +102,7 @@ func (m *ExportManager) CreateJob(ctx context.Context, format string, filters st
 	if m == nil {
 		return nil, errors.New("export manager unavailable")
 	}
-	if !isExportFormatSupported(format) {
+	if !IsExportFormatSupported(format) {
 		return nil, fmt.Errorf("unsupported export format: %s", format)
 	}
 
@@ -326,6 +326,11 @@ func (h *Handler) CreateExportJob(c *gin.Context) {
 		Limit     int    `json:"limit"`
 		Offset    int    `json:"offset"`
 		PageSize  int    `json:"page_size"`
+		IPVersion int    `json:"ip_version"`
+
+		InjectsContent *bool `json:"injects_content"`
+		StripsHeaders  *bool `json:"strips_headers"`
+		MITMTLS        *bool `json:"mitm_tls"`
 	}{
 		Format: c.Query("format"),
 	}
@@ -358,9 +363,21 @@ func (h *Handler) CreateExportJob(c *gin.Context) {
 	if req.Limit == 0 {
 		req.Limit = parseLimit(c.Query("limit"), exportDefaultLimit, exportMaxTotal)
 	}
+	if req.IPVersion == 0 {
+		req.IPVersion = parseIPVersion(c.Query("ip_version"))
+	}
 	if req.PageSize == 0 {
 		req.PageSize = parseLimit(c.Query("page_size"), exportDefaultPageSize, exportMaxPageSize)
 	}
+	if req.InjectsContent == nil {
+		req.InjectsContent = parseFlag(c.Query("injects_content"))
+	}
+	if req.StripsHeaders == nil {
+		req.StripsHeaders = parseFlag(c.Query("strips_headers"))
+	}
+	if req.MITMTLS == nil {
+		req.MITMTLS = parseFlag(c.Query("mitm_tls"))
+	}
 
 	filters := store.ProxyListFilters{
 		CountryCode: sanitizeCountry(req.Country),
@@ -372,6 +389,11 @@ func (h *Handler) CreateExportJob(c *gin.Context) {
 		ASN:         req.ASN,
 		Limit:       req.PageSize,
 		Offset:      req.Offset,
+		IPVersion:   parseIPVersion(strconv.Itoa(req.IPVersion)),
+
+		InjectsContent: req.InjectsContent,
+		StripsHeaders:  req.StripsHeaders,
+		MITMTLS:        req.MITMTLS,
 	}
 
 	job, err := h.exportManager.CreateJob(c.Request.Context(), strings.ToLower(req.Format), filters, req.Limit, req.Offset, req.PageSize)
@@ -471,6 +493,11 @@ func buildProxyListFiltersForExport(c *gin.Context, limit, offset int) store.Pro
 		ASN:         parseASN(c.Query("asn")),
 		Limit:       limit,
 		Offset:      offset,
+		IPVersion:   parseIPVersion(c.Query("ip_version")),
+
+		InjectsContent: parseFlag(c.Query("injects_content")),
+		StripsHeaders:  parseFlag(c.Query("strips_headers")),
+		MITMTLS:        parseFlag(c.Query("mitm_tls")),
 	}
 }
 
@@ -483,7 +510,9 @@ func parseBool(value string) bool {
 	}
 }
 
-func isExportFormatSupported(format string) bool {
+// IsExportFormatSupported reports whether a proxy list can be exported as
+// format.
+func IsExportFormatSupported(format string) bool {
 	switch format {
 	case "txt", "text", "list", "csv", "json", "clash", "surfshark":
 		return true
@@ -500,60 +529,18 @@ func exportProxyList(ctx context.Context, writer io.Writer, store store.ProxyLis
 		return 0, nil
 	}
 
-	format = strings.ToLower(strings.TrimPrefix(format, "."))
-	if !isExportFormatSupported(format) {
-		return 0, fmt.Errorf("unsupported export format: %s", format)
+	out, err := NewProxyListWriter(writer, format)
+	if err != nil {
+		return 0, err
 	}
 
-	processed := 0
 	remaining := totalLimit
 	offset := filters.Offset
-	index := 0
-	firstJSON := true
-
-	var csvWriter *csv.Writer
-	if format == "csv" {
-		csvWriter = csv.NewWriter(writer)
-		if err := csvWriter.Write([]string{
-			"ip",
-			"port",
-			"country_code",
-			"country_name",
-			"city",
-			"region",
-			"asn",
-			"asn_name",
-			"org",
-			"protocols",
-			"anonymity",
-			"uptime",
-			"delay_ms",
-			"last_seen",
-		}); err != nil {
-			return processed, err
-		}
-		csvWriter.Flush()
-		if err := csvWriter.Error(); err != nil {
-			return processed, err
-		}
-	}
-
-	if format == "json" {
-		if _, err := writer.Write([]byte(`{"data":[`)); err != nil {
-			return processed, err
-		}
-	}
-
-	if format == "clash" {
-		if _, err := writer.Write([]byte("proxies:\n")); err != nil {
-			return processed, err
-		}
-	}
 
 	for remaining > 0 {
 		select {
 		case <-ctx.Done():
-			return processed, ctx.Err()
+			return out.Count(), ctx.Err()
 		default:
 		}
 
@@ -566,93 +553,24 @@ func exportProxyList(ctx context.Context, writer io.Writer, store store.ProxyLis
 
 		records, _, err := store.ListProxyList(ctx, filters)
 		if err != nil {
-			return processed, err
+			return out.Count(), err
 		}
 		if len(records) == 0 {
 			break
 		}
 
 		for _, record := range records {
-			item := transformProxyRecord(record)
-			switch format {
-			case "txt", "text", "list":
-				if _, err := fmt.Fprintf(writer, "%s:%d\n", item.IP, item.Port); err != nil {
-					return processed, err
-				}
-			case "csv":
-				recordRow := []string{
-					item.IP,
-					strconv.Itoa(item.Port),
-					item.CountryCode,
-					item.CountryName,
-					item.City,
-					item.Region,
-					intToString(item.ASN),
-					item.ASNName,
-					item.Org,
-					strings.Join(item.Protocols, "|"),
-					item.AnonymityLevel,
-					strconv.Itoa(item.Uptime),
-					strconv.Itoa(item.Delay),
-					item.LastSeen,
-				}
-				if err := csvWriter.Write(recordRow); err != nil {
-					return processed, err
-				}
-			case "json":
-				encoded, err := json.Marshal(item)
-				if err != nil {
-					return processed, err
-				}
-				if !firstJSON {
-					if _, err := writer.Write([]byte(",")); err != nil {
-						return processed, err
-					}
-				}
-				firstJSON = false
-				if _, err := writer.Write(encoded); err != nil {
-					return processed, err
-				}
-			case "clash":
-				proxyType, tls := preferredProxyType(item)
-				name := fmt.Sprintf("proxy-%d-%s", index+1, item.IP)
-				if _, err := fmt.Fprintf(writer, "  - name: \"%s\"\n", name); err != nil {
-					return processed, err
-				}
-				if _, err := fmt.Fprintf(writer, "    type: %s\n", proxyType); err != nil {
-					return processed, err
-				}
-				if _, err := fmt.Fprintf(writer, "    server: %s\n", item.IP); err != nil {
-					return processed, err
-				}
-				if _, err := fmt.Fprintf(writer, "    port: %d\n", item.Port); err != nil {
-					return processed, err
-				}
-				if tls {
-					if _, err := writer.Write([]byte("    tls: true\n")); err != nil {
-						return processed, err
-					}
-				}
-			case "surfshark":
-				scheme := preferredProxyScheme(item)
-				if _, err := fmt.Fprintf(writer, "%s://%s:%d\n", scheme, item.IP, item.Port); err != nil {
-					return processed, err
-				}
+			if err := out.Write(NewProxyListItem(record)); err != nil {
+				return out.Count(), err
 			}
-			processed++
-			index++
 		}
-
-		if format == "csv" {
-			csvWriter.Flush()
-			if err := csvWriter.Error(); err != nil {
-				return processed, err
-			}
+		if err := out.Flush(); err != nil {
+			return out.Count(), err
 		}
 
 		if flush != nil {
 			if err := flush(); err != nil {
-				return processed, err
+				return out.Count(), err
 			}
 		}
 
@@ -663,20 +581,187 @@ func exportProxyList(ctx context.Context, writer io.Writer, store store.ProxyLis
 		}
 	}
 
-	if format == "json" {
-		if _, err := writer.Write([]byte(`]}`)); err != nil {
-			return processed, err
+	return out.Count(), out.Close()
+}
+
+// ProxyListWriter writes proxy list items in one of the export formats, so
+// lists built elsewhere download the same way as the proxy list itself.
+type ProxyListWriter struct {
+	w          io.Writer
+	format     string
+	csv        *csv.Writer
+	count      int
+	firstJSON  bool
+	throughput bool
+}
+
+// ProxyListWriterOption configures a ProxyListWriter.
+type ProxyListWriterOption func(*ProxyListWriter)
+
+// WithThroughputColumns adds the throughput test columns to CSV exports.
+// JSON exports carry the throughput fields whenever an item has them.
+func WithThroughputColumns() ProxyListWriterOption {
+	return func(p *ProxyListWriter) {
+		p.throughput = true
+	}
+}
+
+// NewProxyListWriter writes the header of format to w. Close must be called
+// once every item is written.
+func NewProxyListWriter(w io.Writer, format string, opts ...ProxyListWriterOption) (*ProxyListWriter, error) {
+	format = strings.ToLower(strings.TrimPrefix(format, "."))
+	if !IsExportFormatSupported(format) {
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+
+	p := &ProxyListWriter{w: w, format: format, firstJSON: true}
+	for _, opt := range opts {
+		opt(p)
+	}
+	switch format {
+	case "csv":
+		p.csv = csv.NewWriter(w)
+		header := []string{
+			"ip",
+			"port",
+			"country_code",
+			"country_name",
+			"city",
+			"region",
+			"asn",
+			"asn_name",
+			"org",
+			"protocols",
+			"anonymity",
+			"uptime",
+			"delay_ms",
+			"last_seen",
+		}
+		if p.throughput {
+			header = append(header, "throughput_kbps", "throughput_completed")
+		}
+		if err := p.csv.Write(header); err != nil {
+			return nil, err
+		}
+		if err := p.Flush(); err != nil {
+			return nil, err
+		}
+	case "json":
+		if _, err := w.Write([]byte(`{"data":[`)); err != nil {
+			return nil, err
+		}
+	case "clash":
+		if _, err := w.Write([]byte("proxies:\n")); err != nil {
+			return nil, err
 		}
 	}
+	return p, nil
+}
 
-	if format == "csv" {
-		csvWriter.Flush()
-		if err := csvWriter.Error(); err != nil {
-			return processed, err
+// Count is the number of items written so far.
+func (p *ProxyListWriter) Count() int {
+	return p.count
+}
+
+func (p *ProxyListWriter) Write(item ProxyListItem) error {
+	switch p.format {
+	case "txt", "text", "list":
+		if _, err := fmt.Fprintln(p.w, proxyHostPort(item)); err != nil {
+			return err
+		}
+	case "csv":
+		recordRow := []string{
+			item.IP,
+			strconv.Itoa(item.Port),
+			item.CountryCode,
+			item.CountryName,
+			item.City,
+			item.Region,
+			intToString(item.ASN),
+			item.ASNName,
+			item.Org,
+			strings.Join(item.Protocols, "|"),
+			item.AnonymityLevel,
+			strconv.Itoa(item.Uptime),
+			strconv.Itoa(item.Delay),
+			item.LastSeen,
+		}
+		if p.throughput {
+			recordRow = append(recordRow, throughputColumns(item)...)
+		}
+		if err := p.csv.Write(recordRow); err != nil {
+			return err
+		}
+	case "json":
+		encoded, err := json.Marshal(item)
+		if err != nil {
+			return err
 		}
+		if !p.firstJSON {
+			if _, err := p.w.Write([]byte(",")); err != nil {
+				return err
+			}
+		}
+		p.firstJSON = false
+		if _, err := p.w.Write(encoded); err != nil {
+			return err
+		}
+	case "clash":
+		proxyType, tls := preferredProxyType(item)
+		name := fmt.Sprintf("proxy-%d-%s", p.count+1, item.IP)
+		if _, err := fmt.Fprintf(p.w, "  - name: \"%s\"\n", name); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(p.w, "    type: %s\n", proxyType); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(p.w, "    server: %s\n", item.IP); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(p.w, "    port: %d\n", item.Port); err != nil {
+			return err
+		}
+		if tls {
+			if _, err := p.w.Write([]byte("    tls: true\n")); err != nil {
+				return err
+			}
+		}
+	case "surfshark":
+		scheme := preferredProxyScheme(item)
+		if _, err := fmt.Fprintf(p.w, "%s://%s\n", scheme, proxyHostPort(item)); err != nil {
+			return err
+		}
+	}
+	p.count++
+	return nil
+}
+
+// throughputColumns are the item's throughput test results, empty when no
+// test ran.
+func throughputColumns(item ProxyListItem) []string {
+	if item.ThroughputKBps == nil || item.ThroughputCompleted == nil {
+		return []string{"", ""}
+	}
+	return []string{strconv.FormatFloat(*item.ThroughputKBps, 'f', 1, 64), strconv.FormatBool(*item.ThroughputCompleted)}
+}
+
+// Flush pushes buffered CSV rows to the underlying writer.
+func (p *ProxyListWriter) Flush() error {
+	if p.csv == nil {
+		return nil
 	}
+	p.csv.Flush()
+	return p.csv.Error()
+}
 
-	return processed, nil
+// Close writes the footer of the format.
+func (p *ProxyListWriter) Close() error {
+	if p.format == "json" {
+		if _, err := p.w.Write([]byte(`]}`)); err != nil {
+			return err
+		}
+	}
+	return p.Flush()
 }
 
 func newExportJobID() (string, error) {
@@ -717,7 +802,7 @@ func streamExportResponse(c *gin.Context, store store.ProxyListStore, opts expor
 		filename = fmt.Sprintf("proxy-export-%s-%s.%s", opts.Filters.Protocol, time.Now().UTC().Format("2006-01-02"), opts.Format)
 	}
 
-	setExportHeaders(c, opts.Format, filename)
+	SetExportHeaders(c, opts.Format, filename)
 	flusher, _ := c.Writer.(http.Flusher)
 
 	_, err := exportProxyList(c.Request.Context(), c.Writer, store, opts.Format, opts.Filters, opts.TotalLimit, opts.PageSize, func() error {
@@ -732,7 +817,8 @@ func streamExportResponse(c *gin.Context, store store.ProxyListStore, opts expor
 	}
 }
 
-func setExportHeaders(c *gin.Context, format string, filename string) {
+// SetExportHeaders marks the response as a download of format.
+func SetExportHeaders(c *gin.Context, format string, filename string) {
 	format = strings.ToLower(strings.TrimPrefix(format, "."))
 	contentType := "text/plain; charset=utf-8"
 	if format == "csv" {
@@ -0,0 +1,259 @@
+package api
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"socksproxies.com/server/internal/store"
+)
+
+const (
+	defaultHistoryWindow = 7 * 24 * time.Hour
+	// Longest range one history request may aggregate, per bucket size.
+	maxHourlyHistory = 31 * 24 * time.Hour
+	maxDailyHistory  = 366 * 24 * time.Hour
+)
+
+// ProxyCheckItem is one recorded check of a proxy.
+type ProxyCheckItem struct {
+	Protocol  string `json:"protocol"`
+	Status    bool   `json:"status"`
+	Latency   int64  `json:"latency_ms"`
+	CheckedAt string `json:"checked_at"`
+	ExitIP    string `json:"exit_ip,omitempty"`
+	Country   string `json:"country,omitempty"`
+	Anonymity string `json:"anonymity,omitempty"`
+
+	ConnectMS   int64 `json:"connect_ms,omitempty"`
+	HandshakeMS int64 `json:"handshake_ms,omitempty"`
+	TunnelMS    int64 `json:"tunnel_ms,omitempty"`
+	TLSMS       int64 `json:"tls_ms,omitempty"`
+	TTFBMS      int64 `json:"ttfb_ms,omitempty"`
+
+	DNSMode        string `json:"dns_mode,omitempty"`
+	RemoteDNS      *bool  `json:"remote_dns,omitempty"`
+	DNSLeak        *bool  `json:"dns_leak,omitempty"`
+	InjectsContent *bool  `json:"injects_content,omitempty"`
+	StripsHeaders  *bool  `json:"strips_headers,omitempty"`
+	MITMTLS        *bool  `json:"mitm_tls,omitempty"`
+}
+
+// ProxyDetailItem is a proxy's list entry with its latest checks.
+type ProxyDetailItem struct {
+	Address string           `json:"address"`
+	Proxy   ProxyListItem    `json:"proxy"`
+	Checks  []ProxyCheckItem `json:"checks"`
+}
+
+// ProxyHistorySummary aggregates the checks in a history range.
+type ProxyHistorySummary struct {
+	Bucket  string              `json:"bucket"`
+	Checks  int                 `json:"checks"`
+	Up      int                 `json:"up"`
+	Uptime  float64             `json:"uptime"`
+	Buckets []store.CheckBucket `json:"buckets"`
+}
+
+type ProxyHistoryMeta struct {
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+	Since  string `json:"since"`
+	Until  string `json:"until"`
+}
+
+func newProxyCheckItem(record store.CheckRecord) ProxyCheckItem {
+	return ProxyCheckItem{
+		Protocol:       record.Protocol,
+		Status:         record.Status,
+		Latency:        record.Latency,
+		CheckedAt:      record.CheckedAt.UTC().Format(time.RFC3339),
+		ExitIP:         record.IP,
+		Country:        record.Country,
+		Anonymity:      record.Anonymity,
+		ConnectMS:      record.ConnectMS,
+		HandshakeMS:    record.HandshakeMS,
+		TunnelMS:       record.TunnelMS,
+		TLSMS:          record.TLSMS,
+		TTFBMS:         record.TTFBMS,
+		DNSMode:        record.DNSMode,
+		RemoteDNS:      record.RemoteDNS,
+		DNSLeak:        record.DNSLeak,
+		InjectsContent: record.InjectsContent,
+		StripsHeaders:  record.StripsHeaders,
+		MITMTLS:        record.MITMTLS,
+	}
+}
+
+// GetProxyDetail serves a proxy's list entry joined with its latest checks
+// (?checks=, default 20). Proxies that are not on the list are not found, even
+// if users have checked them.
+func (h *Handler) GetProxyDetail(c *gin.Context) {
+	ip, port, ok := parseProxyParams(c)
+	if !ok {
+		return
+	}
+
+	detail, err := h.store.GetProxyDetail(c.Request.Context(), ip, port, parseLimit(c.Query("checks"), 20, 100))
+	if err != nil {
+		log.Printf("[ERROR] failed to load proxy %s:%d: %v", ip, port, err)
+		RespondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "failed to load proxy", nil)
+		return
+	}
+	if detail.Record == nil {
+		RespondError(c, http.StatusNotFound, "PROXY_NOT_FOUND", "proxy not found", nil)
+		return
+	}
+
+	data := ProxyDetailItem{
+		Address: net.JoinHostPort(ip, strconv.Itoa(port)),
+		Proxy:   NewProxyListItem(*detail.Record),
+		Checks:  make([]ProxyCheckItem, 0, len(detail.Checks)),
+	}
+	for _, check := range detail.Checks {
+		data.Checks = append(data.Checks, newProxyCheckItem(check))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// GetProxyHistory pages through a proxy's checks between since and until
+// (RFC 3339 or unix seconds; the last week by default) and aggregates them
+// per hour or day (?bucket=). Like the detail, it is only served for proxies
+// on the list.
+func (h *Handler) GetProxyHistory(c *gin.Context) {
+	ip, port, ok := parseProxyParams(c)
+	if !ok {
+		return
+	}
+
+	until := time.Now().UTC()
+	if raw := c.Query("until"); raw != "" {
+		if until, ok = parseHistoryTime(raw); !ok {
+			RespondError(c, http.StatusBadRequest, "INVALID_RANGE", "until must be RFC 3339 or unix seconds", nil)
+			return
+		}
+	}
+	since := until.Add(-defaultHistoryWindow)
+	if raw := c.Query("since"); raw != "" {
+		if since, ok = parseHistoryTime(raw); !ok {
+			RespondError(c, http.StatusBadRequest, "INVALID_RANGE", "since must be RFC 3339 or unix seconds", nil)
+			return
+		}
+	}
+	if !since.Before(until) {
+		RespondError(c, http.StatusBadRequest, "INVALID_RANGE", "since must be before until", nil)
+		return
+	}
+
+	bucket := strings.ToLower(c.DefaultQuery("bucket", store.HistoryHour))
+	var maxRange time.Duration
+	switch bucket {
+	case store.HistoryHour:
+		maxRange = maxHourlyHistory
+	case store.HistoryDay:
+		maxRange = maxDailyHistory
+	default:
+		RespondError(c, http.StatusBadRequest, "INVALID_BUCKET", "bucket must be hour or day", nil)
+		return
+	}
+	if until.Sub(since) > maxRange {
+		RespondError(c, http.StatusBadRequest, "INVALID_RANGE", "range too long for this bucket", map[string]any{
+			"bucket":    bucket,
+			"max_hours": int(maxRange.Hours()),
+		})
+		return
+	}
+
+	filters := store.ProxyHistoryFilters{
+		IP:     ip,
+		Port:   port,
+		Since:  since,
+		Until:  until,
+		Limit:  parseLimit(c.Query("limit"), 50, 500),
+		Offset: parseOffset(c.Query("offset")),
+	}
+	ctx := c.Request.Context()
+	detail, err := h.store.GetProxyDetail(ctx, ip, port, 0)
+	if err != nil {
+		log.Printf("[ERROR] failed to load proxy %s:%d: %v", ip, port, err)
+		RespondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "failed to load proxy history", nil)
+		return
+	}
+	if detail.Record == nil {
+		RespondError(c, http.StatusNotFound, "PROXY_NOT_FOUND", "proxy not found", nil)
+		return
+	}
+
+	checks, total, err := h.store.ListProxyChecks(ctx, filters)
+	if err != nil {
+		log.Printf("[ERROR] failed to list checks for %s:%d: %v", ip, port, err)
+		RespondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "failed to load proxy history", nil)
+		return
+	}
+	buckets, err := h.store.AggregateProxyChecks(ctx, filters, bucket)
+	if err != nil {
+		log.Printf("[ERROR] failed to aggregate checks for %s:%d: %v", ip, port, err)
+		RespondError(c, http.StatusInternalServerError, "DATABASE_ERROR", "failed to load proxy history", nil)
+		return
+	}
+
+	data := make([]ProxyCheckItem, 0, len(checks))
+	for _, check := range checks {
+		data = append(data, newProxyCheckItem(check))
+	}
+	summary := ProxyHistorySummary{Bucket: bucket, Buckets: buckets}
+	if summary.Buckets == nil {
+		summary.Buckets = []store.CheckBucket{}
+	}
+	for _, b := range buckets {
+		summary.Checks += b.Checks
+		summary.Up += b.Up
+	}
+	if summary.Checks > 0 {
+		summary.Uptime = math.Round(float64(summary.Up)/float64(summary.Checks)*10000) / 100
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":    data,
+		"summary": summary,
+		"meta": ProxyHistoryMeta{
+			Total:  total,
+			Limit:  filters.Limit,
+			Offset: filters.Offset,
+			Since:  since.Format(time.RFC3339),
+			Until:  until.Format(time.RFC3339),
+		},
+	})
+}
+
+// parseProxyParams reads the :ip and :port of a proxy route, answering 400
+// when they do not name a proxy.
+func parseProxyParams(c *gin.Context) (string, int, bool) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(c.Param("ip")))
+	port, portErr := strconv.Atoi(c.Param("port"))
+	if err != nil || addr.Zone() != "" || portErr != nil || port < 1 || port > 65535 {
+		RespondError(c, http.StatusBadRequest, "INVALID_PROXY", "ip must be an IP address and port between 1 and 65535", nil)
+		return "", 0, false
+	}
+	return addr.Unmap().String(), port, true
+}
+
+func parseHistoryTime(raw string) (time.Time, bool) {
+	if unix, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Unix(unix, 0).UTC(), true
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t.UTC(), true
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"socksproxies.com/server/internal/config"
+	"socksproxies.com/server/internal/store"
+)
+
+func newProxyHistoryRouter(t *testing.T) (*gin.Engine, time.Time) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	st, err := store.OpenStore("", "", t.TempDir()+"/test.db")
+	require.NoError(t, err)
+	t.Cleanup(func() { st.Close() })
+
+	ctx := context.Background()
+	_, err = st.UpsertProxyListBatch(ctx, []store.ProxyListRecord{
+		{Host: "192.0.2.1", IP: "192.0.2.1", Port: 1080, CountryCode: "US", Socks5: 1, LastSeen: time.Now().UTC()},
+	})
+	require.NoError(t, err)
+
+	now := time.Now().UTC().Truncate(time.Hour)
+	for _, address := range []string{"192.0.2.1:1080", "[2001:db8::1]:3128"} {
+		proxyID, err := st.UpsertProxy(ctx, store.ProxyRecord{Address: address, Protocol: "socks5"})
+		require.NoError(t, err)
+		for i, latency := range []int64{100, 0, 300} {
+			require.NoError(t, st.InsertCheck(ctx, store.CheckRecord{
+				ProxyID:   proxyID,
+				Status:    latency > 0,
+				Latency:   latency,
+				CheckedAt: now.Add(-time.Duration(i) * 25 * time.Hour),
+			}))
+		}
+	}
+
+	h := NewHandler(config.Config{}, st, nil)
+	router := gin.New()
+	router.GET("/api/proxies/export/:format", h.ExportProxyList)
+	router.GET("/api/proxies/:ip/:port", h.GetProxyDetail)
+	router.GET("/api/proxies/:ip/:port/history", h.GetProxyHistory)
+	return router, now
+}
+
+func TestGetProxyDetail(t *testing.T) {
+	router, _ := newProxyHistoryRouter(t)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/proxies/192.0.2.1/1080?checks=2", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var response struct {
+		Data ProxyDetailItem `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "US", response.Data.Proxy.CountryCode)
+	require.Len(t, response.Data.Checks, 2)
+	assert.Equal(t, int64(100), response.Data.Checks[0].Latency)
+
+	for path, code := range map[string]int{
+		"/api/proxies/198.51.100.1/1080": http.StatusNotFound,
+		// Checked by users but not on the list.
+		"/api/proxies/2001:db8::1/3128": http.StatusNotFound,
+		"/api/proxies/not-an-ip/1080":   http.StatusBadRequest,
+		"/api/proxies/192.0.2.1/70000":  http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, code, rec.Code, path)
+	}
+}
+
+func TestGetProxyHistory(t *testing.T) {
+	router, now := newProxyHistoryRouter(t)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/proxies/192.0.2.1/1080/history?bucket=day&limit=1&offset=1", nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var response struct {
+		Data    []ProxyCheckItem    `json:"data"`
+		Summary ProxyHistorySummary `json:"summary"`
+		Meta    ProxyHistoryMeta    `json:"meta"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, 3, response.Meta.Total)
+	require.Len(t, response.Data, 1)
+	assert.False(t, response.Data[0].Status)
+	assert.Equal(t, 3, response.Summary.Checks)
+	assert.Equal(t, 66.67, response.Summary.Uptime)
+	assert.Len(t, response.Summary.Buckets, 3)
+
+	since := now.Add(-time.Hour).Format(time.RFC3339)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/proxies/192.0.2.1/1080/history?since="+since, nil))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.Len(t, response.Summary.Buckets, 1)
+	bucket := response.Summary.Buckets[0]
+	assert.Equal(t, 100.0, bucket.Uptime)
+	require.NotNil(t, bucket.LatencyP50)
+	assert.Equal(t, 100.0, *bucket.LatencyP50)
+
+	for _, query := range []string{"bucket=week", "since=yesterday", "since=0", "until=1&since=2"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/proxies/192.0.2.1/1080/history?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+
+	for _, path := range []string{"/api/proxies/198.51.100.1/1080/history", "/api/proxies/2001:db8::1/3128/history"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code, path)
+	}
+
+	// The detail routes leave the export routes alone.
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/proxies/export/xml", nil))
+	assert.NotContains(t, rec.Body.String(), "INVALID_PROXY")
+}
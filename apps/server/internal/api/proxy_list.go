@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -25,6 +26,7 @@ type ProxyListItem struct {
 	Host           string   `json:"host"`
 	IP             string   `json:"ip"`
 	Port           int      `json:"port"`
+	IPVersion      int      `json:"ip_version"`
 	Delay          int      `json:"delay"`
 	CountryCode    string   `json:"country_code"`
 	CountryName    string   `json:"country_name"`
@@ -45,6 +47,13 @@ type ProxyListItem struct {
 	AnonymityLevel string   `json:"anonymity_level"`
 	Uptime         int      `json:"uptime"`
 	LastSeen       string   `json:"last_seen"`
+	// Tamper flags from our own checks; absent until a check has run them.
+	InjectsContent *bool `json:"injects_content,omitempty"`
+	StripsHeaders  *bool `json:"strips_headers,omitempty"`
+	MITMTLS        *bool `json:"mitm_tls,omitempty"`
+	// Download rate from a check's throughput test, when it ran one.
+	ThroughputKBps      *float64 `json:"throughput_kbps,omitempty"`
+	ThroughputCompleted *bool    `json:"throughput_completed,omitempty"`
 }
 
 type ProxyListMeta struct {
@@ -195,7 +204,7 @@ func (h *Handler) ListRecentProxies(c *gin.Context) {
 
 	data := make([]ProxyListItem, 0, len(records))
 	for _, record := range records {
-		data = append(data, transformProxyRecord(record))
+		data = append(data, NewProxyListItem(record))
 	}
 
 	payload := gin.H{
@@ -237,7 +246,7 @@ func (h *Handler) ListRandomProxies(c *gin.Context) {
 
 	data := make([]ProxyListItem, 0, len(records))
 	for _, record := range records {
-		data = append(data, transformProxyRecord(record))
+		data = append(data, NewProxyListItem(record))
 	}
 
 	payload := gin.H{
@@ -264,7 +273,7 @@ func (h *Handler) ExportProxyList(c *gin.Context) {
 	}
 
 	format := strings.ToLower(strings.TrimPrefix(c.Param("format"), "."))
-	if !isExportFormatSupported(format) {
+	if !IsExportFormatSupported(format) {
 		RespondError(c, http.StatusBadRequest, "INVALID_EXPORT_FORMAT", "unsupported export format", nil)
 		return
 	}
@@ -307,7 +316,7 @@ func (h *Handler) ExportProxyList(c *gin.Context) {
 
 	data := make([]ProxyListItem, 0, len(records))
 	for _, record := range records {
-		data = append(data, transformProxyRecord(record))
+		data = append(data, NewProxyListItem(record))
 	}
 
 	filename := fmt.Sprintf("proxy-export-%s-%s.%s", opts.Filters.Protocol, time.Now().UTC().Format("2006-01-02"), format)
@@ -318,7 +327,7 @@ func (h *Handler) ExportProxyList(c *gin.Context) {
 	switch format {
 	case "txt", "text", "list":
 		payload := buildPlainProxyList(data)
-		setExportHeaders(c, format, filename)
+		SetExportHeaders(c, format, filename)
 		c.String(http.StatusOK, payload)
 	case "csv":
 		payload, err := buildProxyCSV(data)
@@ -326,18 +335,18 @@ func (h *Handler) ExportProxyList(c *gin.Context) {
 			RespondError(c, http.StatusInternalServerError, "EXPORT_ERROR", "failed to build csv export", nil)
 			return
 		}
-		setExportHeaders(c, format, filename)
+		SetExportHeaders(c, format, filename)
 		c.Data(http.StatusOK, "text/csv; charset=utf-8", payload)
 	case "json":
-		setExportHeaders(c, format, filename)
+		SetExportHeaders(c, format, filename)
 		c.JSON(http.StatusOK, gin.H{"data": data})
 	case "clash":
 		payload := buildClashConfig(data)
-		setExportHeaders(c, format, filename)
+		SetExportHeaders(c, format, filename)
 		c.String(http.StatusOK, payload)
 	case "surfshark":
 		payload := buildSurfsharkList(data)
-		setExportHeaders(c, format, filename)
+		SetExportHeaders(c, format, filename)
 		c.String(http.StatusOK, payload)
 	default:
 		RespondError(c, http.StatusBadRequest, "INVALID_EXPORT_FORMAT", "unsupported export format", nil)
@@ -437,7 +446,7 @@ func (h *Handler) handleProxyList(c *gin.Context, authenticated bool) {
 
 	data := make([]ProxyListItem, 0, len(records))
 	for _, record := range records {
-		data = append(data, transformProxyRecord(record))
+		data = append(data, NewProxyListItem(record))
 	}
 
 	cacheAge := h.getCacheAgeSeconds(c)
@@ -686,9 +695,22 @@ func buildProxyListFilters(c *gin.Context, limitDefault, limitMax int) store.Pro
 		ASN:         parseASN(c.Query("asn")),
 		Limit:       parseLimit(c.Query("limit"), limitDefault, limitMax),
 		Offset:      parseOffset(c.Query("offset")),
+		IPVersion:   parseIPVersion(c.Query("ip_version")),
+
+		InjectsContent: parseFlag(c.Query("injects_content")),
+		StripsHeaders:  parseFlag(c.Query("strips_headers")),
+		MITMTLS:        parseFlag(c.Query("mitm_tls")),
 	}
 }
 
+// ParseProxyListFilters reads the proxy list filters from the query string,
+// without paging.
+func ParseProxyListFilters(c *gin.Context) store.ProxyListFilters {
+	filters := buildProxyListFilters(c, 1, 1)
+	filters.Limit, filters.Offset = 0, 0
+	return filters
+}
+
 func sanitizeCountry(value string) string {
 	value = strings.TrimSpace(value)
 	if len(value) != 2 {
@@ -772,6 +794,33 @@ func parseASN(value string) int {
 	return parsed
 }
 
+// parseIPVersion accepts 4/6 or ipv4/ipv6; anything else means no filter.
+func parseIPVersion(value string) int {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "4", "ipv4", "v4":
+		return 4
+	case "6", "ipv6", "v6":
+		return 6
+	default:
+		return 0
+	}
+}
+
+// parseFlag reads a tri-state filter: true, false, or nil when the value is
+// missing or unrecognised.
+func parseFlag(value string) *bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes":
+		v := true
+		return &v
+	case "0", "false", "no":
+		v := false
+		return &v
+	default:
+		return nil
+	}
+}
+
 func cacheKeyPart(value string) string {
 	value = strings.TrimSpace(value)
 	if value == "" {
@@ -818,6 +867,22 @@ func buildProxyCacheKey(filters store.ProxyListFilters, authenticated bool, vers
 		cacheKeyInt(filters.Limit, true),
 		cacheKeyInt(filters.Offset, true),
 	}
+	if filters.IPVersion != 0 {
+		// Appended only when set so existing cache keys stay valid.
+		parts = append(parts, "ipv"+strconv.Itoa(filters.IPVersion))
+	}
+	for _, flag := range []struct {
+		name  string
+		value *bool
+	}{
+		{"injects", filters.InjectsContent},
+		{"strips", filters.StripsHeaders},
+		{"mitm", filters.MITMTLS},
+	} {
+		if flag.value != nil {
+			parts = append(parts, flag.name+"="+strconv.FormatBool(*flag.value))
+		}
+	}
 	return strings.Join(parts, ":")
 }
 
@@ -842,7 +907,8 @@ func buildProxyRecentCacheKey(limit int, version string) string {
 	return fmt.Sprintf("proxylist:v:%s:recent:%d", version, limit)
 }
 
-func transformProxyRecord(record store.ProxyListRecord) ProxyListItem {
+// NewProxyListItem presents a stored record the way the proxy list API does.
+func NewProxyListItem(record store.ProxyListRecord) ProxyListItem {
 	protocols := make([]string, 0, 4)
 	if record.HTTP == 1 {
 		protocols = append(protocols, "HTTP")
@@ -882,6 +948,7 @@ func transformProxyRecord(record store.ProxyListRecord) ProxyListItem {
 		Host:           record.Host,
 		IP:             record.IP,
 		Port:           record.Port,
+		IPVersion:      proxyIPVersion(record.IP),
 		Delay:          record.Delay,
 		CountryCode:    record.CountryCode,
 		CountryName:    record.CountryName,
@@ -902,17 +969,37 @@ func transformProxyRecord(record store.ProxyListRecord) ProxyListItem {
 		AnonymityLevel: anonymity,
 		Uptime:         uptime,
 		LastSeen:       lastSeen,
+		InjectsContent: record.InjectsContent,
+		StripsHeaders:  record.StripsHeaders,
+		MITMTLS:        record.MITMTLS,
 	}
 }
 
 func buildPlainProxyList(items []ProxyListItem) string {
 	lines := make([]string, 0, len(items))
 	for _, item := range items {
-		lines = append(lines, fmt.Sprintf("%s:%d", item.IP, item.Port))
+		lines = append(lines, proxyHostPort(item))
 	}
 	return strings.Join(lines, "\n")
 }
 
+// proxyHostPort brackets IPv6 addresses so the port stays unambiguous.
+func proxyHostPort(item ProxyListItem) string {
+	return net.JoinHostPort(item.IP, strconv.Itoa(item.Port))
+}
+
+func proxyIPVersion(ip string) int {
+	parsed := net.ParseIP(ip)
+	switch {
+	case parsed == nil:
+		return 0
+	case parsed.To4() != nil:
+		return 4
+	default:
+		return 6
+	}
+}
+
 func buildProxyCSV(items []ProxyListItem) ([]byte, error) {
 	buf := &bytes.Buffer{}
 	writer := csv.NewWriter(buf)
@@ -983,7 +1070,7 @@ func buildSurfsharkList(items []ProxyListItem) string {
 	lines := make([]string, 0, len(items))
 	for _, item := range items {
 		scheme := preferredProxyScheme(item)
-		lines = append(lines, fmt.Sprintf("%s://%s:%d", scheme, item.IP, item.Port))
+		lines = append(lines, scheme+"://"+proxyHostPort(item))
 	}
 	return strings.Join(lines, "\n")
 }
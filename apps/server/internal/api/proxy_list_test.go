@@ -108,6 +108,18 @@ func (m *mockUnifiedStore) CountProxies(ctx context.Context) (int, error) {
 	return 0, nil
 }
 
+func (m *mockUnifiedStore) GetProxyDetail(ctx context.Context, ip string, port int, recent int) (store.ProxyDetail, error) {
+	return store.ProxyDetail{}, nil
+}
+
+func (m *mockUnifiedStore) ListProxyChecks(ctx context.Context, filters store.ProxyHistoryFilters) ([]store.CheckRecord, int, error) {
+	return nil, 0, nil
+}
+
+func (m *mockUnifiedStore) AggregateProxyChecks(ctx context.Context, filters store.ProxyHistoryFilters, bucket string) ([]store.CheckBucket, error) {
+	return nil, nil
+}
+
 func newTestHandler(proxyStore *mockProxyListStore, apiKeys []string) *Handler {
 	cfg := config.Config{
 		RateLimitPerDay:  100,
@@ -904,6 +916,26 @@ func TestParseASN(t *testing.T) {
 	}
 }
 
+func TestParseIPVersion(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected int
+	}{
+		{"4", 4},
+		{"ipv6", 6},
+		{" V6 ", 6},
+		{"5", 0},
+		{"", 0},
+	}
+
+	for _, tc := range cases {
+		result := parseIPVersion(tc.input)
+		if result != tc.expected {
+			t.Errorf("parseIPVersion(%q) = %d, expected %d", tc.input, result, tc.expected)
+		}
+	}
+}
+
 func TestBuildProxyCacheKey(t *testing.T) {
 	filters := store.ProxyListFilters{
 		CountryCode: "US",
@@ -949,7 +981,7 @@ func TestTransformProxyRecord(t *testing.T) {
 		LastSeen:    time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
 	}
 
-	item := transformProxyRecord(record)
+	item := NewProxyListItem(record)
 
 	if item.Host != "proxy.example.com" {
 		t.Errorf("expected host proxy.example.com, got %s", item.Host)
@@ -990,7 +1022,7 @@ func TestTransformProxyRecord_AnonymityLevels(t *testing.T) {
 
 	for _, tc := range cases {
 		record := store.ProxyListRecord{IP: "192.168.1.1", Port: 8080, Anon: tc.anon}
-		item := transformProxyRecord(record)
+		item := NewProxyListItem(record)
 		if item.AnonymityLevel != tc.expected {
 			t.Errorf("anon %d: expected %s, got %s", tc.anon, tc.expected, item.AnonymityLevel)
 		}
@@ -1005,7 +1037,7 @@ func TestTransformProxyRecord_ZeroChecks(t *testing.T) {
 		ChecksDown: 0,
 	}
 
-	item := transformProxyRecord(record)
+	item := NewProxyListItem(record)
 	if item.Uptime != 0 {
 		t.Errorf("expected 0%% uptime for zero checks, got %d", item.Uptime)
 	}
@@ -1017,12 +1049,79 @@ func TestTransformProxyRecord_ZeroLastSeen(t *testing.T) {
 		Port: 8080,
 	}
 
-	item := transformProxyRecord(record)
+	item := NewProxyListItem(record)
 	if item.LastSeen != "" {
 		t.Errorf("expected empty last_seen for zero time, got %s", item.LastSeen)
 	}
 }
 
+func TestTransformProxyRecord_IPv6(t *testing.T) {
+	record := store.ProxyListRecord{
+		IP:     "2001:db8::1",
+		Port:   1080,
+		Socks5: 1,
+	}
+
+	item := NewProxyListItem(record)
+	if item.IPVersion != 6 {
+		t.Errorf("expected ip_version 6, got %d", item.IPVersion)
+	}
+	if got := buildPlainProxyList([]ProxyListItem{item}); got != "[2001:db8::1]:1080" {
+		t.Errorf("expected bracketed address in plain list, got %q", got)
+	}
+	if got := buildSurfsharkList([]ProxyListItem{item}); got != "socks5://[2001:db8::1]:1080" {
+		t.Errorf("expected bracketed address in surfshark list, got %q", got)
+	}
+
+	filtered := buildProxyCacheKey(store.ProxyListFilters{IPVersion: 6}, false, "1")
+	if filtered == buildProxyCacheKey(store.ProxyListFilters{}, false, "1") {
+		t.Error("expected ip_version to change the cache key")
+	}
+}
+
+func TestParseFlag(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected *bool
+	}{
+		{"true", boolPtr(true)},
+		{" 1 ", boolPtr(true)},
+		{"no", boolPtr(false)},
+		{"0", boolPtr(false)},
+		{"maybe", nil},
+		{"", nil},
+	}
+
+	for _, tc := range cases {
+		result := parseFlag(tc.input)
+		if (result == nil) != (tc.expected == nil) || (result != nil && *result != *tc.expected) {
+			t.Errorf("parseFlag(%q) = %v, expected %v", tc.input, result, tc.expected)
+		}
+	}
+}
+
+func TestBuildProxyCacheKey_TamperFlags(t *testing.T) {
+	base := buildProxyCacheKey(store.ProxyListFilters{}, false, "1")
+	injects := buildProxyCacheKey(store.ProxyListFilters{InjectsContent: boolPtr(true)}, false, "1")
+	clean := buildProxyCacheKey(store.ProxyListFilters{InjectsContent: boolPtr(false)}, false, "1")
+	mitm := buildProxyCacheKey(store.ProxyListFilters{MITMTLS: boolPtr(true)}, false, "1")
+
+	if injects == base || clean == base || injects == clean || mitm == injects {
+		t.Errorf("expected distinct cache keys, got %q %q %q %q", base, injects, clean, mitm)
+	}
+}
+
+func TestTransformProxyRecord_TamperFlags(t *testing.T) {
+	item := NewProxyListItem(store.ProxyListRecord{IP: "192.0.2.1", Port: 8080, MITMTLS: boolPtr(true)})
+	if item.MITMTLS == nil || !*item.MITMTLS || item.InjectsContent != nil {
+		t.Errorf("expected only mitm_tls to be carried over, got %+v", item)
+	}
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
 func TestRateWindowReset(t *testing.T) {
 	reset := rateWindowReset(time.Hour)
 	now := time.Now().UTC()
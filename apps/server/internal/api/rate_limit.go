@@ -93,6 +93,12 @@ func selectLimiter(path string, cfg config.Config, limits APILimiters) (*rate.Li
 		return limits.Heavy, cfg.APIRateLimitHeavy, "heavy"
 	case strings.HasPrefix(path, "/api/v1/proxies"):
 		return limits.Heavy, cfg.APIRateLimitHeavy, "heavy"
+	case strings.HasPrefix(path, "/api/judge/payload"):
+		return limits.Heavy, cfg.APIRateLimitHeavy, "heavy"
+	case strings.HasPrefix(path, "/api/check"):
+		return limits.Heavy, cfg.APIRateLimitHeavy, "heavy"
+	case strings.HasPrefix(path, "/api/v1/checks"):
+		return limits.Standard, cfg.APIRateLimitStandard, "standard"
 	case strings.HasPrefix(path, "/api/proxies"):
 		return limits.Standard, cfg.APIRateLimitStandard, "standard"
 	case strings.HasPrefix(path, "/api/asn"):
@@ -23,7 +23,8 @@ func NewRouter(cfg config.Config) *gin.Engine {
 	router.Use(MetricsMiddleware())
 	router.Use(SecurityHeadersMiddleware())
 	router.Use(CORSMiddleware(cfg))
-	router.Use(MaxBodySizeMiddleware(cfg.MaxBodySize))
+	// Proxy list uploads are streamed to disk by their handler.
+	router.Use(MaxBodySizeMiddleware(cfg.MaxBodySize, "/api/v1/checks/upload"))
 	router.Use(WAFMiddleware(cfg))
 	router.Use(SlowRequestMiddleware(cfg.SlowRequestThreshold))
 
@@ -14,7 +14,7 @@ var (
 
 	hostPortPattern = regexp.MustCompile(`^([a-zA-Z0-9\-\.]+|\[[a-fA-F0-9\:]+\]):(\d{1,5})$`)
 	ipPortPattern   = regexp.MustCompile(`^(\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3})\:(\d{1,5})$`)
-	ipv6PortPattern = regexp.MustCompile(`^\[([a-fA-F0-9\:]+)\]:(\d{1,5})$`)
+	ipv6PortPattern = regexp.MustCompile(`^\[([a-fA-F0-9\:\.]+)\]:(\d{1,5})$`)
 )
 
 type ProxyListRequest struct {
@@ -95,7 +95,7 @@ func ValidateProxyAddress(address string) []ValidationError {
 		host = matches[1]
 		portStr = matches[2]
 	} else if matches := ipv6PortPattern.FindStringSubmatch(address); len(matches) == 3 {
-		host = "[" + matches[1] + "]"
+		host = matches[1]
 		portStr = matches[2]
 	} else if matches := hostPortPattern.FindStringSubmatch(address); len(matches) == 3 {
 		host = matches[1]
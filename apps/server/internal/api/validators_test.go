@@ -8,6 +8,8 @@ func TestValidateProxyAddress(t *testing.T) {
 		"192.168.1.1:3128",
 		"example.com:1080",
 		"proxy.example.com:8888",
+		"[2001:db8::1]:1080",
+		"[::ffff:192.0.2.1]:3128",
 	}
 
 	for _, tc := range validCases {
@@ -30,6 +32,8 @@ func TestValidateProxyAddressInvalid(t *testing.T) {
 		{"invalid_port_text", "127.0.0.1:abc"},
 		{"sql_injection", "127.0.0.1:8080; DROP TABLE proxies--"},
 		{"xss_attack", "<script>alert(1)</script>:8080"},
+		{"ipv6_unbracketed", "2001:db8::1:1080"},
+		{"ipv6_invalid", "[2001:db8::zz]:1080"},
 	}
 
 	for _, tc := range invalidCases {
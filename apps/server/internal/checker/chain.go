@@ -0,0 +1,148 @@
+package checker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// MaxChainHops caps how many proxies a chain may go through.
+const MaxChainHops = 5
+
+// HopResult reports one proxy of a chain.
+type HopResult struct {
+	Address  string `json:"address"`
+	Protocol string `json:"protocol"`
+	// LatencyMS is the time this hop added to the connection: the TCP
+	// connect for the first hop, the tunnel through the previous hop for the
+	// others.
+	LatencyMS int64 `json:"latency_ms"`
+}
+
+// hops returns the proxies a target goes through, in order.
+func (t ProxyTarget) hops() []ProxyTarget {
+	head := t
+	head.Chain = nil
+	return append([]ProxyTarget{head}, t.Chain...)
+}
+
+// exit is the hop traffic leaves the chain from.
+func (t ProxyTarget) exit() ProxyTarget {
+	if len(t.Chain) > 0 {
+		return t.Chain[len(t.Chain)-1]
+	}
+	return t
+}
+
+// withLocalDNS marks every hop to resolve destination names on the checker's
+// side.
+func (t ProxyTarget) withLocalDNS() ProxyTarget {
+	t.localDNS = true
+	t.Chain = slices.Clone(t.Chain)
+	for i := range t.Chain {
+		t.Chain[i].localDNS = true
+	}
+	return t
+}
+
+// proxyDialFunc returns a dialer that opens tunnels through the target,
+// following its chain if it has one. HTTP proxies are driven with CONNECT.
+func proxyDialFunc(target ProxyTarget, resolver *net.Resolver, forward proxy.ContextDialer) (dialFunc, error) {
+	if len(target.Chain) > 0 {
+		return chainDialFunc(target.hops(), resolver, forward)
+	}
+	return protocolDialFunc(target, resolver, forward)
+}
+
+// chainDialFunc composes the hop dialers so each hop is reached through the
+// one before it. Every dial records how long it took to reach each hop.
+func chainDialFunc(hops []ProxyTarget, resolver *net.Resolver, forward proxy.ContextDialer) (dialFunc, error) {
+	if len(hops) > MaxChainHops {
+		return nil, fmt.Errorf("proxy chain too long (max %d hops)", MaxChainHops)
+	}
+	var dial dialFunc
+	for i, hop := range hops {
+		next, err := protocolDialFunc(hop, resolver, hopDialer{forward: forward, hop: i, address: hop.Address})
+		if err != nil {
+			return nil, fmt.Errorf("hop %d (%s): %w", i+1, hop.Address, err)
+		}
+		dial = next
+		forward = contextDialer(next)
+	}
+	return dial, nil
+}
+
+// httpConnectDialFunc tunnels through an HTTP proxy with CONNECT.
+func httpConnectDialFunc(target ProxyTarget, forward proxy.ContextDialer) dialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := forward.DialContext(ctx, "tcp", target.Address)
+		if err != nil {
+			return nil, err
+		}
+		stop := watchConnContext(ctx, conn)
+		req := newConnectRequest(address, target)
+		if err := req.Write(conn); err != nil {
+			stop()
+			conn.Close()
+			return nil, err
+		}
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, req)
+		if ctxErr := stop(); ctxErr != nil && err == nil {
+			err = ctxErr
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			conn.Close()
+			return nil, fmt.Errorf("CONNECT rejected with status %d", resp.StatusCode)
+		}
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+}
+
+type contextDialer dialFunc
+
+func (d contextDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d(ctx, network, address)
+}
+
+// hopDialer opens the connection to one hop of a chain, timing it and naming
+// the hop in errors.
+type hopDialer struct {
+	forward proxy.ContextDialer
+	hop     int
+	address string
+}
+
+func (d hopDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	start := time.Now()
+	conn, err := d.forward.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, fmt.Errorf("reach hop %d (%s): %w", d.hop+1, d.address, err)
+	}
+	phasesFrom(ctx).recordHop(d.hop, time.Since(start))
+	return conn, nil
+}
+
+// hopResults pairs a chain's hops with the latencies measured for them.
+func hopResults(hops []ProxyTarget, latencies []int64) []HopResult {
+	out := make([]HopResult, len(hops))
+	for i, hop := range hops {
+		out[i] = HopResult{Address: hop.Address, Protocol: strings.ToLower(hop.Protocol)}
+		if i < len(latencies) {
+			out[i].LatencyMS = latencies[i]
+		}
+	}
+	return out
+}
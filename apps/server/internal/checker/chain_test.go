@@ -0,0 +1,87 @@
+package checker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckProxy_Chain(t *testing.T) {
+	judge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("203.0.113.5"))
+	}))
+	defer judge.Close()
+	_, judgePort, _ := net.SplitHostPort(strings.TrimPrefix(judge.URL, "http://"))
+
+	entry := startHTTPProxy(t, true, "")
+	exit, requests := startSOCKS5Server(t, "alice", "secret", 0x00)
+	target := ProxyTarget{
+		Address:  entry,
+		Protocol: "http",
+		Chain:    []ProxyTarget{{Address: exit, Protocol: "socks5h", Username: "alice", Password: "secret"}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := CheckProxy(ctx, target, judge.URL, nil)
+	if !result.Status {
+		t.Fatalf("expected the chain to pass, got error %q", result.Error)
+	}
+	if result.ExitIP != "203.0.113.5" {
+		t.Errorf("expected exit ip from the judge, got %q", result.ExitIP)
+	}
+	select {
+	case req := <-requests:
+		if strconv.Itoa(req.port) != judgePort {
+			t.Errorf("expected the exit hop to connect to the judge, got port %d", req.port)
+		}
+	default:
+		t.Fatal("expected the exit hop to receive a CONNECT")
+	}
+
+	if len(result.Hops) != 2 {
+		t.Fatalf("expected 2 hop results, got %+v", result.Hops)
+	}
+	if result.Hops[0].Address != entry || result.Hops[0].Protocol != "http" ||
+		result.Hops[1].Address != exit || result.Hops[1].Protocol != "socks5h" {
+		t.Errorf("unexpected hops %+v", result.Hops)
+	}
+	var total int64
+	for _, hop := range result.Hops {
+		if hop.LatencyMS < 0 {
+			t.Errorf("negative hop latency %+v", hop)
+		}
+		total += hop.LatencyMS
+	}
+	if total > result.Latency {
+		t.Errorf("hop latencies %d exceed end-to-end latency %d", total, result.Latency)
+	}
+}
+
+func TestCheckProxy_ChainUnreachableHop(t *testing.T) {
+	entry, _ := startSOCKS5Server(t, "", "", 0x00)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	dead := ln.Addr().String()
+	ln.Close()
+
+	target := ProxyTarget{Address: entry, Protocol: "socks5", Chain: []ProxyTarget{{Address: dead, Protocol: "http"}}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := CheckProxy(ctx, target, "http://127.0.0.1:1/", nil)
+	if result.Status {
+		t.Fatal("expected the chain to fail")
+	}
+	if !strings.Contains(result.Error, "hop 2 ("+dead+")") {
+		t.Errorf("expected the error to name the second hop, got %q", result.Error)
+	}
+}
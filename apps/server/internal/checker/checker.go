@@ -2,23 +2,19 @@ package checker
 
 import (
 	"context"
-	"errors"
+	"crypto/x509"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
-	"regexp"
 	"strings"
 	"sync"
 	"time"
 
-	"golang.org/x/net/proxy"
-
 	"socksproxies.com/server/internal/geoip"
 )
 
-var ipRegex = regexp.MustCompile(`(?:\d{1,3}\.){3}\d{1,3}`)
-
 // Performance: HTTP client pool to reduce allocations
 var clientPool = sync.Pool{
 	New: func() interface{} {
@@ -31,30 +27,126 @@ var clientPool = sync.Pool{
 // Performance: Buffer pool for response reading
 var bufPool = sync.Pool{
 	New: func() interface{} {
-		buf := make([]byte, 256)
+		buf := make([]byte, judgeBodyLimit)
 		return &buf
 	},
 }
 
+// CheckOptions controls how CheckProxyWithOptions verifies a proxy.
+type CheckOptions struct {
+	// JudgeURL is used when no judge pool is configured.
+	JudgeURL string
+	// Judges rotates checks across several judges with failover.
+	Judges *JudgePool
+	// TLSJudgeURL is an https judge used to test CONNECT tunnelling through
+	// HTTP proxies. Leave empty to skip the tunnel check.
+	TLSJudgeURL string
+	// TLSRootCAs overrides the system roots when verifying the TLS judge.
+	TLSRootCAs *x509.CertPool
+	// ThroughputURL and ThroughputBytes enable the optional download test
+	// once the proxy has passed the judge check.
+	ThroughputURL   string
+	ThroughputBytes int64
+	// IPv4JudgeURL and IPv6JudgeURL point at single-stack judges used to
+	// find out whether the proxy exits over IPv4, IPv6 or both.
+	IPv4JudgeURL string
+	IPv6JudgeURL string
+	// DNSProbe enables the DNS resolution and leak test.
+	DNSProbe *DNSProbe
+	// Resolver is used wherever names are resolved on the checker's side
+	// (socks4 destinations, socks5 ones with LocalDNS, the DNS probe
+	// baseline). Nil means the system resolver.
+	Resolver *net.Resolver
+	// LocalDNS has socks5 proxies sent resolved addresses instead of names,
+	// to compare against remote resolution. Off by default.
+	LocalDNS bool
+	// Targets are extra sites visited through the proxy once it has passed
+	// the judge check, each reported against its own expectations.
+	Targets []TargetCheck
+	// FixtureURL and TLSFixtureURL enable the tamper test: the fixture page
+	// is fetched through the proxy and compared with the direct response.
+	// TLSRootCAs also applies to the direct TLS fetch.
+	FixtureURL    string
+	TLSFixtureURL string
+	// Sampling queries the judge several times and classifies the proxy by
+	// its success ratio. The zero value makes a single attempt.
+	Sampling SamplePolicy
+	Geo      *geoip.Reader
+	// ASNClasses classifies the ASNs Geo reports as hosting, isp or mobile.
+	ASNClasses *geoip.ASNClassifier
+}
+
 func CheckProxy(ctx context.Context, target ProxyTarget, judgeURL string, geo *geoip.Reader) ProxyResult {
-	start := time.Now()
-	result := ProxyResult{
+	return CheckProxyWithOptions(ctx, target, CheckOptions{JudgeURL: judgeURL, Geo: geo})
+}
+
+func CheckProxyWithOptions(ctx context.Context, target ProxyTarget, opts CheckOptions) (result ProxyResult) {
+	result = ProxyResult{
 		Protocol: strings.ToLower(target.Protocol),
 		Status:   false,
 	}
+	if opts.LocalDNS {
+		target = target.withLocalDNS()
+	}
 
 	host, port, err := net.SplitHostPort(target.Address)
 	if err == nil {
 		result.IP = host
 		result.Port = port
+		result.IPVersion = ipVersion(host)
 	}
 
-	transport, err := buildTransport(target)
+	judge, err := opts.firstJudge()
 	if err != nil {
 		result.Error = err.Error()
 		return result.WithCheckedAt()
 	}
 
+	if len(target.Chain) > 0 {
+		for _, hop := range target.hops() {
+			if strings.EqualFold(hop.Protocol, ProtocolAuto) {
+				result.Error = "protocol detection is not supported for proxy chains"
+				return result.WithCheckedAt()
+			}
+		}
+	}
+
+	if result.Protocol == ProtocolAuto {
+		result.Protocols = DetectProtocols(ctx, target, judge.URL)
+		target.Protocol = preferredProtocol(result.Protocols)
+		if target.Protocol == "" {
+			result.Error = "no supported proxy protocol detected"
+			return result.WithCheckedAt()
+		}
+		result.Protocol = target.Protocol
+	}
+
+	transport, err := buildTransport(target, opts.Resolver)
+	if err != nil {
+		result.Error = err.Error()
+		return result.WithCheckedAt()
+	}
+
+	// The CONNECT probe runs alongside the plain request so it adds no wall
+	// time to the check.
+	var tunnel chan tunnelResult
+	if isHTTPProxy(result.Protocol) && len(target.Chain) == 0 && opts.TLSJudgeURL != "" {
+		tunnel = make(chan tunnelResult, 1)
+		go func() {
+			tunnel <- checkConnectTunnel(ctx, target, opts.TLSJudgeURL, opts.TLSRootCAs)
+		}()
+	}
+	defer func() {
+		if tunnel == nil {
+			return
+		}
+		res := <-tunnel
+		res.apply(&result)
+		if res.err != nil {
+			result.TLSError = res.err.Error()
+		}
+	}()
+
 	// Performance: Get client from pool and set transport
 	client := clientPool.Get().(*http.Client)
 	client.Transport = transport
@@ -65,16 +157,154 @@ func CheckProxy(ctx context.Context, target ProxyTarget, judgeURL string, geo *g
 		clientPool.Put(client)
 	}()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, judgeURL, nil)
+	// With several samples the first successful attempt supplies the exit
+	// address and phases; the rest only contribute to the statistics. Each
+	// attempt dials the proxy afresh, so a sample covers the connection too.
+	var (
+		obs       judgeObservation
+		latencies []time.Duration
+		attempts  int
+	)
+	for samples := opts.Sampling.samples(); attempts < samples; {
+		if attempts > 0 {
+			transport.CloseIdleConnections()
+			if !sleepContext(ctx, opts.Sampling.backoff(attempts)) {
+				break
+			}
+		}
+		attempts++
+		used, o, e := queryJudgeWithFallback(ctx, client, judge, opts.Judges)
+		if e != nil {
+			if len(latencies) == 0 {
+				obs, err = o, e
+			}
+			continue
+		}
+		if len(latencies) == 0 {
+			judge, obs, err = used, o, nil
+		}
+		latencies = append(latencies, o.latency)
+	}
+	if opts.Sampling.samples() > 1 {
+		result.Sampling = opts.Sampling.stats(attempts, latencies)
+	}
+	result.Phases = obs.phases
+	if len(target.Chain) > 0 {
+		result.Hops = hopResults(target.hops(), obs.hops)
+	}
 	if err != nil {
 		result.Error = err.Error()
 		return result.WithCheckedAt()
 	}
+	if result.Sampling != nil && result.Sampling.Verdict == VerdictDead {
+		result.Error = fmt.Sprintf("only %d of %d attempts succeeded", result.Sampling.Successes, result.Sampling.Attempts)
+		return result.WithCheckedAt()
+	}
+
+	result.Status = true
+	result.Latency = obs.latency.Milliseconds()
+	if result.Sampling != nil {
+		result.Latency = result.Sampling.MedianMS
+	}
+
+	if obs.response.IP != "" {
+		result.ExitIP = obs.response.IP
+		result.Anonymity, result.Anon = classifyAnonymity(obs.response, obs.structured, origins.lookup(ctx, judge))
+		if result.IP == "" {
+			result.IP = obs.response.IP
+		}
+	}
+
+	if opts.IPv4JudgeURL != "" || opts.IPv6JudgeURL != "" {
+		result.applyEgress(detectEgress(ctx, client, opts.IPv4JudgeURL, opts.IPv6JudgeURL))
+	}
+
+	if opts.DNSProbe != nil {
+		resolver := opts.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		result.DNS = checkDNS(ctx, target, opts.DNSProbe, resolver)
+	}
+
+	if opts.ThroughputURL != "" && opts.ThroughputBytes > 0 {
+		result.Throughput = measureThroughput(ctx, client, opts.ThroughputURL, opts.ThroughputBytes)
+	}
+
+	if len(opts.Targets) > 0 {
+		result.Targets = checkTargets(ctx, client, opts.Targets)
+	}
+
+	if opts.FixtureURL != "" || opts.TLSFixtureURL != "" {
+		result.Tamper = checkTamper(ctx, client, target, opts.Resolver, opts.FixtureURL, opts.TLSFixtureURL, opts.TLSRootCAs)
+	}
+
+	result.applyGeo(opts.Geo, opts.ASNClasses)
+
+	return result.WithCheckedAt()
+}
+
+func (o CheckOptions) firstJudge() (Judge, error) {
+	if o.Judges.Len() > 0 {
+		judge, _ := o.Judges.Pick("")
+		return judge, nil
+	}
+	if o.JudgeURL == "" {
+		return Judge{}, errNoJudges
+	}
+	// A single configured URL keeps the historical behaviour: whatever it
+	// returns is parsed automatically.
+	return Judge{URL: o.JudgeURL, Format: JudgeFormatAuto, Name: judgeName(o.JudgeURL)}, nil
+}
+
+type judgeObservation struct {
+	response   JudgeResponse
+	structured bool
+	latency    time.Duration
+	phases     *PhaseTimings
+	// hops holds per-hop latencies when the proxy is a chain.
+	hops []int64
+}
+
+// queryJudgeWithFallback queries judge and, in consensus mode, a second
+// judge when the first fails. It returns the judge that answered.
+func queryJudgeWithFallback(ctx context.Context, client *http.Client, judge Judge, judges *JudgePool) (Judge, judgeObservation, error) {
+	obs, err := queryJudge(ctx, client, judge)
+	if err != nil && judges.Consensus() && ctx.Err() == nil {
+		// A single failing judge must not condemn the proxy: ask another one
+		// and blame the first judge if the second gets through.
+		if second, ok := judges.Pick(judge.URL); ok {
+			if obs2, err2 := queryJudge(ctx, client, second); err2 == nil {
+				judges.ReportFailure(judge.URL, err)
+				return second, obs2, nil
+			}
+		}
+	}
+	return judge, obs, err
+}
+
+// queryJudge fetches a judge through the proxy client. Transport errors,
+// non-2xx answers and bodies without an address all count as failures.
+func queryJudge(ctx context.Context, client *http.Client, judge Judge) (obs judgeObservation, err error) {
+	defer func() {
+		recordJudgeRequest(judge.Name, err == nil)
+	}()
+
+	traceCtx, phases := withPhaseTrace(ctx)
+	defer func() {
+		obs.phases = phases.timings()
+		obs.hops = phases.hopLatencies(MaxChainHops)
+	}()
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(traceCtx, http.MethodGet, judge.URL, nil)
+	if err != nil {
+		return obs, err
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		result.Error = err.Error()
-		return result.WithCheckedAt()
+		return obs, err
 	}
 	defer resp.Body.Close()
 
@@ -83,65 +313,46 @@ func CheckProxy(ctx context.Context, target ProxyTarget, judgeURL string, geo *g
 	buf := *bufPtr
 	defer bufPool.Put(bufPtr)
 
-	n, _ := io.ReadFull(io.LimitReader(resp.Body, 256), buf)
-	body := string(buf[:n])
+	n, _ := io.ReadFull(io.LimitReader(resp.Body, judgeBodyLimit), buf)
+	obs.latency = time.Since(start)
 
-	result.Status = resp.StatusCode >= 200 && resp.StatusCode < 300
-	result.Latency = time.Since(start).Milliseconds()
-
-	foundIP := ipRegex.FindString(body)
-	if foundIP != "" {
-		result.Anonymity = classifyAnonymity(foundIP, result.IP)
-		if result.IP == "" {
-			result.IP = foundIP
-		}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return obs, fmt.Errorf("judge returned status %d", resp.StatusCode)
 	}
 
-	if geo != nil && result.IP != "" {
-		result.Country = geo.LookupCountry(result.IP)
+	obs.response, obs.structured = judge.Parse(buf[:n])
+	if obs.response.IP == "" && judge.Format != JudgeFormatAuto {
+		return obs, errJudgeNoIP
 	}
+	return obs, nil
+}
 
-	return result.WithCheckedAt()
+func judgeName(rawURL string) string {
+	if parsed, err := url.Parse(rawURL); err == nil && parsed.Host != "" {
+		return parsed.Host
+	}
+	return "unknown"
 }
 
-func buildTransport(target ProxyTarget) (*http.Transport, error) {
+// buildTransport returns a transport that sends requests through the proxy.
+// resolver is used by protocols that resolve destination names locally (nil
+// means the system resolver).
+func buildTransport(target ProxyTarget, resolver *net.Resolver) (*http.Transport, error) {
 	dialer := &net.Dialer{
 		Timeout:   5 * time.Second,
 		KeepAlive: 30 * time.Second,
 	}
 
-	protocol := strings.ToLower(target.Protocol)
-	switch protocol {
-	case "socks5", "socks":
-		auth := &proxy.Auth{}
-		if target.Username != "" || target.Password != "" {
-			auth.User = target.Username
-			auth.Password = target.Password
-		} else {
-			auth = nil
-		}
-
-		socksDialer, err := proxy.SOCKS5("tcp", target.Address, auth, dialer)
+	if len(target.Chain) > 0 {
+		// Every hop, HTTP ones included, is driven as a tunnel.
+		dial, err := proxyDialFunc(target, resolver, dialer)
 		if err != nil {
 			return nil, err
 		}
+		return dialTransport(dial), nil
+	}
 
-		// Use ContextDialer to properly propagate context for cancellation
-		contextDialer, ok := socksDialer.(proxy.ContextDialer)
-		if !ok {
-			return nil, errors.New("SOCKS5 dialer does not support context")
-		}
-
-		return &http.Transport{
-			DialContext:           contextDialer.DialContext,
-			TLSHandshakeTimeout:   5 * time.Second,
-			MaxIdleConns:          100,
-			MaxIdleConnsPerHost:   10,
-			IdleConnTimeout:       90 * time.Second,
-			DisableCompression:    true,
-			ForceAttemptHTTP2:     false,
-		}, nil
-	case "http", "https":
+	if isHTTPProxy(strings.ToLower(target.Protocol)) {
 		proxyURL := &url.URL{Scheme: "http", Host: target.Address}
 		if target.Username != "" || target.Password != "" {
 			proxyURL.User = url.UserPassword(target.Username, target.Password)
@@ -149,6 +360,10 @@ func buildTransport(target ProxyTarget) (*http.Transport, error) {
 
 		return &http.Transport{
 			Proxy:                  http.ProxyURL(proxyURL),
+			OnProxyConnectResponse: func(ctx context.Context, _ *url.URL, _ *http.Request, _ *http.Response) error {
+				phasesFrom(ctx).markTunnelEstablished()
+				return nil
+			},
 			DialContext:            dialer.DialContext,
 			TLSHandshakeTimeout:    5 * time.Second,
 			MaxIdleConns:           100,
@@ -157,19 +372,26 @@ func buildTransport(target ProxyTarget) (*http.Transport, error) {
 			DisableCompression:     true,
 			ForceAttemptHTTP2:      false,
 		}, nil
-	default:
-		return nil, errors.New("unsupported proxy protocol")
 	}
-}
 
-func classifyAnonymity(exitIP string, proxyIP string) string {
-	if exitIP == "" {
-		return "unknown"
+	// Everything else goes through the dialer registered for the protocol.
+	dial, err := protocolDialFunc(target, resolver, dialer)
+	if err != nil {
+		return nil, err
 	}
+	return dialTransport(dial), nil
+}
 
-	if proxyIP != "" && exitIP == proxyIP {
-		return "anonymous"
-	}
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
 
-	return "unknown"
+func dialTransport(dial dialFunc) *http.Transport {
+	return &http.Transport{
+		DialContext:         dial,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+		DisableCompression:  true,
+		ForceAttemptHTTP2:   false,
+	}
 }
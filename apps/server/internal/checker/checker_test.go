@@ -9,37 +9,59 @@ import (
 )
 
 func TestClassifyAnonymity(t *testing.T) {
+	origin := []string{"9.9.9.9"}
 	cases := []struct {
-		name     string
-		exitIP   string
-		proxyIP  string
-		expected string
+		name       string
+		judge      JudgeResponse
+		structured bool
+		expected   string
+		level      int
 	}{
-		{"same_ip_anonymous", "1.1.1.1", "1.1.1.1", "anonymous"},
-		{"different_ip_unknown", "2.2.2.2", "1.1.1.1", "unknown"},
-		{"empty_exit_ip", "", "1.1.1.1", "unknown"},
-		{"empty_proxy_ip", "1.1.1.1", "", "unknown"},
-		{"both_empty", "", "", "unknown"},
+		{"empty_exit_ip", JudgeResponse{}, true, "unknown", AnonUnknown},
+		{"exit_is_origin", JudgeResponse{IP: "9.9.9.9"}, false, "transparent", AnonTransparent},
+		{"origin_in_forwarded_for", JudgeResponse{IP: "1.1.1.1", Headers: map[string]string{"X-Forwarded-For": "9.9.9.9"}}, true, "transparent", AnonTransparent},
+		{"foreign_ip_in_header", JudgeResponse{IP: "1.1.1.1", Headers: map[string]string{"X-Forwarded-For": "10.0.0.7"}}, true, "anonymous", AnonDistorting},
+		{"via_header_only", JudgeResponse{IP: "1.1.1.1", Headers: map[string]string{"Via": "1.1 squid"}}, true, "anonymous", AnonAnonymous},
+		{"exit_ip_only_in_header", JudgeResponse{IP: "1.1.1.1", Headers: map[string]string{"X-Real-IP": "1.1.1.1"}}, true, "anonymous", AnonAnonymous},
+		{"no_headers_elite", JudgeResponse{IP: "1.1.1.1", Headers: map[string]string{}}, true, "elite", AnonElite},
+		{"plain_text_judge", JudgeResponse{IP: "1.1.1.1"}, false, "anonymous", AnonDistorting},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			result := classifyAnonymity(tc.exitIP, tc.proxyIP)
-			if result != tc.expected {
-				t.Errorf("classifyAnonymity(%q, %q) = %q, expected %q",
-					tc.exitIP, tc.proxyIP, result, tc.expected)
+			label, level := classifyAnonymity(tc.judge, tc.structured, origin)
+			if label != tc.expected || level != tc.level {
+				t.Errorf("classifyAnonymity(%+v) = (%q, %d), expected (%q, %d)",
+					tc.judge, label, level, tc.expected, tc.level)
 			}
 		})
 	}
 }
 
+func TestParseJudgeBody(t *testing.T) {
+	judge, structured := parseJudgeBody([]byte(`{"ip":"1.2.3.4","headers":{"Via":"1.1 proxy"}}`))
+	if !structured || judge.IP != "1.2.3.4" || judge.Headers["Via"] != "1.1 proxy" {
+		t.Errorf("unexpected structured parse: %+v structured=%v", judge, structured)
+	}
+
+	judge, structured = parseJudgeBody([]byte(`{"ip":"1.2.3.4","headers":{}}`))
+	if !structured || len(judge.Headers) != 0 {
+		t.Errorf("expected empty header echo to count as structured, got %+v structured=%v", judge, structured)
+	}
+
+	judge, structured = parseJudgeBody([]byte("5.6.7.8\n"))
+	if structured || judge.IP != "5.6.7.8" {
+		t.Errorf("unexpected plain parse: %+v structured=%v", judge, structured)
+	}
+}
+
 func TestBuildTransport_HTTP(t *testing.T) {
 	target := ProxyTarget{
 		Address:  "127.0.0.1:8080",
 		Protocol: "http",
 	}
 
-	transport, err := buildTransport(target)
+	transport, err := buildTransport(target, nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -59,7 +81,7 @@ func TestBuildTransport_HTTPWithAuth(t *testing.T) {
 		Password: "pass",
 	}
 
-	transport, err := buildTransport(target)
+	transport, err := buildTransport(target, nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -74,7 +96,7 @@ func TestBuildTransport_SOCKS5(t *testing.T) {
 		Protocol: "socks5",
 	}
 
-	transport, err := buildTransport(target)
+	transport, err := buildTransport(target, nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -94,7 +116,7 @@ func TestBuildTransport_SOCKS5WithAuth(t *testing.T) {
 		Password: "pass",
 	}
 
-	transport, err := buildTransport(target)
+	transport, err := buildTransport(target, nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -109,7 +131,7 @@ func TestBuildTransport_SOCKS(t *testing.T) {
 		Protocol: "socks",
 	}
 
-	transport, err := buildTransport(target)
+	transport, err := buildTransport(target, nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -124,7 +146,7 @@ func TestBuildTransport_UnsupportedProtocol(t *testing.T) {
 		Protocol: "ftp",
 	}
 
-	_, err := buildTransport(target)
+	_, err := buildTransport(target, nil)
 	if err == nil {
 		t.Error("expected error for unsupported protocol")
 	}
@@ -142,7 +164,7 @@ func TestBuildTransport_CaseInsensitive(t *testing.T) {
 			Protocol: proto,
 		}
 
-		transport, err := buildTransport(target)
+		transport, err := buildTransport(target, nil)
 		if err != nil {
 			t.Errorf("unexpected error for protocol %s: %v", proto, err)
 		}
@@ -205,23 +227,23 @@ func TestCheckProxy_IPExtraction(t *testing.T) {
 	defer server.Close()
 
 	// We can't actually test through a proxy without one, but we can test the IP extraction
-	// by examining the regex
+	// helper directly
 	body := "Your IP address is 1.2.3.4 and more text"
-	found := ipRegex.FindString(body)
+	found := findIP(body)
 	if found != "1.2.3.4" {
 		t.Errorf("expected IP 1.2.3.4, got %s", found)
 	}
 
 	// Test with multiple IPs - should return first
 	body = "Origin: 10.0.0.1, X-Forwarded-For: 192.168.1.1"
-	found = ipRegex.FindString(body)
+	found = findIP(body)
 	if found != "10.0.0.1" {
 		t.Errorf("expected first IP 10.0.0.1, got %s", found)
 	}
 
 	// Test with no IP
 	body = "No IP here"
-	found = ipRegex.FindString(body)
+	found = findIP(body)
 	if found != "" {
 		t.Errorf("expected empty string, got %s", found)
 	}
@@ -256,18 +278,21 @@ func TestProxyResult_WithCheckedAt(t *testing.T) {
 	}
 }
 
-func TestIPRegex(t *testing.T) {
+func TestFindIP(t *testing.T) {
 	validIPs := []string{
 		"1.1.1.1",
 		"192.168.0.1",
 		"10.0.0.1",
 		"255.255.255.255",
 		"0.0.0.0",
+		"2001:db8::1",
+		"::1",
+		"fe80::1",
 	}
 
 	for _, ip := range validIPs {
-		if !ipRegex.MatchString(ip) {
-			t.Errorf("expected %s to match IP regex", ip)
+		if got := findIP(ip); got != ip {
+			t.Errorf("expected %s to be found, got %q", ip, got)
 		}
 	}
 
@@ -276,11 +301,54 @@ func TestIPRegex(t *testing.T) {
 		"1.2.3",
 		"1.2.3.4.5",
 		"a.b.c.d",
+		"256.1.1.1",
+		"12:30:45",
+		"::",
 	}
 
 	for _, input := range invalidInputs {
-		if ipRegex.MatchString(input) && ipRegex.FindString(input) == input {
-			t.Errorf("expected %s not to fully match IP regex", input)
+		if got := findIP(input); got != "" {
+			t.Errorf("expected no address in %q, got %q", input, got)
+		}
+	}
+
+	extracted := []struct {
+		body string
+		want string
+	}{
+		{"Your IP: 2001:DB8:0:0::1.", "2001:db8::1"},
+		{"origin=[2001:db8::2]:443", "2001:db8::2"},
+		{"IP:203.0.113.9", "203.0.113.9"},
+		{"client 198.51.100.7:5555 connected", "198.51.100.7"},
+		{"mapped ::ffff:192.0.2.1", "192.0.2.1"},
+		{"zone fe80::1%eth0", "fe80::1"},
+	}
+	for _, tc := range extracted {
+		if got := findIP(tc.body); got != tc.want {
+			t.Errorf("findIP(%q) = %q, want %q", tc.body, got, tc.want)
+		}
+	}
+
+	if got := findIPs("2001:db8::1, 10.0.0.1, 2001:db8::2", -1); len(got) != 3 {
+		t.Errorf("expected three addresses, got %v", got)
+	}
+}
+
+func TestApplyEgress(t *testing.T) {
+	cases := []struct {
+		exit, v4, v6 string
+		want         string
+	}{
+		{"203.0.113.1", "", "", EgressIPv4},
+		{"203.0.113.1", "", "2001:db8::1", EgressDual},
+		{"2001:db8::1", "", "", EgressIPv6},
+		{"", "", "", ""},
+	}
+	for _, tc := range cases {
+		result := ProxyResult{ExitIP: tc.exit}
+		result.applyEgress(tc.v4, tc.v6)
+		if result.Egress != tc.want {
+			t.Errorf("exit %q with v4 %q v6 %q: expected egress %q, got %q", tc.exit, tc.v4, tc.v6, tc.want, result.Egress)
 		}
 	}
 }
@@ -0,0 +1,236 @@
+package checker
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProtocolAuto asks the checker to work out which protocols a target speaks
+// before checking it.
+const ProtocolAuto = "auto"
+
+// detectTimeout bounds detection as a whole. The probes run at once, so a
+// pure HTTP proxy, which waits for a line ending the binary SOCKS greetings
+// never send, costs this once rather than per probe.
+const detectTimeout = 3 * time.Second
+
+// Protocol labels as used by ProxyListItem.Protocols.
+const (
+	LabelHTTP   = "HTTP"
+	LabelHTTPS  = "HTTPS"
+	LabelSOCKS4 = "SOCKS4"
+	LabelSOCKS5 = "SOCKS5"
+)
+
+// detectOrder lists the labels in the order ProxyListItem reports them.
+var detectOrder = []string{LabelHTTP, LabelHTTPS, LabelSOCKS4, LabelSOCKS5}
+
+// DetectProtocols probes target for SOCKS5, SOCKS4 and HTTP (CONNECT and
+// forwarding), concurrently and each over a fresh connection, and returns
+// every protocol that answered with a valid handshake. judgeURL supplies the
+// destination the probes ask for, so a plain web server is not mistaken for a
+// proxy and no proxy is asked to connect to itself.
+func DetectProtocols(ctx context.Context, target ProxyTarget, judgeURL string) []string {
+	ctx, cancel := context.WithTimeout(ctx, detectTimeout)
+	defer cancel()
+
+	probes := map[string]probeFunc{LabelSOCKS5: probeSOCKS5(target)}
+	judge, err := url.Parse(judgeURL)
+	if err == nil && judge.Hostname() != "" {
+		probes[LabelSOCKS4] = probeSOCKS4(judge)
+		probes[LabelHTTPS] = probeHTTPConnect(target, judge)
+		probes[LabelHTTP] = probeHTTPForward(target, judge)
+	}
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		found = make(map[string]bool, len(detectOrder))
+	)
+	for label, fn := range probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if probe(ctx, target, fn) {
+				mu.Lock()
+				found[label] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	protocols := make([]string, 0, len(found))
+	for _, label := range detectOrder {
+		if found[label] {
+			protocols = append(protocols, label)
+		}
+	}
+	return protocols
+}
+
+// preferredProtocol picks the protocol to run the actual check with: SOCKS
+// first since it also covers TLS targets, then HTTP.
+func preferredProtocol(protocols []string) string {
+	for _, label := range []string{LabelSOCKS5, LabelSOCKS4, LabelHTTPS, LabelHTTP} {
+		for _, p := range protocols {
+			if p != label {
+				continue
+			}
+			switch label {
+			case LabelSOCKS5:
+				return "socks5"
+			case LabelSOCKS4:
+				return "socks4"
+			default:
+				return "http"
+			}
+		}
+	}
+	return ""
+}
+
+type probeFunc func(conn net.Conn) bool
+
+func probe(ctx context.Context, target ProxyTarget, fn probeFunc) bool {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", target.Address)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	stop := watchConnContext(ctx, conn)
+	ok := fn(conn)
+	if stop() != nil {
+		return false
+	}
+	return ok
+}
+
+// probeSOCKS5 sends a method negotiation greeting. Any SOCKS5 reply counts,
+// including "no acceptable methods", because the endpoint does speak SOCKS5.
+func probeSOCKS5(target ProxyTarget) probeFunc {
+	return func(conn net.Conn) bool {
+		greeting := []byte{socks5Version, 1, socks5AuthNone}
+		if target.Username != "" || target.Password != "" {
+			greeting = []byte{socks5Version, 2, socks5AuthNone, socks5AuthPassword}
+		}
+		if _, err := conn.Write(greeting); err != nil {
+			return false
+		}
+		var reply [2]byte
+		if _, err := io.ReadFull(conn, reply[:]); err != nil {
+			return false
+		}
+		if reply[0] != socks5Version {
+			return false
+		}
+		switch reply[1] {
+		case socks5AuthNone, socks5AuthPassword, socks5AuthNoAccept:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// probeSOCKS4 asks for a connection to the judge, by address when the judge
+// URL holds an IPv4 literal and by SOCKS4a hostname otherwise. Granted or
+// rejected, a well-formed SOCKS4 reply identifies the protocol.
+func probeSOCKS4(judge *url.URL) probeFunc {
+	return func(conn net.Conn) bool {
+		port := judgePort(judge)
+		req := []byte{socks4Version, socks4CmdConnect, byte(port >> 8), byte(port)}
+		if ip := net.ParseIP(judge.Hostname()).To4(); ip != nil {
+			req = append(req, ip...)
+			req = append(req, 0)
+		} else {
+			req = append(req, 0, 0, 0, 1, 0)
+			req = append(req, judge.Hostname()...)
+			req = append(req, 0)
+		}
+		if _, err := conn.Write(req); err != nil {
+			return false
+		}
+		var reply [8]byte
+		if _, err := io.ReadFull(conn, reply[:]); err != nil {
+			return false
+		}
+		return reply[0] == 0x00 && reply[1] >= socks4Granted && reply[1] <= socks4IdentMismatch
+	}
+}
+
+func judgePort(judge *url.URL) int {
+	if port, err := strconv.Atoi(judge.Port()); err == nil {
+		return port
+	}
+	if judge.Scheme == "https" {
+		return 443
+	}
+	return 80
+}
+
+// probeHTTPConnect only accepts answers a web server would not give: a
+// successful CONNECT or a demand for proxy credentials.
+func probeHTTPConnect(target ProxyTarget, judge *url.URL) probeFunc {
+	return func(conn net.Conn) bool {
+		authority := net.JoinHostPort(judge.Hostname(), "443")
+		req := newConnectRequest(authority, target)
+		if err := req.Write(conn); err != nil {
+			return false
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusProxyAuthRequired
+	}
+}
+
+// probeHTTPForward requests the judge by absolute URL. Web servers often
+// answer such requests for their default site, so a 2xx must carry a judge
+// answer and a redirect must point back at the judge host.
+func probeHTTPForward(target ProxyTarget, judge *url.URL) probeFunc {
+	return func(conn net.Conn) bool {
+		plain := *judge
+		plain.Scheme = "http"
+		req, err := http.NewRequest(http.MethodGet, plain.String(), nil)
+		if err != nil {
+			return false
+		}
+		req.Close = true
+		setProxyAuth(req, target)
+		if err := req.WriteProxy(conn); err != nil {
+			return false
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusProxyAuthRequired:
+			return true
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, judgeBodyLimit))
+			parsed, _ := parseJudgeBody(body)
+			return parsed.IP != ""
+		case resp.StatusCode >= 300 && resp.StatusCode < 400:
+			location, err := resp.Location()
+			return err == nil && strings.EqualFold(location.Hostname(), judge.Hostname())
+		default:
+			return false
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package checker
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDetectProtocols(t *testing.T) {
+	judge, _ := tlsJudge(t)
+	judgeAddr := judge.Listener.Addr().String()
+
+	socks5Addr, _ := startSOCKS5Server(t, "", "", 0x00)
+	socks4Addr, _ := startSOCKS4Server(t, socks4Granted)
+	httpAddr := startHTTPProxy(t, true, judgeAddr)
+	forwardOnlyAddr := startHTTPProxy(t, false, "")
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer closed.Close()
+	go func() {
+		for {
+			conn, err := closed.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	cases := []struct {
+		name     string
+		addr     string
+		expected []string
+	}{
+		{"socks5", socks5Addr, []string{LabelSOCKS5}},
+		{"socks4", socks4Addr, []string{LabelSOCKS4}},
+		{"http_connect_and_forward", httpAddr, []string{LabelHTTP, LabelHTTPS}},
+		{"http_forward_only", forwardOnlyAddr, []string{LabelHTTP}},
+		{"not_a_proxy", closed.Addr().String(), []string{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			got := DetectProtocols(ctx, ProxyTarget{Address: tc.addr}, "https://judge.invalid/api/judge")
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("DetectProtocols() = %v, expected %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestDetectProtocols_SOCKS4ProbesJudge(t *testing.T) {
+	addr, requests := startSOCKS4Server(t, socks4Rejected)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	got := DetectProtocols(ctx, ProxyTarget{Address: addr}, "http://judge.test:8080/api/judge")
+	if !reflect.DeepEqual(got, []string{LabelSOCKS4}) {
+		t.Fatalf("DetectProtocols() = %v, expected a rejected SOCKS4 request to count", got)
+	}
+
+	req := <-requests
+	if req.host != "judge.test" || req.port != 8080 {
+		t.Errorf("expected the probe to ask for the judge, got %+v", req)
+	}
+}
+
+func TestPreferredProtocol(t *testing.T) {
+	cases := []struct {
+		protocols []string
+		expected  string
+	}{
+		{[]string{LabelHTTP, LabelHTTPS, LabelSOCKS5}, "socks5"},
+		{[]string{LabelHTTP, LabelSOCKS4}, "socks4"},
+		{[]string{LabelHTTP}, "http"},
+		{nil, ""},
+	}
+	for _, tc := range cases {
+		if got := preferredProtocol(tc.protocols); got != tc.expected {
+			t.Errorf("preferredProtocol(%v) = %q, expected %q", tc.protocols, got, tc.expected)
+		}
+	}
+}
+
+func TestCheckProxyWithOptions_AutoProtocol(t *testing.T) {
+	proxyAddr := startHTTPProxy(t, false, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result := CheckProxyWithOptions(ctx, ProxyTarget{Address: proxyAddr, Protocol: "auto"}, CheckOptions{
+		JudgeURL: "http://judge.invalid/",
+	})
+	if !result.Status {
+		t.Fatalf("expected auto check to succeed, got %q", result.Error)
+	}
+	if result.Protocol != "http" {
+		t.Errorf("expected detected protocol http, got %q", result.Protocol)
+	}
+	if !reflect.DeepEqual(result.Protocols, []string{LabelHTTP}) {
+		t.Errorf("unexpected protocol list %v", result.Protocols)
+	}
+}
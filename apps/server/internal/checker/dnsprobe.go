@@ -0,0 +1,313 @@
+package checker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// dnsProbeTTL keeps per-name query logs long enough for slow recursive
+	// resolvers to show up, without letting abandoned names pile up.
+	dnsProbeTTL = 2 * time.Minute
+	// dnsLocalTTL is how long the checker's own resolver addresses are
+	// trusted before being looked up again.
+	dnsLocalTTL = 10 * time.Minute
+)
+
+// DNS modes reported in DNSResult.
+const (
+	DNSModeRemote = "remote"
+	DNSModeLocal  = "local"
+)
+
+// DNSResult reports who resolved a unique test name during a check.
+type DNSResult struct {
+	// Mode is how the protocol resolves names: remote (socks5h, socks4a,
+	// HTTP) or local (socks5, socks4).
+	Mode string `json:"mode"`
+	// RemoteResolved is true when the proxy resolved the name itself and
+	// connected to the address it got back.
+	RemoteResolved bool `json:"remote_resolved"`
+	// Leak is true when the checker's own resolver asked for the name, i.e.
+	// the lookup happened on the client side of the proxy.
+	Leak bool `json:"leak"`
+	// Resolvers are the addresses that queried the authoritative server.
+	Resolvers []string `json:"resolvers,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+type dnsQueryLog struct {
+	sources []string
+	created time.Time
+}
+
+// DNSProbe is a minimal authoritative server for a test zone. Every check
+// resolves a fresh random name under the zone, so the source addresses of the
+// queries for that name tell exactly which resolvers were involved. The zone
+// must be delegated to the probe's listen address for proxies' resolvers to
+// reach it.
+type DNSProbe struct {
+	zone   string
+	target netip.AddrPort
+	conn   net.PacketConn
+
+	mu      sync.Mutex
+	queries map[string]*dnsQueryLog
+
+	localMu      sync.Mutex
+	localSources []string
+	localFetched time.Time
+}
+
+// NewDNSProbe listens on listenAddr (UDP) and answers for zone. target is the
+// "ip:port" that test names resolve to; it must accept TCP connections so a
+// proxy that resolved the name can be seen connecting.
+func NewDNSProbe(listenAddr, zone, target string) (*DNSProbe, error) {
+	zone = strings.ToLower(strings.Trim(strings.TrimSpace(zone), "."))
+	if zone == "" {
+		return nil, errors.New("dns probe: zone is required")
+	}
+	addrPort, err := netip.ParseAddrPort(target)
+	if err != nil {
+		return nil, fmt.Errorf("dns probe: invalid target %q: %w", target, err)
+	}
+	conn, err := net.ListenPacket("udp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("dns probe: listen: %w", err)
+	}
+	return &DNSProbe{
+		zone:    zone + ".",
+		target:  addrPort,
+		conn:    conn,
+		queries: make(map[string]*dnsQueryLog),
+	}, nil
+}
+
+// Addr is the address the probe listens on.
+func (p *DNSProbe) Addr() net.Addr {
+	return p.conn.LocalAddr()
+}
+
+// Serve answers queries until ctx is cancelled or the probe is closed.
+func (p *DNSProbe) Serve(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		p.conn.Close()
+	}()
+
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := p.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if reply := p.handle(buf[:n], addr); reply != nil {
+			_, _ = p.conn.WriteTo(reply, addr)
+		}
+	}
+}
+
+// Close stops the probe.
+func (p *DNSProbe) Close() error {
+	return p.conn.Close()
+}
+
+func (p *DNSProbe) handle(packet []byte, from net.Addr) []byte {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(packet)
+	if err != nil || header.Response {
+		return nil
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return nil
+	}
+
+	name := strings.ToLower(question.Name.String())
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 header.ID,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   header.RecursionDesired,
+			RCode:              dnsmessage.RCodeSuccess,
+			OpCode:             header.OpCode,
+			RecursionAvailable: false,
+		},
+		Questions: []dnsmessage.Question{question},
+	}
+
+	if name != p.zone && !strings.HasSuffix(name, "."+p.zone) {
+		resp.Header.RCode = dnsmessage.RCodeRefused
+		resp.Header.Authoritative = false
+	} else {
+		if label, ok := strings.CutSuffix(name, "."+p.zone); ok {
+			p.record(label, from)
+		}
+		resp.Answers = p.answers(question)
+	}
+
+	out, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func (p *DNSProbe) answers(q dnsmessage.Question) []dnsmessage.Resource {
+	header := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 0}
+	addr := p.target.Addr()
+	switch {
+	case q.Type == dnsmessage.TypeA && addr.Is4():
+		header.Type = dnsmessage.TypeA
+		return []dnsmessage.Resource{{Header: header, Body: &dnsmessage.AResource{A: addr.As4()}}}
+	case q.Type == dnsmessage.TypeAAAA && addr.Is6():
+		header.Type = dnsmessage.TypeAAAA
+		return []dnsmessage.Resource{{Header: header, Body: &dnsmessage.AAAAResource{AAAA: addr.As16()}}}
+	default:
+		return nil
+	}
+}
+
+func (p *DNSProbe) record(label string, from net.Addr) {
+	source := from.String()
+	if host, _, err := net.SplitHostPort(source); err == nil {
+		source = host
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry, ok := p.queries[label]
+	if !ok {
+		// Only names handed out by newName are tracked.
+		return
+	}
+	for _, existing := range entry.sources {
+		if existing == source {
+			return
+		}
+	}
+	entry.sources = append(entry.sources, source)
+}
+
+// newName returns a fresh name under the zone and starts logging queries for
+// it.
+func (p *DNSProbe) newName() string {
+	var raw [8]byte
+	_, _ = rand.Read(raw[:])
+	label := hex.EncodeToString(raw[:])
+
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, entry := range p.queries {
+		if now.Sub(entry.created) > dnsProbeTTL {
+			delete(p.queries, key)
+		}
+	}
+	p.queries[label] = &dnsQueryLog{created: now}
+	return label + "." + strings.TrimSuffix(p.zone, ".")
+}
+
+// take returns the resolvers that asked for name and forgets it.
+func (p *DNSProbe) take(name string) []string {
+	label, _, _ := strings.Cut(strings.ToLower(name), ".")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry, ok := p.queries[label]
+	if !ok {
+		return nil
+	}
+	delete(p.queries, label)
+	return entry.sources
+}
+
+// localResolvers learns which addresses the checker's own resolver queries
+// the zone from, by resolving a fresh name without any proxy.
+func (p *DNSProbe) localResolvers(ctx context.Context, resolver *net.Resolver) []string {
+	p.localMu.Lock()
+	defer p.localMu.Unlock()
+	if !p.localFetched.IsZero() && time.Since(p.localFetched) < dnsLocalTTL {
+		return p.localSources
+	}
+
+	name := p.newName()
+	_, err := resolver.LookupIPAddr(ctx, name)
+	sources := p.take(name)
+	p.localFetched = time.Now()
+	if err == nil && len(sources) > 0 {
+		p.localSources = sources
+	}
+	return p.localSources
+}
+
+// remoteDNS reports whether the hop hands hostnames to the proxy.
+func remoteDNS(hop ProxyTarget) bool {
+	switch strings.ToLower(hop.Protocol) {
+	case "socks4":
+		return false
+	case "socks5", "socks":
+		return !hop.localDNS
+	default:
+		return true
+	}
+}
+
+// checkDNS connects through the proxy to a fresh test name and inspects which
+// resolvers asked the probe for it.
+func checkDNS(ctx context.Context, target ProxyTarget, probe *DNSProbe, resolver *net.Resolver) *DNSResult {
+	res := &DNSResult{Mode: DNSModeLocal}
+	// Only the exit of a chain resolves the destination.
+	if remoteDNS(target.exit()) {
+		res.Mode = DNSModeRemote
+	}
+
+	local := probe.localResolvers(ctx, resolver)
+
+	name := probe.newName()
+	address := net.JoinHostPort(name, fmt.Sprint(probe.target.Port()))
+	conn, err := dialThroughProxy(ctx, target, resolver, address)
+	if err == nil {
+		conn.Close()
+	} else {
+		res.Error = err.Error()
+	}
+	res.Resolvers = probe.take(name)
+
+	localSet := make(map[string]bool, len(local))
+	for _, ip := range local {
+		localSet[ip] = true
+	}
+	for _, ip := range res.Resolvers {
+		if localSet[ip] {
+			res.Leak = true
+		}
+	}
+	if res.Mode == DNSModeLocal {
+		// The dialer looked the name up itself; that is a leak even when the
+		// resolver's address could not be learnt.
+		res.Leak = true
+	}
+	res.RemoteResolved = res.Mode == DNSModeRemote && err == nil
+	return res
+}
+
+// dialThroughProxy opens a tunnel to address, which may be a hostname,
+// through the proxy.
+func dialThroughProxy(ctx context.Context, target ProxyTarget, resolver *net.Resolver, address string) (net.Conn, error) {
+	dial, err := proxyDialFunc(target, resolver, &net.Dialer{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return dial(ctx, "tcp", address)
+}
@@ -0,0 +1,126 @@
+package checker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// resolverFrom returns a resolver that queries the probe from a fixed source
+// address, standing in for a distinct recursive resolver.
+func resolverFrom(t *testing.T, probe *DNSProbe, source string) *net.Resolver {
+	t.Helper()
+	if conn, err := net.ListenPacket("udp", source+":0"); err != nil {
+		t.Skipf("cannot bind %s: %v", source, err)
+	} else {
+		conn.Close()
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			dialer := &net.Dialer{LocalAddr: &net.UDPAddr{IP: net.ParseIP(source)}}
+			return dialer.DialContext(ctx, "udp", probe.Addr().String())
+		},
+	}
+}
+
+func startDNSProbe(t *testing.T, target string) *DNSProbe {
+	t.Helper()
+	probe, err := NewDNSProbe("127.0.0.1:0", "dnstest.test.", target)
+	if err != nil {
+		t.Fatalf("start probe: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go probe.Serve(ctx)
+	return probe
+}
+
+func TestDNSProbe_AnswersZoneOnly(t *testing.T) {
+	probe := startDNSProbe(t, "192.0.2.10:443")
+	resolver := resolverFrom(t, probe, "127.0.0.1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	name := probe.newName()
+	addrs, err := resolver.LookupHost(ctx, name)
+	if err != nil || len(addrs) != 1 || addrs[0] != "192.0.2.10" {
+		t.Fatalf("expected 192.0.2.10 for %s, got %v (%v)", name, addrs, err)
+	}
+	if sources := probe.take(name); len(sources) != 1 || sources[0] != "127.0.0.1" {
+		t.Errorf("expected query from 127.0.0.1, got %v", sources)
+	}
+
+	if _, err := resolver.LookupHost(ctx, "example.com"); err == nil {
+		t.Error("expected names outside the zone to be refused")
+	}
+}
+
+func TestCheckProxy_DNSLeak(t *testing.T) {
+	judge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("203.0.113.9"))
+	}))
+	defer judge.Close()
+
+	probe := startDNSProbe(t, strings.TrimPrefix(judge.URL, "http://"))
+	local := resolverFrom(t, probe, "127.0.0.1")
+	remote := resolverFrom(t, probe, "127.0.0.2")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS5(conn, "", "", 0x00, make(chan socks5Request, 4), remote)
+		}
+	}()
+
+	cases := []struct {
+		name     string
+		protocol string
+		localDNS bool
+		mode     string
+		remote   bool
+		leak     bool
+		resolver string
+	}{
+		{"socks5h", "socks5h", false, DNSModeRemote, true, false, "127.0.0.2"},
+		{"socks5", "socks5", false, DNSModeRemote, true, false, "127.0.0.2"},
+		{"socks5 local", "socks5", true, DNSModeLocal, false, true, "127.0.0.1"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			result := CheckProxyWithOptions(ctx, ProxyTarget{Address: ln.Addr().String(), Protocol: tc.protocol}, CheckOptions{
+				JudgeURL: judge.URL,
+				DNSProbe: probe,
+				Resolver: local,
+				LocalDNS: tc.localDNS,
+			})
+			if !result.Status || result.DNS == nil {
+				t.Fatalf("expected a DNS result, got status %v error %q", result.Status, result.Error)
+			}
+			dns := result.DNS
+			if dns.Mode != tc.mode || dns.RemoteResolved != tc.remote || dns.Leak != tc.leak {
+				t.Errorf("unexpected DNS result: %+v", dns)
+			}
+			if len(dns.Resolvers) != 1 || dns.Resolvers[0] != tc.resolver {
+				t.Errorf("expected resolver %s, got %v", tc.resolver, dns.Resolvers)
+			}
+		})
+	}
+}
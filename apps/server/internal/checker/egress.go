@@ -0,0 +1,82 @@
+package checker
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Egress values report which address families a proxy can leave through.
+const (
+	EgressIPv4 = "ipv4"
+	EgressIPv6 = "ipv6"
+	EgressDual = "dual"
+)
+
+// detectEgress asks a single-stack judge per family for the address the
+// proxy exits from. Such judges only resolve to one family, so a reply proves
+// the proxy can reach that family. Both lookups run in parallel through
+// client, which already carries the proxy transport.
+func detectEgress(ctx context.Context, client *http.Client, ipv4URL, ipv6URL string) (v4, v6 string) {
+	var wg sync.WaitGroup
+	lookup := func(rawURL string, version int, out *string) {
+		defer wg.Done()
+		if ip := fetchExitIP(ctx, client, rawURL); ipVersion(ip) == version {
+			*out = ip
+		}
+	}
+	if ipv4URL != "" {
+		wg.Add(1)
+		go lookup(ipv4URL, 4, &v4)
+	}
+	if ipv6URL != "" {
+		wg.Add(1)
+		go lookup(ipv6URL, 6, &v6)
+	}
+	wg.Wait()
+	return v4, v6
+}
+
+func fetchExitIP(ctx context.Context, client *http.Client, rawURL string) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return ""
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return ""
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, judgeBodyLimit))
+	parsed, _ := parseJudgeBody(body)
+	return parsed.IP
+}
+
+// applyEgress records the exit addresses per family, including the one the
+// main judge saw, and summarises them.
+func (r *ProxyResult) applyEgress(v4, v6 string) {
+	switch ipVersion(r.ExitIP) {
+	case 4:
+		if v4 == "" {
+			v4 = r.ExitIP
+		}
+	case 6:
+		if v6 == "" {
+			v6 = r.ExitIP
+		}
+	}
+	r.ExitIPv4, r.ExitIPv6 = v4, v6
+
+	switch {
+	case v4 != "" && v6 != "":
+		r.Egress = EgressDual
+	case v4 != "":
+		r.Egress = EgressIPv4
+	case v6 != "":
+		r.Egress = EgressIPv6
+	}
+}
@@ -0,0 +1,106 @@
+package checker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func startIPv6Judge(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener.Close()
+	server.Listener = ln
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheckProxy_DualStackEgress(t *testing.T) {
+	judge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("203.0.113.5"))
+	}))
+	defer judge.Close()
+	v6Judge := startIPv6Judge(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("2001:db8::5"))
+	}))
+	// A v4 judge answering with a v6 address must not count as v4 egress.
+	bogusV4 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("2001:db8::6"))
+	}))
+	defer bogusV4.Close()
+
+	proxyAddr, _ := startSOCKS5Server(t, "", "", 0x00)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := CheckProxyWithOptions(ctx, ProxyTarget{Address: proxyAddr, Protocol: "socks5"}, CheckOptions{
+		JudgeURL:     judge.URL,
+		IPv4JudgeURL: bogusV4.URL,
+		IPv6JudgeURL: v6Judge.URL,
+	})
+	if !result.Status {
+		t.Fatalf("expected check to succeed, got error %q", result.Error)
+	}
+	if result.ExitIPv4 != "203.0.113.5" || result.ExitIPv6 != "2001:db8::5" {
+		t.Errorf("unexpected exit addresses v4=%q v6=%q", result.ExitIPv4, result.ExitIPv6)
+	}
+	if result.Egress != EgressDual {
+		t.Errorf("expected dual egress, got %q", result.Egress)
+	}
+	if result.IPVersion != 4 {
+		t.Errorf("expected proxy ip_version 4, got %d", result.IPVersion)
+	}
+}
+
+func TestCheckProxy_IPv6Proxy(t *testing.T) {
+	judge := startIPv6Judge(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ip":"2001:db8::7","headers":{}}`))
+	}))
+
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer ln.Close()
+	requests := make(chan socks5Request, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS5(conn, "", "", 0x00, requests, nil)
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	target, err := ParseProxyLine("[::1]:"+port, "socks5")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := CheckProxy(ctx, target, judge.URL, nil)
+	if !result.Status {
+		t.Fatalf("expected check to succeed, got error %q", result.Error)
+	}
+	if result.IP != "::1" || result.IPVersion != 6 {
+		t.Errorf("expected IPv6 proxy address, got %q (version %d)", result.IP, result.IPVersion)
+	}
+	if result.ExitIP != "2001:db8::7" || result.Egress != "" {
+		t.Errorf("unexpected exit %q / egress %q", result.ExitIP, result.Egress)
+	}
+	if req := <-requests; req.host != "::1" {
+		t.Errorf("expected CONNECT to the IPv6 judge, got %q", req.host)
+	}
+}
@@ -0,0 +1,63 @@
+package checker
+
+import (
+	"net"
+
+	"socksproxies.com/server/internal/geoip"
+)
+
+// GeoInfo locates one end of a proxy: the address it was reached on or the
+// address the judge saw.
+type GeoInfo struct {
+	IP      string `json:"ip"`
+	Country string `json:"country,omitempty"`
+	City    string `json:"city,omitempty"`
+	ASN     int    `json:"asn,omitempty"`
+	Org     string `json:"org,omitempty"`
+	// Class is the network type of the ASN: hosting, isp or mobile.
+	Class string `json:"asn_class,omitempty"`
+}
+
+// lookupGeo returns what the databases know about ip, or nil when they know
+// nothing.
+func lookupGeo(reader *geoip.Reader, classes *geoip.ASNClassifier, ip string) *GeoInfo {
+	if reader == nil || net.ParseIP(ip) == nil {
+		return nil
+	}
+	city := reader.LookupCity(ip)
+	asn := reader.LookupASN(ip)
+	info := &GeoInfo{
+		IP:      ip,
+		Country: city.CountryCode,
+		City:    city.City,
+		ASN:     asn.Number,
+		Org:     asn.Organization,
+		Class:   classes.Classify(asn.Number),
+	}
+	if info.Country == "" {
+		info.Country = reader.LookupCountry(ip)
+	}
+	if info.Country == "" && info.City == "" && info.ASN == 0 {
+		return nil
+	}
+	return info
+}
+
+// applyGeo locates both ends of the proxy and flags an exit address that is
+// not the one the proxy was reached on.
+func (r *ProxyResult) applyGeo(reader *geoip.Reader, classes *geoip.ASNClassifier) {
+	entry := net.ParseIP(r.IP)
+	exit := net.ParseIP(r.ExitIP)
+	r.ExitDiffers = entry != nil && exit != nil && !entry.Equal(exit)
+
+	if reader == nil {
+		return
+	}
+	if r.IP != "" {
+		r.Country = reader.LookupCountry(r.IP)
+	}
+	r.EntryGeo = lookupGeo(reader, classes, r.IP)
+	if r.ExitIP != "" {
+		r.ExitGeo = lookupGeo(reader, classes, r.ExitIP)
+	}
+}
@@ -0,0 +1,30 @@
+package checker
+
+import "testing"
+
+func TestApplyGeo_ExitDiffers(t *testing.T) {
+	cases := []struct {
+		name    string
+		ip      string
+		exit    string
+		differs bool
+	}{
+		{"same", "203.0.113.5", "203.0.113.5", false},
+		{"different", "198.51.100.7", "203.0.113.5", true},
+		{"ipv6_same", "2001:db8::1", "2001:0db8::0001", false},
+		{"hostname", "proxy.example.com", "203.0.113.5", false},
+		{"no_exit", "198.51.100.7", "", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := ProxyResult{IP: tc.ip, ExitIP: tc.exit}
+			result.applyGeo(nil, nil)
+			if result.ExitDiffers != tc.differs {
+				t.Errorf("expected exit_differs %v, got %v", tc.differs, result.ExitDiffers)
+			}
+			if result.EntryGeo != nil || result.ExitGeo != nil {
+				t.Error("expected no geo data without a reader")
+			}
+		})
+	}
+}
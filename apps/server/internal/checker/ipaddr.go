@@ -0,0 +1,83 @@
+package checker
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// findIPs returns up to n IPv4 or IPv6 addresses found in s, in order (n < 0
+// means all of them). Candidates are runs of hex digits, dots and colons that
+// parse as an address; "host:port" and "[v6]:port" forms are accepted too.
+// IPv4-mapped IPv6 addresses are reported in their IPv4 form so the same exit
+// compares equal whichever way a judge prints it.
+func findIPs(s string, n int) []string {
+	var ips []string
+	for _, token := range strings.FieldsFunc(s, func(r rune) bool { return !isIPRune(r) }) {
+		if n >= 0 && len(ips) >= n {
+			break
+		}
+		if ip := parseIPToken(token); ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// findIP returns the first address in s, or "".
+func findIP(s string) string {
+	if ips := findIPs(s, 1); len(ips) > 0 {
+		return ips[0]
+	}
+	return ""
+}
+
+func isIPRune(r rune) bool {
+	switch {
+	case r >= '0' && r <= '9', r >= 'a' && r <= 'f', r >= 'A' && r <= 'F':
+		return true
+	default:
+		return r == '.' || r == ':'
+	}
+}
+
+func parseIPToken(token string) string {
+	token = strings.TrimRight(token, ".")
+	if !strings.ContainsAny(token, ".:") {
+		return ""
+	}
+	if addr, err := netip.ParseAddr(token); err == nil {
+		return canonicalIP(addr)
+	}
+	// An IPv4 address followed by a port, as in "1.2.3.4:8080".
+	if addrPort, err := netip.ParseAddrPort(token); err == nil && addrPort.Addr().Is4() {
+		return canonicalIP(addrPort.Addr())
+	}
+	// Labels such as "IP:1.2.3.4" leave a stray colon on either side.
+	if trimmed := strings.Trim(token, ":"); trimmed != token {
+		if addr, err := netip.ParseAddr(trimmed); err == nil {
+			return canonicalIP(addr)
+		}
+	}
+	return ""
+}
+
+func canonicalIP(addr netip.Addr) string {
+	if addr.IsUnspecified() && addr.Is6() {
+		// "::" shows up in ordinary text far more often than as an address.
+		return ""
+	}
+	return addr.Unmap().String()
+}
+
+// ipVersion reports 4 or 6 for an address literal, bracketed or not, and 0
+// for anything else.
+func ipVersion(ip string) int {
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(ip, "["), "]"))
+	if err != nil {
+		return 0
+	}
+	if addr.Unmap().Is4() {
+		return 4
+	}
+	return 6
+}
@@ -0,0 +1,182 @@
+package checker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Anonymity levels on the same 0-5 scale the proxy_list feed uses:
+// 0-1 transparent, 2-3 anonymous, 4-5 elite. AnonUnknown is reported
+// together with the "unknown" label when the judge gave us nothing to go on.
+const (
+	AnonUnknown     = 0
+	AnonTransparent = 1
+	AnonDistorting  = 2
+	AnonAnonymous   = 3
+	AnonElite       = 5
+)
+
+const (
+	judgeBodyLimit = 4096
+	originCacheTTL = 10 * time.Minute
+)
+
+// JudgeResponse is the structured echo returned by the built-in judge route:
+// the address the judge saw plus any proxy-revealing headers it received.
+type JudgeResponse struct {
+	IP      string            `json:"ip"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// parseJudgeBody accepts either the JSON echo of the built-in judge or a
+// plain-text body from a third-party judge. The boolean reports whether the
+// response carried header information.
+func parseJudgeBody(body []byte) (JudgeResponse, bool) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var judge JudgeResponse
+		if err := json.Unmarshal(trimmed, &judge); err == nil && judge.IP != "" {
+			judge.IP = findIP(judge.IP)
+			return judge, judge.Headers != nil
+		}
+	}
+	return JudgeResponse{IP: findIP(string(trimmed))}, false
+}
+
+// classifyAnonymity grades a proxy from what the judge observed. originIPs are
+// the checker's own public addresses as reported by the same judge without a
+// proxy; seeing any of them in the echoed headers means the proxy leaks us.
+func classifyAnonymity(judge JudgeResponse, structured bool, originIPs []string) (string, int) {
+	if judge.IP == "" {
+		return "unknown", AnonUnknown
+	}
+
+	origin := make(map[string]bool, len(originIPs))
+	for _, ip := range originIPs {
+		origin[ip] = true
+	}
+
+	if origin[judge.IP] {
+		return "transparent", AnonTransparent
+	}
+
+	leaked := false
+	foreign := false
+	for _, value := range judge.Headers {
+		for _, ip := range findIPs(value, -1) {
+			switch {
+			case origin[ip]:
+				leaked = true
+			case ip != judge.IP:
+				foreign = true
+			}
+		}
+	}
+
+	switch {
+	case leaked:
+		return "transparent", AnonTransparent
+	case !structured:
+		// Third-party judges only echo the exit address, so the best we can
+		// say is that our own address was hidden.
+		return "anonymous", AnonDistorting
+	case foreign:
+		return "anonymous", AnonDistorting
+	case len(judge.Headers) > 0:
+		return "anonymous", AnonAnonymous
+	default:
+		return "elite", AnonElite
+	}
+}
+
+type originEntry struct {
+	mu      sync.Mutex
+	ips     []string
+	fetched time.Time
+}
+
+// originCache remembers the checker's public address per judge so transparent
+// proxies can be recognised without a direct judge request for every check.
+type originCache struct {
+	mu      sync.Mutex
+	entries map[string]*originEntry
+	client  *http.Client
+}
+
+var origins = &originCache{
+	entries: make(map[string]*originEntry),
+	client:  &http.Client{Timeout: 5 * time.Second},
+}
+
+func (o *originCache) entry(judgeURL string) *originEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	entry, ok := o.entries[judgeURL]
+	if !ok {
+		entry = &originEntry{}
+		o.entries[judgeURL] = entry
+	}
+	return entry
+}
+
+func (o *originCache) lookup(ctx context.Context, judge Judge) []string {
+	entry := o.entry(judge.URL)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if !entry.fetched.IsZero() && time.Since(entry.fetched) < originCacheTTL {
+		return entry.ips
+	}
+
+	ip, err := fetchDirect(ctx, o.client, judge)
+	if err != nil {
+		// Keep any previous answer; a failed refresh should not make every
+		// transparent proxy look anonymous.
+		return entry.ips
+	}
+	entry.ips = []string{ip}
+	entry.fetched = time.Now()
+	return entry.ips
+}
+
+// store records an origin address learned elsewhere, e.g. by a judge pool
+// health check, so the next lookup does not need its own request.
+func (o *originCache) store(judgeURL, ip string) {
+	entry := o.entry(judgeURL)
+	entry.mu.Lock()
+	entry.ips = []string{ip}
+	entry.fetched = time.Now()
+	entry.mu.Unlock()
+}
+
+// fetchDirect queries a judge without any proxy and returns the address it
+// reports for us.
+func fetchDirect(ctx context.Context, client *http.Client, judge Judge) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, judge.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("judge returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, judgeBodyLimit))
+	if err != nil {
+		return "", err
+	}
+	parsed, _ := judge.Parse(body)
+	if parsed.IP == "" {
+		return "", errJudgeNoIP
+	}
+	return parsed.IP, nil
+}
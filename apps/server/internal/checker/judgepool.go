@@ -0,0 +1,380 @@
+package checker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// JudgeFormat selects how a judge response body is parsed.
+type JudgeFormat string
+
+const (
+	// JudgeFormatAuto accepts the built-in echo format and falls back to the
+	// first IP address found in the body.
+	JudgeFormatAuto JudgeFormat = "auto"
+	// JudgeFormatText is a plain-text body holding the caller's address,
+	// e.g. https://api.ipify.org?format=text.
+	JudgeFormatText JudgeFormat = "text"
+	// JudgeFormatJSON is a JSON object with the address in an "origin", "ip"
+	// or "query" field, e.g. https://httpbin.org/ip.
+	JudgeFormatJSON JudgeFormat = "json"
+	// JudgeFormatEcho is the header echo served by /api/judge.
+	JudgeFormatEcho JudgeFormat = "echo"
+)
+
+const (
+	judgeUnhealthyAfter   = 3
+	judgeScoreDecay       = 0.2
+	defaultJudgeInterval  = time.Minute
+	defaultJudgeCheckTime = 5 * time.Second
+)
+
+var (
+	errJudgeNoIP      = errors.New("judge response did not contain an IP address")
+	errNoJudges       = errors.New("no judge configured")
+	jsonOriginFields  = []string{"origin", "ip", "query", "ip_addr"}
+	validJudgeFormats = map[JudgeFormat]bool{
+		JudgeFormatAuto: true,
+		JudgeFormatText: true,
+		JudgeFormatJSON: true,
+		JudgeFormatEcho: true,
+	}
+)
+
+// Judge is a single endpoint that reports the address a request came from.
+type Judge struct {
+	URL    string
+	Format JudgeFormat
+	Name   string
+}
+
+// ParseJudge reads a judge spec of the form "format|url" or a bare URL, which
+// is parsed with JudgeFormatAuto.
+func ParseJudge(spec string) (Judge, error) {
+	spec = strings.TrimSpace(spec)
+	format := JudgeFormatAuto
+	if kind, rawURL, ok := strings.Cut(spec, "|"); ok {
+		format = JudgeFormat(strings.ToLower(strings.TrimSpace(kind)))
+		spec = strings.TrimSpace(rawURL)
+	}
+	if !validJudgeFormats[format] {
+		return Judge{}, fmt.Errorf("unknown judge format %q", format)
+	}
+
+	parsed, err := url.Parse(spec)
+	if err != nil {
+		return Judge{}, err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" {
+		return Judge{}, fmt.Errorf("invalid judge url %q", spec)
+	}
+
+	return Judge{URL: spec, Format: format, Name: parsed.Host}, nil
+}
+
+// Parse extracts the observed address (and echoed headers, if any) from a
+// judge response. The boolean reports whether header information was present.
+func (j Judge) Parse(body []byte) (JudgeResponse, bool) {
+	switch j.Format {
+	case JudgeFormatText:
+		return JudgeResponse{IP: findIP(string(body))}, false
+	case JudgeFormatJSON:
+		return parseJSONOrigin(body), false
+	case JudgeFormatEcho:
+		judge, structured := parseJudgeBody(body)
+		if !structured {
+			return JudgeResponse{}, false
+		}
+		return judge, true
+	default:
+		return parseJudgeBody(body)
+	}
+}
+
+// parseJSONOrigin handles httpbin-style bodies. When the origin field lists
+// several addresses the last one is the connecting client and the earlier ones
+// were forwarded by the proxy, so they are reported as a forwarding header.
+func parseJSONOrigin(body []byte) JudgeResponse {
+	var fields map[string]any
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return JudgeResponse{}
+	}
+	for _, key := range jsonOriginFields {
+		value, ok := fields[key].(string)
+		if !ok {
+			continue
+		}
+		ips := findIPs(value, -1)
+		if len(ips) == 0 {
+			continue
+		}
+		resp := JudgeResponse{IP: ips[len(ips)-1]}
+		if len(ips) > 1 {
+			resp.Headers = map[string]string{"X-Forwarded-For": strings.Join(ips[:len(ips)-1], ", ")}
+		}
+		return resp
+	}
+	return JudgeResponse{}
+}
+
+type judgeState struct {
+	judge Judge
+
+	mu        sync.Mutex
+	healthy   bool
+	failures  int
+	score     float64
+	lastCheck time.Time
+	lastError string
+}
+
+func (s *judgeState) isHealthy() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.healthy
+}
+
+func (s *judgeState) record(ok bool, err error) {
+	s.mu.Lock()
+	if ok {
+		s.failures = 0
+		s.healthy = true
+		s.score += (1 - s.score) * judgeScoreDecay
+		s.lastError = ""
+	} else {
+		s.failures++
+		if s.failures >= judgeUnhealthyAfter {
+			s.healthy = false
+		}
+		s.score -= s.score * judgeScoreDecay
+		if err != nil {
+			s.lastError = err.Error()
+		}
+	}
+	healthy, score := s.healthy, s.score
+	s.mu.Unlock()
+
+	setJudgeHealth(s.judge.Name, healthy, score)
+}
+
+// JudgeStatus is a point-in-time view of a judge's health.
+type JudgeStatus struct {
+	URL       string    `json:"url"`
+	Format    string    `json:"format"`
+	Healthy   bool      `json:"healthy"`
+	Score     float64   `json:"score"`
+	Failures  int       `json:"failures"`
+	LastCheck time.Time `json:"last_check"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// JudgePool rotates checks across several judges, skipping the ones its
+// background health checks have found to be failing. With consensus enabled a
+// proxy is only reported dead once a second judge has failed as well.
+type JudgePool struct {
+	judges    []*judgeState
+	next      atomic.Uint64
+	consensus bool
+	interval  time.Duration
+	client    *http.Client
+}
+
+type JudgePoolOption func(*JudgePool)
+
+// WithConsensus requires two judges to fail before a proxy is marked dead.
+func WithConsensus(enabled bool) JudgePoolOption {
+	return func(p *JudgePool) {
+		p.consensus = enabled
+	}
+}
+
+// WithHealthInterval sets how often Start re-checks every judge directly.
+func WithHealthInterval(interval time.Duration) JudgePoolOption {
+	return func(p *JudgePool) {
+		if interval > 0 {
+			p.interval = interval
+		}
+	}
+}
+
+// NewJudgePool builds a pool from judge specs (see ParseJudge). Invalid or
+// duplicate specs are logged and skipped. Every judge starts out healthy.
+func NewJudgePool(specs []string, opts ...JudgePoolOption) *JudgePool {
+	p := &JudgePool{
+		interval: defaultJudgeInterval,
+		client:   &http.Client{Timeout: defaultJudgeCheckTime},
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(p)
+		}
+	}
+
+	seen := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		judge, err := ParseJudge(spec)
+		if err != nil {
+			log.Printf("[WARN] ignoring judge %q: %v", spec, err)
+			continue
+		}
+		if seen[judge.URL] {
+			continue
+		}
+		seen[judge.URL] = true
+		p.judges = append(p.judges, &judgeState{judge: judge, healthy: true, score: 1})
+		setJudgeHealth(judge.Name, true, 1)
+	}
+	return p
+}
+
+// Len reports the number of judges in the pool.
+func (p *JudgePool) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.judges)
+}
+
+// Consensus reports whether a second judge is consulted before declaring a
+// proxy dead.
+func (p *JudgePool) Consensus() bool {
+	return p != nil && p.consensus
+}
+
+// Start runs health checks immediately and then every interval until ctx is
+// cancelled.
+func (p *JudgePool) Start(ctx context.Context) {
+	if p.Len() == 0 {
+		return
+	}
+	p.CheckHealth(ctx)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.CheckHealth(ctx)
+		}
+	}
+}
+
+// CheckHealth queries every judge directly, without a proxy, and updates its
+// health. Successful checks also refresh the cached origin address used for
+// anonymity grading.
+func (p *JudgePool) CheckHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, state := range p.judges {
+		wg.Add(1)
+		go func(state *judgeState) {
+			defer wg.Done()
+			ip, err := fetchDirect(ctx, p.client, state.judge)
+			if ctx.Err() != nil {
+				return
+			}
+			state.mu.Lock()
+			state.lastCheck = time.Now()
+			state.mu.Unlock()
+
+			recordJudgeHealthCheck(state.judge.Name, err == nil)
+			state.record(err == nil, err)
+			if err != nil {
+				log.Printf("[WARN] judge %s health check failed: %v", state.judge.URL, err)
+				return
+			}
+			origins.store(state.judge.URL, ip)
+		}(state)
+	}
+	wg.Wait()
+}
+
+// Pick returns the next healthy judge in rotation, skipping exclude. Judges
+// that echo headers come first, since only they can grade a proxy elite;
+// text and JSON judges are failover. When no healthy judge is left it falls
+// back to the remaining ones so checks keep running. ok is false only if
+// there is no judge other than exclude.
+func (p *JudgePool) Pick(exclude string) (Judge, bool) {
+	if p.Len() == 0 {
+		return Judge{}, false
+	}
+
+	n := len(p.judges)
+	offset := int(p.next.Add(1) - 1)
+	var failover, fallback *judgeState
+	for i := 0; i < n; i++ {
+		state := p.judges[(offset+i)%n]
+		if state.judge.URL == exclude {
+			continue
+		}
+		switch {
+		case !state.isHealthy():
+			if fallback == nil {
+				fallback = state
+			}
+		case state.judge.echoesHeaders():
+			return state.judge, true
+		case failover == nil:
+			failover = state
+		}
+	}
+	if failover != nil {
+		return failover.judge, true
+	}
+	if fallback == nil {
+		return Judge{}, false
+	}
+	return fallback.judge, true
+}
+
+// echoesHeaders reports whether the judge can answer in the header echo
+// format, which anonymity grading needs to tell elite from anonymous.
+func (j Judge) echoesHeaders() bool {
+	return j.Format == JudgeFormatEcho || j.Format == JudgeFormatAuto
+}
+
+// ReportFailure marks a judge as having failed while another judge succeeded
+// through the same proxy, which points at the judge rather than the proxy.
+func (p *JudgePool) ReportFailure(judgeURL string, err error) {
+	if p == nil {
+		return
+	}
+	for _, state := range p.judges {
+		if state.judge.URL == judgeURL {
+			state.record(false, err)
+			return
+		}
+	}
+}
+
+// Status returns the health of every judge in the pool.
+func (p *JudgePool) Status() []JudgeStatus {
+	if p == nil {
+		return nil
+	}
+	statuses := make([]JudgeStatus, 0, len(p.judges))
+	for _, state := range p.judges {
+		state.mu.Lock()
+		statuses = append(statuses, JudgeStatus{
+			URL:       state.judge.URL,
+			Format:    string(state.judge.Format),
+			Healthy:   state.healthy,
+			Score:     state.score,
+			Failures:  state.failures,
+			LastCheck: state.lastCheck,
+			LastError: state.lastError,
+		})
+		state.mu.Unlock()
+	}
+	return statuses
+}
@@ -0,0 +1,161 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseJudge(t *testing.T) {
+	cases := []struct {
+		spec    string
+		format  JudgeFormat
+		url     string
+		wantErr bool
+	}{
+		{"https://api.ipify.org?format=text", JudgeFormatAuto, "https://api.ipify.org?format=text", false},
+		{"json|https://httpbin.org/ip", JudgeFormatJSON, "https://httpbin.org/ip", false},
+		{" ECHO | https://api.socks5proxies.com/api/judge ", JudgeFormatEcho, "https://api.socks5proxies.com/api/judge", false},
+		{"xml|https://example.com", "", "", true},
+		{"text|ftp://example.com", "", "", true},
+		{"not a url", "", "", true},
+	}
+
+	for _, tc := range cases {
+		judge, err := ParseJudge(tc.spec)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseJudge(%q) expected error", tc.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseJudge(%q) unexpected error: %v", tc.spec, err)
+			continue
+		}
+		if judge.Format != tc.format || judge.URL != tc.url {
+			t.Errorf("ParseJudge(%q) = %+v, expected format %s url %s", tc.spec, judge, tc.format, tc.url)
+		}
+	}
+}
+
+func TestJudgeParse_Formats(t *testing.T) {
+	jsonJudge := Judge{Format: JudgeFormatJSON}
+	resp, structured := jsonJudge.Parse([]byte(`{"origin":"9.9.9.9, 1.2.3.4"}`))
+	if structured || resp.IP != "1.2.3.4" || resp.Headers["X-Forwarded-For"] != "9.9.9.9" {
+		t.Errorf("unexpected json parse: %+v structured=%v", resp, structured)
+	}
+
+	resp, _ = jsonJudge.Parse([]byte(`{"query":"5.6.7.8","status":"success"}`))
+	if resp.IP != "5.6.7.8" {
+		t.Errorf("expected query field to be used, got %+v", resp)
+	}
+
+	echoJudge := Judge{Format: JudgeFormatEcho}
+	if resp, _ := echoJudge.Parse([]byte("1.2.3.4")); resp.IP != "" {
+		t.Errorf("expected echo judge to reject plain text, got %+v", resp)
+	}
+
+	textJudge := Judge{Format: JudgeFormatText}
+	if resp, _ := textJudge.Parse([]byte("  1.2.3.4\n")); resp.IP != "1.2.3.4" {
+		t.Errorf("unexpected text parse: %+v", resp)
+	}
+}
+
+func TestJudgePool_HealthChecksSkipFailingJudge(t *testing.T) {
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("127.0.0.1"))
+	}))
+	defer good.Close()
+
+	pool := NewJudgePool([]string{"text|" + bad.URL, "text|" + good.URL, bad.URL})
+	if pool.Len() != 2 {
+		t.Fatalf("expected duplicate judge to be dropped, got %d judges", pool.Len())
+	}
+
+	for i := 0; i < judgeUnhealthyAfter; i++ {
+		pool.CheckHealth(context.Background())
+	}
+
+	for i := 0; i < 4; i++ {
+		judge, ok := pool.Pick("")
+		if !ok || judge.URL != good.URL {
+			t.Fatalf("expected healthy judge %s, got %+v", good.URL, judge)
+		}
+	}
+	if _, ok := pool.Pick(good.URL); !ok {
+		t.Errorf("expected unhealthy judge as a last resort fallback")
+	}
+
+	for _, status := range pool.Status() {
+		if status.URL == bad.URL && (status.Healthy || status.Failures != judgeUnhealthyAfter) {
+			t.Errorf("expected failing judge to be unhealthy, got %+v", status)
+		}
+	}
+}
+
+func TestJudgePool_PrefersEchoJudges(t *testing.T) {
+	pool := NewJudgePool([]string{
+		"text|https://text.judge.test/",
+		"https://echo.judge.test/api/judge",
+		"json|https://json.judge.test/ip",
+	})
+
+	for i := 0; i < 6; i++ {
+		judge, ok := pool.Pick("")
+		if !ok || judge.URL != "https://echo.judge.test/api/judge" {
+			t.Fatalf("expected the echo judge for the primary query, got %+v", judge)
+		}
+	}
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		judge, ok := pool.Pick("https://echo.judge.test/api/judge")
+		if !ok || judge.echoesHeaders() {
+			t.Fatalf("expected a text or JSON judge as failover, got %+v", judge)
+		}
+		seen[judge.URL] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("expected failover to rotate across both judges, got %v", seen)
+	}
+}
+
+func TestCheckProxyWithOptions_Consensus(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("127.0.0.1"))
+	}))
+	defer up.Close()
+
+	proxyAddr, _ := startSOCKS4Server(t, socks4Granted)
+	target := ProxyTarget{Address: proxyAddr, Protocol: "socks4"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	single := NewJudgePool([]string{"text|" + down.URL, "text|" + up.URL})
+	if res := CheckProxyWithOptions(ctx, target, CheckOptions{Judges: single}); res.Status {
+		t.Fatalf("expected failure without consensus when the first judge is down")
+	}
+
+	pool := NewJudgePool([]string{"text|" + down.URL, "text|" + up.URL}, WithConsensus(true))
+	res := CheckProxyWithOptions(ctx, target, CheckOptions{Judges: pool})
+	if !res.Status {
+		t.Fatalf("expected second judge to rescue the check, got error %q", res.Error)
+	}
+
+	for _, status := range pool.Status() {
+		if status.URL == down.URL && status.Failures != 1 {
+			t.Errorf("expected failing judge to be blamed once, got %+v", status)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package checker
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	judgeRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "checker_judge_requests_total",
+			Help: "Total number of proxied judge requests by judge and outcome.",
+		},
+		[]string{"judge", "outcome"},
+	)
+	judgeHealthChecksTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "checker_judge_health_checks_total",
+			Help: "Total number of direct judge health checks by judge and outcome.",
+		},
+		[]string{"judge", "outcome"},
+	)
+	judgeHealthy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "checker_judge_healthy",
+			Help: "Whether a judge is currently considered healthy (1) or not (0).",
+		},
+		[]string{"judge"},
+	)
+	judgeHealthScore = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "checker_judge_health_score",
+			Help: "Exponentially weighted success rate of a judge between 0 and 1.",
+		},
+		[]string{"judge"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(judgeRequestsTotal, judgeHealthChecksTotal, judgeHealthy, judgeHealthScore)
+}
+
+func outcomeLabel(ok bool) string {
+	if ok {
+		return "success"
+	}
+	return "failure"
+}
+
+func recordJudgeRequest(judge string, ok bool) {
+	judgeRequestsTotal.WithLabelValues(judge, outcomeLabel(ok)).Inc()
+}
+
+func recordJudgeHealthCheck(judge string, ok bool) {
+	judgeHealthChecksTotal.WithLabelValues(judge, outcomeLabel(ok)).Inc()
+}
+
+func setJudgeHealth(judge string, healthy bool, score float64) {
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	judgeHealthy.WithLabelValues(judge).Set(value)
+	judgeHealthScore.WithLabelValues(judge).Set(score)
+}
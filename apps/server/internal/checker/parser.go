@@ -10,7 +10,35 @@ import (
 
 var ErrInvalidProxy = errors.New("invalid proxy format")
 
+const chainSeparator = "->"
+
 func ParseProxyLine(input string, defaultProtocol string) (ProxyTarget, error) {
+	if !strings.Contains(input, chainSeparator) {
+		return parseProxyHop(input, defaultProtocol)
+	}
+
+	// A chain such as "socks5://a:1080 -> http://b:3128" is traversed left to
+	// right; the first hop carries the rest.
+	parts := strings.Split(input, chainSeparator)
+	if len(parts) > MaxChainHops {
+		return ProxyTarget{}, ErrInvalidProxy
+	}
+	var head ProxyTarget
+	for i, part := range parts {
+		hop, err := parseProxyHop(part, defaultProtocol)
+		if err != nil {
+			return ProxyTarget{}, err
+		}
+		if i == 0 {
+			head = hop
+			continue
+		}
+		head.Chain = append(head.Chain, hop)
+	}
+	return head, nil
+}
+
+func parseProxyHop(input string, defaultProtocol string) (ProxyTarget, error) {
 	trimmed := strings.TrimSpace(input)
 	if trimmed == "" {
 		return ProxyTarget{}, ErrInvalidProxy
@@ -20,8 +48,8 @@ func ParseProxyLine(input string, defaultProtocol string) (ProxyTarget, error) {
 		return parseURLProxy(trimmed)
 	}
 
-	parts := strings.Split(trimmed, ":")
-	if len(parts) < 2 {
+	parts, ok := splitProxyLine(trimmed)
+	if !ok || len(parts) < 2 {
 		return ProxyTarget{}, ErrInvalidProxy
 	}
 
@@ -57,6 +85,27 @@ func ParseProxyLine(input string, defaultProtocol string) (ProxyTarget, error) {
 	}, nil
 }
 
+// splitProxyLine splits host:port[:user:pass] on colons, keeping a bracketed
+// IPv6 host such as [2001:db8::1] in one piece.
+func splitProxyLine(line string) ([]string, bool) {
+	if !strings.HasPrefix(line, "[") {
+		return strings.Split(line, ":"), true
+	}
+	end := strings.Index(line, "]")
+	if end < 0 {
+		return nil, false
+	}
+	host := line[1:end]
+	if net.ParseIP(host) == nil || !strings.Contains(host, ":") {
+		return nil, false
+	}
+	rest, ok := strings.CutPrefix(line[end+1:], ":")
+	if !ok {
+		return nil, false
+	}
+	return append([]string{host}, strings.Split(rest, ":")...), true
+}
+
 func parseURLProxy(raw string) (ProxyTarget, error) {
 	parsed, err := url.Parse(raw)
 	if err != nil {
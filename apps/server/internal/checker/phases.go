@@ -0,0 +1,200 @@
+package checker
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Phase identifies one leg of a proxied request.
+type Phase int
+
+const (
+	// PhaseConnect is the TCP connect to the proxy itself.
+	PhaseConnect Phase = iota
+	// PhaseHandshake is SOCKS5 method negotiation and authentication.
+	PhaseHandshake
+	// PhaseTunnel is the SOCKS CONNECT request or the HTTP CONNECT exchange.
+	PhaseTunnel
+	// PhaseTLS is the TLS handshake with the judge through the tunnel.
+	PhaseTLS
+	// PhaseTTFB is the time from sending the request to the first response byte.
+	PhaseTTFB
+	phaseCount
+)
+
+// PhaseTimings breaks a check's latency down by phase, in milliseconds.
+// Phases a protocol does not have (e.g. TLS against a plain-HTTP judge) are 0.
+type PhaseTimings struct {
+	ConnectMS   int64 `json:"connect_ms"`
+	HandshakeMS int64 `json:"handshake_ms"`
+	TunnelMS    int64 `json:"tunnel_ms"`
+	TLSMS       int64 `json:"tls_ms"`
+	TTFBMS      int64 `json:"ttfb_ms"`
+}
+
+type phaseRecorder struct {
+	mu        sync.Mutex
+	durations [phaseCount]time.Duration
+	seen      bool
+
+	connectStart map[string]time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+
+	// hopReached is, per chain hop, the time from the start of the dial until
+	// a connection to that hop was open.
+	hopReached map[int]time.Duration
+}
+
+type phaseKey struct{}
+
+// withPhaseTrace returns a context that records phase timings both from the
+// proxy dialers and from net/http's client trace hooks.
+func withPhaseTrace(ctx context.Context) (context.Context, *phaseRecorder) {
+	rec := &phaseRecorder{connectStart: make(map[string]time.Time)}
+	ctx = context.WithValue(ctx, phaseKey{}, rec)
+	return httptrace.WithClientTrace(ctx, rec.clientTrace()), rec
+}
+
+func phasesFrom(ctx context.Context) *phaseRecorder {
+	rec, _ := ctx.Value(phaseKey{}).(*phaseRecorder)
+	return rec
+}
+
+func (r *phaseRecorder) record(phase Phase, d time.Duration) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.durations[phase] = d
+	r.seen = true
+	r.mu.Unlock()
+}
+
+// markTunnelEstablished is called once an HTTP proxy answers CONNECT; the
+// tunnel phase runs from the end of the TCP connect until then.
+func (r *phaseRecorder) markTunnelEstablished() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if !r.connectDone.IsZero() {
+		r.durations[PhaseTunnel] = time.Since(r.connectDone)
+		r.seen = true
+	}
+	r.mu.Unlock()
+}
+
+func (r *phaseRecorder) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		ConnectStart: func(network, addr string) {
+			r.mu.Lock()
+			r.connectStart[addr] = time.Now()
+			r.mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				return
+			}
+			r.mu.Lock()
+			if start, ok := r.connectStart[addr]; ok {
+				r.connectDone = time.Now()
+				r.durations[PhaseConnect] = r.connectDone.Sub(start)
+				r.seen = true
+			}
+			r.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			r.mu.Lock()
+			r.tlsStart = time.Now()
+			r.mu.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err != nil {
+				return
+			}
+			r.mu.Lock()
+			if !r.tlsStart.IsZero() {
+				r.durations[PhaseTLS] = time.Since(r.tlsStart)
+				r.seen = true
+			}
+			r.mu.Unlock()
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			r.mu.Lock()
+			r.wroteRequest = time.Now()
+			r.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			r.mu.Lock()
+			if !r.wroteRequest.IsZero() {
+				r.durations[PhaseTTFB] = time.Since(r.wroteRequest)
+				r.seen = true
+			}
+			r.mu.Unlock()
+		},
+	}
+}
+
+// recordHop notes how long it took to reach a chain hop. Only the first
+// connection of a request is kept.
+func (r *phaseRecorder) recordHop(hop int, d time.Duration) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.hopReached == nil {
+		r.hopReached = make(map[int]time.Duration)
+	}
+	if _, ok := r.hopReached[hop]; !ok {
+		r.hopReached[hop] = d
+	}
+}
+
+// hopLatencies returns, for n hops, the time each one added on top of the
+// hops before it; nil when the request did not go through a chain.
+func (r *phaseRecorder) hopLatencies(n int) []int64 {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.hopReached) == 0 {
+		return nil
+	}
+	out := make([]int64, n)
+	var previous time.Duration
+	for i := range out {
+		reached, ok := r.hopReached[i]
+		if !ok {
+			break
+		}
+		out[i] = (reached - previous).Milliseconds()
+		previous = reached
+	}
+	return out
+}
+
+// timings returns the recorded phases, or nil when nothing was measured.
+func (r *phaseRecorder) timings() *PhaseTimings {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.seen {
+		return nil
+	}
+	return &PhaseTimings{
+		ConnectMS:   r.durations[PhaseConnect].Milliseconds(),
+		HandshakeMS: r.durations[PhaseHandshake].Milliseconds(),
+		TunnelMS:    r.durations[PhaseTunnel].Milliseconds(),
+		TLSMS:       r.durations[PhaseTLS].Milliseconds(),
+		TTFBMS:      r.durations[PhaseTTFB].Milliseconds(),
+	}
+}
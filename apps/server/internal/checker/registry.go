@@ -0,0 +1,146 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/proxy"
+)
+
+// DefaultProber is the judge-based check performed by CheckProxyWithOptions.
+const DefaultProber = "standard"
+
+// Prober checks one proxy. Probers are registered by name so callers can
+// choose one per request.
+type Prober interface {
+	Probe(ctx context.Context, target ProxyTarget, opts CheckOptions) ProxyResult
+}
+
+// ProberFunc adapts a function to the Prober interface.
+type ProberFunc func(ctx context.Context, target ProxyTarget, opts CheckOptions) ProxyResult
+
+func (f ProberFunc) Probe(ctx context.Context, target ProxyTarget, opts CheckOptions) ProxyResult {
+	return f(ctx, target, opts)
+}
+
+// ProtocolDialer returns a dialer that opens tunnels through a proxy speaking
+// one protocol. forward is how the proxy itself is reached; resolver is for
+// protocols that resolve destination names locally.
+type ProtocolDialer func(target ProxyTarget, resolver *net.Resolver, forward proxy.ContextDialer) (proxy.ContextDialer, error)
+
+var (
+	registryMu sync.RWMutex
+	probers    = make(map[string]Prober)
+	protocols  = make(map[string]ProtocolDialer)
+)
+
+func init() {
+	RegisterProber(DefaultProber, ProberFunc(CheckProxyWithOptions))
+
+	// socks5 hands destination names to the proxy unless the check asked
+	// for local resolution; socks5h always does. socks4 cannot carry a name,
+	// so it resolves locally, and socks4a hands names over.
+	socks5 := func(remoteDNS bool) ProtocolDialer {
+		return func(target ProxyTarget, resolver *net.Resolver, forward proxy.ContextDialer) (proxy.ContextDialer, error) {
+			if remoteDNS || !target.localDNS {
+				return newSOCKS5Dialer(target, true, forward), nil
+			}
+			return newSOCKS5Dialer(target, false, forward).withResolver(resolver), nil
+		}
+	}
+	socks4 := func(remoteDNS bool) ProtocolDialer {
+		return func(target ProxyTarget, resolver *net.Resolver, forward proxy.ContextDialer) (proxy.ContextDialer, error) {
+			if remoteDNS {
+				return newSOCKS4Dialer(target, true, forward), nil
+			}
+			return newSOCKS4Dialer(target, false, forward).withResolver(resolver), nil
+		}
+	}
+	RegisterProtocol("socks5", socks5(false))
+	RegisterProtocol("socks", socks5(false))
+	RegisterProtocol("socks5h", socks5(true))
+	RegisterProtocol("socks4", socks4(false))
+	RegisterProtocol("socks4a", socks4(true))
+
+	// HTTP proxies are tunnelled with CONNECT wherever a raw connection is
+	// needed; buildTransport still sends plain requests to them directly.
+	httpConnect := func(target ProxyTarget, _ *net.Resolver, forward proxy.ContextDialer) (proxy.ContextDialer, error) {
+		return contextDialer(httpConnectDialFunc(target, forward)), nil
+	}
+	RegisterProtocol("http", httpConnect)
+	RegisterProtocol("https", httpConnect)
+}
+
+// RegisterProber makes a prober available under name. It panics if the name
+// is empty or already taken, so it is meant to be called from init.
+func RegisterProber(name string, p Prober) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || p == nil {
+		panic("checker: RegisterProber needs a name and a prober")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := probers[name]; dup {
+		panic("checker: RegisterProber called twice for " + name)
+	}
+	probers[name] = p
+}
+
+// LookupProber returns the prober registered under name; an empty name means
+// DefaultProber.
+func LookupProber(name string) (Prober, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = DefaultProber
+	}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	p, ok := probers[name]
+	return p, ok
+}
+
+// ProberNames lists the registered probers in alphabetical order.
+func ProberNames() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(probers))
+	for name := range probers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// RegisterProtocol makes a proxy protocol usable in targets, chains included.
+// It panics if the name is empty or already taken.
+func RegisterProtocol(name string, d ProtocolDialer) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || d == nil {
+		panic("checker: RegisterProtocol needs a name and a dialer")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := protocols[name]; dup {
+		panic("checker: RegisterProtocol called twice for " + name)
+	}
+	protocols[name] = d
+}
+
+// protocolDialFunc returns the registered dialer for the target's protocol.
+func protocolDialFunc(target ProxyTarget, resolver *net.Resolver, forward proxy.ContextDialer) (dialFunc, error) {
+	registryMu.RLock()
+	d, ok := protocols[strings.ToLower(target.Protocol)]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, errors.New("unsupported proxy protocol")
+	}
+	dialer, err := d(target, resolver, forward)
+	if err != nil {
+		return nil, err
+	}
+	return dialer.DialContext, nil
+}
@@ -0,0 +1,70 @@
+package checker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+func TestLookupProber(t *testing.T) {
+	if _, ok := LookupProber(""); !ok {
+		t.Fatal("expected the default prober for an empty name")
+	}
+	if _, ok := LookupProber("Standard"); !ok {
+		t.Fatal("expected lookups to ignore case")
+	}
+	if _, ok := LookupProber("missing"); ok {
+		t.Fatal("expected an unknown prober to be reported")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a duplicate registration to panic")
+		}
+	}()
+	RegisterProber(DefaultProber, ProberFunc(CheckProxyWithOptions))
+}
+
+var (
+	registerTestProtocol sync.Once
+	testProtocolDials    atomic.Int32
+)
+
+func TestRegisterProtocol(t *testing.T) {
+	judge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("203.0.113.5"))
+	}))
+	defer judge.Close()
+	proxyAddr, _ := startSOCKS5Server(t, "", "", 0x00)
+
+	// A custom scheme that happens to speak SOCKS5 with remote resolution.
+	registerTestProtocol.Do(func() {
+		RegisterProtocol("test-custom", func(target ProxyTarget, _ *net.Resolver, forward proxy.ContextDialer) (proxy.ContextDialer, error) {
+			testProtocolDials.Add(1)
+			return newSOCKS5Dialer(target, true, forward), nil
+		})
+	})
+	before := testProtocolDials.Load()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	target, err := ParseProxyLine("test-custom://"+proxyAddr, "")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	result := CheckProxy(ctx, target, judge.URL, nil)
+	if !result.Status || result.Protocol != "test-custom" {
+		t.Fatalf("expected the registered protocol to be used, got %+v", result)
+	}
+	if testProtocolDials.Load() == before {
+		t.Error("expected the registered dialer to be called")
+	}
+}
@@ -0,0 +1,149 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+const (
+	// MaxSamples caps the judge attempts a single check may make.
+	MaxSamples = 10
+	// maxSampleBackoff bounds the base delay between attempts.
+	maxSampleBackoff = 5 * time.Second
+)
+
+// Verdicts of a multi-sample check.
+const (
+	VerdictOK    = "ok"
+	VerdictFlaky = "flaky"
+	VerdictDead  = "dead"
+)
+
+// SamplePolicy controls how many times the judge is queried through a proxy.
+// A proxy whose success ratio is below FlakyMin is dead, one below FlakyMax
+// is flaky and anything else is ok.
+type SamplePolicy struct {
+	Samples   int     `json:"samples,omitempty"`
+	BackoffMS int     `json:"backoff_ms,omitempty"`
+	FlakyMin  float64 `json:"flaky_min,omitempty"`
+	FlakyMax  float64 `json:"flaky_max,omitempty"`
+}
+
+// SampleStats summarises the attempts of a multi-sample check. Latencies
+// only cover successful attempts.
+type SampleStats struct {
+	Attempts     int     `json:"attempts"`
+	Successes    int     `json:"successes"`
+	SuccessRatio float64 `json:"success_ratio"`
+	MinMS        int64   `json:"min_ms,omitempty"`
+	MedianMS     int64   `json:"median_ms,omitempty"`
+	P95MS        int64   `json:"p95_ms,omitempty"`
+	Verdict      string  `json:"verdict"`
+}
+
+// SampleOverride changes a SamplePolicy field by field. Nil fields keep the
+// policy's value, so zero can be asked for.
+type SampleOverride struct {
+	Samples   *int     `json:"samples"`
+	BackoffMS *int     `json:"backoff_ms"`
+	FlakyMin  *float64 `json:"flaky_min"`
+	FlakyMax  *float64 `json:"flaky_max"`
+}
+
+// Override returns p with every field set in o applied.
+func (p SamplePolicy) Override(o SampleOverride) SamplePolicy {
+	if o.Samples != nil {
+		p.Samples = *o.Samples
+	}
+	if o.BackoffMS != nil {
+		p.BackoffMS = *o.BackoffMS
+	}
+	if o.FlakyMin != nil {
+		p.FlakyMin = *o.FlakyMin
+	}
+	if o.FlakyMax != nil {
+		p.FlakyMax = *o.FlakyMax
+	}
+	return p
+}
+
+// ValidateSamplePolicy rejects policies a check should not run with.
+func ValidateSamplePolicy(p SamplePolicy) error {
+	if p.Samples < 1 || p.Samples > MaxSamples {
+		return errors.New("samples must be between 1 and 10")
+	}
+	if p.BackoffMS < 0 || time.Duration(p.BackoffMS)*time.Millisecond > maxSampleBackoff {
+		return errors.New("backoff_ms must be between 0 and 5000")
+	}
+	if p.FlakyMin < 0 || p.FlakyMax > 1 || p.FlakyMin > p.FlakyMax {
+		return errors.New("flaky thresholds must satisfy 0 <= flaky_min <= flaky_max <= 1")
+	}
+	return nil
+}
+
+func (p SamplePolicy) samples() int {
+	return min(max(p.Samples, 1), MaxSamples)
+}
+
+// backoff returns the wait before the given retry (1 for the first): the base
+// delay doubled per retry, jittered to between half and all of it.
+func (p SamplePolicy) backoff(retry int) time.Duration {
+	if p.BackoffMS <= 0 {
+		return 0
+	}
+	d := min(time.Duration(p.BackoffMS)*time.Millisecond<<(retry-1), maxSampleBackoff)
+	return d/2 + rand.N(d/2+1)
+}
+
+func (p SamplePolicy) verdict(ratio float64) string {
+	switch {
+	case ratio == 0 || ratio < p.FlakyMin:
+		return VerdictDead
+	case ratio < p.FlakyMax:
+		return VerdictFlaky
+	default:
+		return VerdictOK
+	}
+}
+
+func (p SamplePolicy) stats(attempts int, latencies []time.Duration) *SampleStats {
+	stats := &SampleStats{Attempts: attempts, Successes: len(latencies)}
+	if attempts > 0 {
+		stats.SuccessRatio = float64(len(latencies)) / float64(attempts)
+	}
+	stats.Verdict = p.verdict(stats.SuccessRatio)
+	if len(latencies) == 0 {
+		return stats
+	}
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+	stats.MinMS = sorted[0].Milliseconds()
+	stats.MedianMS = percentile(sorted, 50).Milliseconds()
+	stats.P95MS = percentile(sorted, 95).Milliseconds()
+	return stats
+}
+
+// percentile uses the nearest-rank method on sorted values.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
+
+// sleepContext waits for d unless ctx ends first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
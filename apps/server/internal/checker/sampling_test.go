@@ -0,0 +1,136 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSamplePolicy_Stats(t *testing.T) {
+	policy := SamplePolicy{Samples: 5, FlakyMin: 0.3, FlakyMax: 1}
+	ms := func(values ...int) []time.Duration {
+		out := make([]time.Duration, len(values))
+		for i, v := range values {
+			out[i] = time.Duration(v) * time.Millisecond
+		}
+		return out
+	}
+
+	cases := []struct {
+		name      string
+		latencies []time.Duration
+		verdict   string
+		min       int64
+		median    int64
+		p95       int64
+	}{
+		{"all_ok", ms(40, 10, 30, 20, 50), VerdictOK, 10, 30, 50},
+		{"flaky", ms(80, 20), VerdictFlaky, 20, 20, 80},
+		{"dead", ms(15), VerdictDead, 15, 15, 15},
+		{"none", nil, VerdictDead, 0, 0, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := policy.stats(5, tc.latencies)
+			if stats.Verdict != tc.verdict {
+				t.Errorf("expected verdict %s, got %s (ratio %.2f)", tc.verdict, stats.Verdict, stats.SuccessRatio)
+			}
+			if stats.MinMS != tc.min || stats.MedianMS != tc.median || stats.P95MS != tc.p95 {
+				t.Errorf("unexpected latencies min %d median %d p95 %d", stats.MinMS, stats.MedianMS, stats.P95MS)
+			}
+		})
+	}
+}
+
+func TestSamplePolicy_OverrideAndValidate(t *testing.T) {
+	defaults := SamplePolicy{Samples: 3, BackoffMS: 200, FlakyMin: 0.3, FlakyMax: 1}
+	samples, backoff, flakyMin, flakyMax := 5, 0, 0.0, 0.9
+	got := defaults.Override(SampleOverride{Samples: &samples, BackoffMS: &backoff, FlakyMin: &flakyMin, FlakyMax: &flakyMax})
+	want := SamplePolicy{Samples: 5, BackoffMS: 0, FlakyMin: 0, FlakyMax: 0.9}
+	if got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	if err := ValidateSamplePolicy(got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := defaults.Override(SampleOverride{}); got != defaults {
+		t.Errorf("expected an empty override to keep %+v, got %+v", defaults, got)
+	}
+
+	invalid := []SamplePolicy{
+		{Samples: 0},
+		{Samples: MaxSamples + 1},
+		{Samples: 3, BackoffMS: 60000},
+		{Samples: 3, FlakyMin: 0.8, FlakyMax: 0.5},
+		{Samples: 3, FlakyMax: 1.5},
+	}
+	for _, p := range invalid {
+		if err := ValidateSamplePolicy(p); err == nil {
+			t.Errorf("expected %+v to be rejected", p)
+		}
+	}
+}
+
+func TestSamplePolicy_Backoff(t *testing.T) {
+	policy := SamplePolicy{BackoffMS: 100}
+	for retry := 1; retry <= 3; retry++ {
+		full := time.Duration(100<<(retry-1)) * time.Millisecond
+		for range 20 {
+			if d := policy.backoff(retry); d < full/2 || d > full {
+				t.Fatalf("retry %d: backoff %v outside [%v, %v]", retry, d, full/2, full)
+			}
+		}
+	}
+	if d := (SamplePolicy{BackoffMS: 4000}).backoff(4); d > maxSampleBackoff {
+		t.Errorf("expected backoff to be capped, got %v", d)
+	}
+}
+
+func TestCheckProxy_SamplingFlaky(t *testing.T) {
+	var requests atomic.Int32
+	judge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1)%2 == 0 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("203.0.113.5"))
+	}))
+	defer judge.Close()
+	proxyAddr, connects := startSOCKS5Server(t, "", "", 0x00)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := CheckProxyWithOptions(ctx, ProxyTarget{Address: proxyAddr, Protocol: "socks5"}, CheckOptions{
+		JudgeURL: judge.URL,
+		Sampling: SamplePolicy{Samples: 4, BackoffMS: 1, FlakyMin: 0.25, FlakyMax: 1},
+	})
+	if !result.Status {
+		t.Fatalf("expected a flaky proxy to stay usable, got error %q", result.Error)
+	}
+	stats := result.Sampling
+	if stats == nil {
+		t.Fatal("expected sampling stats")
+	}
+	if stats.Attempts != 4 || stats.Successes != 2 || stats.Verdict != VerdictFlaky {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if result.ExitIP != "203.0.113.5" || result.Latency != stats.MedianMS {
+		t.Errorf("expected exit ip and median latency, got %q %d", result.ExitIP, result.Latency)
+	}
+	if n := len(connects); n != 4 {
+		t.Errorf("expected every attempt to open its own tunnel, got %d", n)
+	}
+	for len(connects) > 0 {
+		<-connects
+	}
+
+	single := CheckProxy(ctx, ProxyTarget{Address: proxyAddr, Protocol: "socks5"}, judge.URL, nil)
+	if single.Sampling != nil {
+		t.Errorf("expected no sampling stats for a single attempt, got %+v", single.Sampling)
+	}
+}
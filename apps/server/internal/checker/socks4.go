@@ -0,0 +1,191 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+const (
+	socks4Version       = 0x04
+	socks4CmdConnect    = 0x01
+	socks4Granted       = 0x5a
+	socks4Rejected      = 0x5b
+	socks4IdentFailed   = 0x5c
+	socks4IdentMismatch = 0x5d
+)
+
+var (
+	ErrSOCKS4IPv6Unsupported = errors.New("socks4: IPv6 destinations are not supported")
+	ErrSOCKS4Network         = errors.New("socks4: only tcp is supported")
+)
+
+// socks4Dialer speaks SOCKS4 and, when remoteDNS is set, the SOCKS4a extension
+// that lets the proxy resolve destination hostnames itself.
+type socks4Dialer struct {
+	proxyAddress string
+	userID       string
+	remoteDNS    bool
+	forward      proxy.ContextDialer
+	resolver     *net.Resolver
+}
+
+func newSOCKS4Dialer(target ProxyTarget, remoteDNS bool, forward proxy.ContextDialer) *socks4Dialer {
+	return &socks4Dialer{
+		proxyAddress: target.Address,
+		userID:       target.Username,
+		remoteDNS:    remoteDNS,
+		forward:      forward,
+		resolver:     net.DefaultResolver,
+	}
+}
+
+// withResolver overrides the resolver used for local name resolution.
+func (d *socks4Dialer) withResolver(resolver *net.Resolver) *socks4Dialer {
+	if resolver != nil {
+		d.resolver = resolver
+	}
+	return d
+}
+
+func (d *socks4Dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+func (d *socks4Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4":
+	default:
+		return nil, ErrSOCKS4Network
+	}
+
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("socks4: invalid port %q", portStr)
+	}
+
+	var destIP net.IP
+	if parsed := net.ParseIP(host); parsed != nil {
+		destIP = parsed.To4()
+		if destIP == nil {
+			return nil, ErrSOCKS4IPv6Unsupported
+		}
+	} else if !d.remoteDNS {
+		addrs, err := d.resolver.LookupIP(ctx, "ip4", host)
+		if err != nil {
+			return nil, fmt.Errorf("socks4: resolve %s: %w", host, err)
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("socks4: no IPv4 address for %s", host)
+		}
+		destIP = addrs[0].To4()
+	}
+
+	conn, err := d.forward.DialContext(ctx, "tcp", d.proxyAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.handshake(ctx, conn, destIP, host, port); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (d *socks4Dialer) handshake(ctx context.Context, conn net.Conn, destIP net.IP, host string, port int) (err error) {
+	stop := watchConnContext(ctx, conn)
+	defer func() {
+		if ctxErr := stop(); ctxErr != nil && err != nil {
+			err = ctxErr
+		}
+	}()
+
+	// SOCKS4 has no separate negotiation, so the single request counts as
+	// the tunnel phase.
+	start := time.Now()
+	req := make([]byte, 0, 9+len(d.userID)+len(host)+1)
+	req = append(req, socks4Version, socks4CmdConnect, byte(port>>8), byte(port))
+	if destIP != nil {
+		req = append(req, destIP...)
+	} else {
+		// SOCKS4a: an invalid 0.0.0.x address signals that the hostname follows the user id.
+		req = append(req, 0, 0, 0, 1)
+	}
+	req = append(req, d.userID...)
+	req = append(req, 0)
+	if destIP == nil {
+		req = append(req, host...)
+		req = append(req, 0)
+	}
+
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("socks4: write request: %w", err)
+	}
+
+	var reply [8]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return fmt.Errorf("socks4: read reply: %w", err)
+	}
+	if reply[0] != 0x00 {
+		return fmt.Errorf("socks4: unexpected reply version %d", reply[0])
+	}
+
+	switch reply[1] {
+	case socks4Granted:
+		phasesFrom(ctx).record(PhaseTunnel, time.Since(start))
+		return nil
+	case socks4Rejected:
+		return errors.New("socks4: request rejected or failed")
+	case socks4IdentFailed:
+		return errors.New("socks4: request rejected, identd unreachable")
+	case socks4IdentMismatch:
+		return errors.New("socks4: request rejected, user id mismatch")
+	default:
+		return fmt.Errorf("socks4: unknown reply code 0x%02x", reply[1])
+	}
+}
+
+// watchConnContext makes blocking reads and writes on conn honour ctx while a
+// handshake is in progress. The returned func stops watching and reports the
+// context error if cancellation interrupted the handshake.
+func watchConnContext(ctx context.Context, conn net.Conn) func() error {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if ctx.Done() == nil {
+		return func() error {
+			_ = conn.SetDeadline(time.Time{})
+			return nil
+		}
+	}
+
+	done := make(chan struct{})
+	errCh := make(chan error, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Unix(1, 0))
+			errCh <- ctx.Err()
+		case <-done:
+			errCh <- nil
+		}
+	}()
+
+	return func() error {
+		close(done)
+		err := <-errCh
+		_ = conn.SetDeadline(time.Time{})
+		return err
+	}
+}
@@ -0,0 +1,188 @@
+package checker
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type socks4Request struct {
+	port   int
+	ip     net.IP
+	userID string
+	host   string
+}
+
+// startSOCKS4Server runs a minimal SOCKS4/4a proxy that records each request
+// and relays the connection to the requested destination.
+func startSOCKS4Server(t *testing.T, reply byte) (string, <-chan socks4Request) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	requests := make(chan socks4Request, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS4(conn, reply, requests)
+		}
+	}()
+
+	return ln.Addr().String(), requests
+}
+
+func serveSOCKS4(conn net.Conn, reply byte, requests chan<- socks4Request) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	if version, err := reader.Peek(1); err != nil || version[0] != socks4Version {
+		return
+	}
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return
+	}
+	userID, err := reader.ReadString(0)
+	if err != nil {
+		return
+	}
+
+	req := socks4Request{
+		port:   int(header[2])<<8 | int(header[3]),
+		ip:     net.IP(header[4:8]),
+		userID: strings.TrimSuffix(userID, "\x00"),
+	}
+	dest := net.JoinHostPort(req.ip.String(), strconv.Itoa(req.port))
+	if header[4] == 0 && header[5] == 0 && header[6] == 0 && header[7] != 0 {
+		host, err := reader.ReadString(0)
+		if err != nil {
+			return
+		}
+		req.host = strings.TrimSuffix(host, "\x00")
+		dest = net.JoinHostPort(req.host, strconv.Itoa(req.port))
+	}
+	requests <- req
+
+	if reply != socks4Granted {
+		_, _ = conn.Write([]byte{0x00, reply, 0, 0, 0, 0, 0, 0})
+		return
+	}
+
+	upstream, err := net.Dial("tcp", dest)
+	if err != nil {
+		_, _ = conn.Write([]byte{0x00, socks4Rejected, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	_, _ = conn.Write([]byte{0x00, socks4Granted, 0, 0, 0, 0, 0, 0})
+
+	go func() { _, _ = io.Copy(upstream, reader) }()
+	_, _ = io.Copy(conn, upstream)
+}
+
+func TestSOCKS4Dialer_ConnectByIP(t *testing.T) {
+	judge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("127.0.0.1"))
+	}))
+	defer judge.Close()
+
+	proxyAddr, requests := startSOCKS4Server(t, socks4Granted)
+	target := ProxyTarget{Address: proxyAddr, Protocol: "socks4", Username: "tester"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := CheckProxy(ctx, target, judge.URL, nil)
+	if !result.Status {
+		t.Fatalf("expected socks4 check to succeed, got error %q", result.Error)
+	}
+	if result.Protocol != "socks4" {
+		t.Errorf("expected protocol socks4, got %s", result.Protocol)
+	}
+
+	req := <-requests
+	if req.userID != "tester" {
+		t.Errorf("expected user id tester, got %q", req.userID)
+	}
+	if req.host != "" {
+		t.Errorf("expected no hostname for plain socks4, got %q", req.host)
+	}
+	if !req.ip.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("expected destination 127.0.0.1, got %s", req.ip)
+	}
+}
+
+func TestSOCKS4aDialer_SendsHostname(t *testing.T) {
+	judge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer judge.Close()
+
+	_, judgePort, _ := net.SplitHostPort(strings.TrimPrefix(judge.URL, "http://"))
+	proxyAddr, requests := startSOCKS4Server(t, socks4Granted)
+	target := ProxyTarget{Address: proxyAddr, Protocol: "socks4a"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := CheckProxy(ctx, target, "http://localhost:"+judgePort, nil)
+	if !result.Status {
+		t.Fatalf("expected socks4a check to succeed, got error %q", result.Error)
+	}
+
+	req := <-requests
+	if req.host != "localhost" {
+		t.Errorf("expected proxy to receive hostname localhost, got %q", req.host)
+	}
+}
+
+func TestSOCKS4Dialer_Rejected(t *testing.T) {
+	proxyAddr, _ := startSOCKS4Server(t, socks4Rejected)
+	dialer := newSOCKS4Dialer(ProxyTarget{Address: proxyAddr}, false, &net.Dialer{Timeout: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, err := dialer.DialContext(ctx, "tcp", "127.0.0.1:80")
+	if err == nil {
+		t.Fatal("expected rejected request to fail")
+	}
+	if !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSOCKS4Dialer_RejectsIPv6Destination(t *testing.T) {
+	dialer := newSOCKS4Dialer(ProxyTarget{Address: "127.0.0.1:1080"}, false, &net.Dialer{Timeout: time.Second})
+
+	_, err := dialer.DialContext(context.Background(), "tcp", "[2001:db8::1]:80")
+	if err != ErrSOCKS4IPv6Unsupported {
+		t.Fatalf("expected ErrSOCKS4IPv6Unsupported, got %v", err)
+	}
+}
+
+func TestBuildTransport_SOCKS4(t *testing.T) {
+	for _, proto := range []string{"socks4", "SOCKS4A"} {
+		transport, err := buildTransport(ProxyTarget{Address: "127.0.0.1:1080", Protocol: proto}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", proto, err)
+		}
+		if transport.DialContext == nil {
+			t.Errorf("expected DialContext to be set for %s transport", proto)
+		}
+	}
+}
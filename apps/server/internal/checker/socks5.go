@@ -0,0 +1,249 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+const (
+	socks5Version       = 0x05
+	socks5AuthNone      = 0x00
+	socks5AuthPassword  = 0x02
+	socks5AuthNoAccept  = 0xff
+	socks5CmdConnect    = 0x01
+	socks5AddrIPv4      = 0x01
+	socks5AddrDomain    = 0x03
+	socks5AddrIPv6      = 0x04
+	socks5PasswordAuthV = 0x01
+)
+
+var socks5ReplyErrors = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+var ErrSOCKS5Network = errors.New("socks5: only tcp is supported")
+
+// socks5Dialer is a SOCKS5 client that times the method negotiation and
+// authentication separately from the CONNECT request so checks can report
+// handshake and tunnel cost on their own.
+type socks5Dialer struct {
+	proxyAddress string
+	username     string
+	password     string
+	remoteDNS    bool
+	forward      proxy.ContextDialer
+	resolver     *net.Resolver
+}
+
+func newSOCKS5Dialer(target ProxyTarget, remoteDNS bool, forward proxy.ContextDialer) *socks5Dialer {
+	return &socks5Dialer{
+		proxyAddress: target.Address,
+		username:     target.Username,
+		password:     target.Password,
+		remoteDNS:    remoteDNS,
+		forward:      forward,
+		resolver:     net.DefaultResolver,
+	}
+}
+
+// withResolver overrides the resolver used for local name resolution.
+func (d *socks5Dialer) withResolver(resolver *net.Resolver) *socks5Dialer {
+	if resolver != nil {
+		d.resolver = resolver
+	}
+	return d
+}
+
+func (d *socks5Dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+func (d *socks5Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, ErrSOCKS5Network
+	}
+
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("socks5: invalid port %q", portStr)
+	}
+
+	var destIP net.IP
+	if parsed := net.ParseIP(host); parsed != nil {
+		destIP = parsed
+	} else if !d.remoteDNS {
+		addrs, err := d.resolver.LookupIP(ctx, "ip", host)
+		if err != nil {
+			return nil, fmt.Errorf("socks5: resolve %s: %w", host, err)
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("socks5: no address for %s", host)
+		}
+		// Prefer IPv4, which every proxy can reach.
+		destIP = addrs[0]
+		for _, addr := range addrs {
+			if addr.To4() != nil {
+				destIP = addr
+				break
+			}
+		}
+	}
+
+	conn, err := d.forward.DialContext(ctx, "tcp", d.proxyAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.handshake(ctx, conn, destIP, host, port); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (d *socks5Dialer) handshake(ctx context.Context, conn net.Conn, destIP net.IP, host string, port int) (err error) {
+	stop := watchConnContext(ctx, conn)
+	defer func() {
+		if ctxErr := stop(); ctxErr != nil && err != nil {
+			err = ctxErr
+		}
+	}()
+
+	phases := phasesFrom(ctx)
+	start := time.Now()
+	if err := d.authenticate(conn); err != nil {
+		return err
+	}
+	phases.record(PhaseHandshake, time.Since(start))
+
+	start = time.Now()
+	if err := d.connect(conn, destIP, host, port); err != nil {
+		return err
+	}
+	phases.record(PhaseTunnel, time.Since(start))
+	return nil
+}
+
+func (d *socks5Dialer) authenticate(conn net.Conn) error {
+	greeting := []byte{socks5Version, 1, socks5AuthNone}
+	if d.username != "" || d.password != "" {
+		greeting = []byte{socks5Version, 2, socks5AuthNone, socks5AuthPassword}
+	}
+	if _, err := conn.Write(greeting); err != nil {
+		return fmt.Errorf("socks5: write greeting: %w", err)
+	}
+
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return fmt.Errorf("socks5: read method: %w", err)
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("socks5: unexpected version %d", reply[0])
+	}
+
+	switch reply[1] {
+	case socks5AuthNone:
+		return nil
+	case socks5AuthPassword:
+		if len(d.username) > 255 || len(d.password) > 255 {
+			return errors.New("socks5: credentials too long")
+		}
+		req := make([]byte, 0, 3+len(d.username)+len(d.password))
+		req = append(req, socks5PasswordAuthV, byte(len(d.username)))
+		req = append(req, d.username...)
+		req = append(req, byte(len(d.password)))
+		req = append(req, d.password...)
+		if _, err := conn.Write(req); err != nil {
+			return fmt.Errorf("socks5: write credentials: %w", err)
+		}
+		if _, err := io.ReadFull(conn, reply[:]); err != nil {
+			return fmt.Errorf("socks5: read auth status: %w", err)
+		}
+		if reply[1] != 0x00 {
+			return errors.New("socks5: username/password authentication failed")
+		}
+		return nil
+	case socks5AuthNoAccept:
+		return errors.New("socks5: no acceptable authentication methods")
+	default:
+		return fmt.Errorf("socks5: unsupported authentication method 0x%02x", reply[1])
+	}
+}
+
+func (d *socks5Dialer) connect(conn net.Conn, destIP net.IP, host string, port int) error {
+	req := []byte{socks5Version, socks5CmdConnect, 0x00}
+	switch {
+	case destIP.To4() != nil:
+		req = append(req, socks5AddrIPv4)
+		req = append(req, destIP.To4()...)
+	case destIP != nil:
+		req = append(req, socks5AddrIPv6)
+		req = append(req, destIP.To16()...)
+	default:
+		if len(host) > 255 {
+			return fmt.Errorf("socks5: hostname too long: %s", host)
+		}
+		req = append(req, socks5AddrDomain, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("socks5: write request: %w", err)
+	}
+
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return fmt.Errorf("socks5: read reply: %w", err)
+	}
+	if header[0] != socks5Version {
+		return fmt.Errorf("socks5: unexpected reply version %d", header[0])
+	}
+	if header[1] != 0x00 {
+		if msg, ok := socks5ReplyErrors[header[1]]; ok {
+			return errors.New("socks5: " + msg)
+		}
+		return fmt.Errorf("socks5: unknown reply code 0x%02x", header[1])
+	}
+
+	var skip int
+	switch header[3] {
+	case socks5AddrIPv4:
+		skip = net.IPv4len
+	case socks5AddrIPv6:
+		skip = net.IPv6len
+	case socks5AddrDomain:
+		var length [1]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return fmt.Errorf("socks5: read bound address: %w", err)
+		}
+		skip = int(length[0])
+	default:
+		return fmt.Errorf("socks5: unknown bound address type 0x%02x", header[3])
+	}
+	// Bound address and port are not needed for CONNECT.
+	if _, err := io.CopyN(io.Discard, conn, int64(skip+2)); err != nil {
+		return fmt.Errorf("socks5: read bound address: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package checker
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type socks5Request struct {
+	host string
+	port int
+}
+
+// startSOCKS5Server runs a minimal SOCKS5 proxy. When user is set it requires
+// username/password authentication; reply is the CONNECT reply code.
+func startSOCKS5Server(t *testing.T, user, pass string, reply byte) (string, <-chan socks5Request) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	requests := make(chan socks5Request, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS5(conn, user, pass, reply, requests, nil)
+		}
+	}()
+	return ln.Addr().String(), requests
+}
+
+// serveSOCKS5 handles one client. Destination names are resolved with resolver
+// (the system resolver when nil).
+func serveSOCKS5(conn net.Conn, user, pass string, reply byte, requests chan<- socks5Request, resolver *net.Resolver) {
+	defer conn.Close()
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil || header[0] != socks5Version {
+		return
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+
+	if user == "" {
+		_, _ = conn.Write([]byte{socks5Version, socks5AuthNone})
+	} else {
+		_, _ = conn.Write([]byte{socks5Version, socks5AuthPassword})
+		buf := make([]byte, 2)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		gotUser := make([]byte, buf[1])
+		_, _ = io.ReadFull(conn, gotUser)
+		_, _ = io.ReadFull(conn, buf[:1])
+		gotPass := make([]byte, buf[0])
+		_, _ = io.ReadFull(conn, gotPass)
+		if string(gotUser) != user || string(gotPass) != pass {
+			_, _ = conn.Write([]byte{socks5PasswordAuthV, 0x01})
+			return
+		}
+		_, _ = conn.Write([]byte{socks5PasswordAuthV, 0x00})
+	}
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return
+	}
+	var host string
+	switch req[3] {
+	case socks5AddrIPv4:
+		addr := make([]byte, net.IPv4len)
+		_, _ = io.ReadFull(conn, addr)
+		host = net.IP(addr).String()
+	case socks5AddrIPv6:
+		addr := make([]byte, net.IPv6len)
+		_, _ = io.ReadFull(conn, addr)
+		host = net.IP(addr).String()
+	case socks5AddrDomain:
+		length := make([]byte, 1)
+		_, _ = io.ReadFull(conn, length)
+		name := make([]byte, length[0])
+		_, _ = io.ReadFull(conn, name)
+		host = string(name)
+	}
+	portBytes := make([]byte, 2)
+	_, _ = io.ReadFull(conn, portBytes)
+	port := int(portBytes[0])<<8 | int(portBytes[1])
+	requests <- socks5Request{host: host, port: port}
+
+	if reply != 0x00 {
+		_, _ = conn.Write([]byte{socks5Version, reply, 0, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+
+	dialer := &net.Dialer{Resolver: resolver}
+	upstream, err := dialer.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		_, _ = conn.Write([]byte{socks5Version, 0x05, 0, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	_, _ = conn.Write([]byte{socks5Version, 0x00, 0, socks5AddrIPv4, 127, 0, 0, 1, 0x04, 0x38})
+
+	go func() { _, _ = io.Copy(upstream, conn) }()
+	_, _ = io.Copy(conn, upstream)
+}
+
+func TestSOCKS5Dialer_AuthAndPhases(t *testing.T) {
+	judge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("127.0.0.1"))
+	}))
+	defer judge.Close()
+
+	_, judgePort, _ := net.SplitHostPort(strings.TrimPrefix(judge.URL, "http://"))
+	proxyAddr, requests := startSOCKS5Server(t, "alice", "secret", 0x00)
+	target := ProxyTarget{Address: proxyAddr, Protocol: "socks5h", Username: "alice", Password: "secret"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := CheckProxy(ctx, target, "http://localhost:"+judgePort, nil)
+	if !result.Status {
+		t.Fatalf("expected socks5h check to succeed, got error %q", result.Error)
+	}
+	if result.Phases == nil {
+		t.Fatal("expected phase timings to be reported")
+	}
+
+	req := <-requests
+	if req.host != "localhost" {
+		t.Errorf("expected hostname to be resolved by the proxy, got %q", req.host)
+	}
+}
+
+func TestSOCKS5Dialer_LocalResolution(t *testing.T) {
+	judge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("127.0.0.1"))
+	}))
+	defer judge.Close()
+
+	_, judgePort, _ := net.SplitHostPort(strings.TrimPrefix(judge.URL, "http://"))
+	proxyAddr, requests := startSOCKS5Server(t, "", "", 0x00)
+	target := ProxyTarget{Address: proxyAddr, Protocol: "socks5"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_ = CheckProxy(ctx, target, "http://localhost:"+judgePort, nil)
+	req := <-requests
+	if req.host != "localhost" {
+		t.Errorf("expected socks5 to send the hostname by default, got %q", req.host)
+	}
+
+	_ = CheckProxyWithOptions(ctx, target, CheckOptions{JudgeURL: "http://localhost:" + judgePort, LocalDNS: true})
+	req = <-requests
+	if net.ParseIP(req.host) == nil {
+		t.Errorf("expected socks5 with LocalDNS to send a resolved address, got %q", req.host)
+	}
+}
+
+func TestSOCKS5Dialer_Errors(t *testing.T) {
+	cases := []struct {
+		name   string
+		user   string
+		target ProxyTarget
+		reply  byte
+		want   string
+	}{
+		{"bad_credentials", "alice", ProxyTarget{Username: "alice", Password: "wrong"}, 0x00, "authentication failed"},
+		{"connection_refused", "", ProxyTarget{}, 0x05, "connection refused"},
+		{"ruleset", "", ProxyTarget{}, 0x02, "not allowed"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			proxyAddr, _ := startSOCKS5Server(t, tc.user, "secret", tc.reply)
+			tc.target.Address = proxyAddr
+			dialer := newSOCKS5Dialer(tc.target, true, &net.Dialer{Timeout: time.Second})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			_, err := dialer.DialContext(ctx, "tcp", "127.0.0.1:80")
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestPhaseRecorder_Timings(t *testing.T) {
+	var nilRecorder *phaseRecorder
+	nilRecorder.record(PhaseHandshake, time.Second)
+	if nilRecorder.timings() != nil {
+		t.Error("expected nil recorder to report no timings")
+	}
+
+	ctx, rec := withPhaseTrace(context.Background())
+	if rec.timings() != nil {
+		t.Error("expected no timings before anything is recorded")
+	}
+	phasesFrom(ctx).record(PhaseHandshake, 15*time.Millisecond)
+	phasesFrom(ctx).record(PhaseTunnel, 30*time.Millisecond)
+
+	timings := rec.timings()
+	if timings == nil || timings.HandshakeMS != 15 || timings.TunnelMS != 30 || timings.TLSMS != 0 {
+		t.Errorf("unexpected timings: %+v", timings)
+	}
+}
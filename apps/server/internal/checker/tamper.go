@@ -0,0 +1,220 @@
+package checker
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// fixtureCacheTTL is how long a direct fixture response is trusted as the
+	// reference before it is fetched again.
+	fixtureCacheTTL  = 10 * time.Minute
+	fixtureBodyLimit = 256 << 10
+)
+
+// fixtureHeaders are set by the fixture endpoint and are commonly removed by
+// proxies that rewrite pages. Only those present in the direct response are
+// compared.
+var fixtureHeaders = []string{
+	"Content-Security-Policy",
+	"Strict-Transport-Security",
+	"X-Content-Type-Options",
+	"X-Frame-Options",
+	"Referrer-Policy",
+	"Cache-Control",
+	"X-Fixture-Checksum",
+}
+
+// TamperResult compares fixture pages fetched through the proxy with the same
+// pages fetched directly. Flags are nil when the comparison they need could
+// not be made.
+type TamperResult struct {
+	// InjectsContent is set when a body differs from the direct response.
+	InjectsContent *bool `json:"injects_content,omitempty"`
+	// StripsHeaders is set when fixture headers went missing.
+	StripsHeaders *bool `json:"strips_headers,omitempty"`
+	// MITMTLS is set when the TLS fixture was reached with a certificate
+	// other than the one the server presents directly.
+	MITMTLS *bool `json:"mitm_tls,omitempty"`
+	// LengthDelta is the proxied body length minus the direct one.
+	LengthDelta    int      `json:"length_delta,omitempty"`
+	MissingHeaders []string `json:"missing_headers,omitempty"`
+	Error          string   `json:"error,omitempty"`
+}
+
+type fixtureSnapshot struct {
+	sum     [32]byte
+	length  int
+	headers http.Header
+	// leaf is the SHA-256 fingerprint of the server certificate, zero for
+	// plain HTTP.
+	leaf [32]byte
+}
+
+type fixtureEntry struct {
+	mu       sync.Mutex
+	snapshot fixtureSnapshot
+	fetched  time.Time
+}
+
+// fixtureCache keeps the direct response per fixture URL so only the proxied
+// side is fetched on every check.
+type fixtureCache struct {
+	mu      sync.Mutex
+	entries map[string]*fixtureEntry
+}
+
+var fixtures = &fixtureCache{entries: make(map[string]*fixtureEntry)}
+
+func (f *fixtureCache) lookup(ctx context.Context, rawURL string, roots *x509.CertPool) (fixtureSnapshot, error) {
+	f.mu.Lock()
+	entry, ok := f.entries[rawURL]
+	if !ok {
+		entry = &fixtureEntry{}
+		f.entries[rawURL] = entry
+	}
+	f.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if !entry.fetched.IsZero() && time.Since(entry.fetched) < fixtureCacheTTL {
+		return entry.snapshot, nil
+	}
+
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig:    &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12},
+			DisableCompression: true,
+		},
+	}
+	defer client.CloseIdleConnections()
+	snapshot, err := fetchFixture(ctx, client, rawURL)
+	if err != nil {
+		return fixtureSnapshot{}, fmt.Errorf("direct fixture: %w", err)
+	}
+	entry.snapshot = snapshot
+	entry.fetched = time.Now()
+	return snapshot, nil
+}
+
+func fetchFixture(ctx context.Context, client *http.Client, rawURL string) (fixtureSnapshot, error) {
+	var snap fixtureSnapshot
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return snap, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return snap, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return snap, fmt.Errorf("fixture returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, fixtureBodyLimit))
+	if err != nil {
+		return snap, err
+	}
+
+	snap.sum = sha256.Sum256(body)
+	snap.length = len(body)
+	snap.headers = make(http.Header)
+	for _, name := range fixtureHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			snap.headers.Set(name, value)
+		}
+	}
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		snap.leaf = sha256.Sum256(resp.TLS.PeerCertificates[0].Raw)
+	}
+	return snap, nil
+}
+
+// compare folds the differences between a proxied and a direct fixture
+// response into r.
+func (r *TamperResult) compare(direct, proxied fixtureSnapshot) {
+	if r.InjectsContent == nil {
+		r.InjectsContent, r.StripsHeaders = boolPtr(false), boolPtr(false)
+	}
+	if proxied.sum != direct.sum {
+		*r.InjectsContent = true
+		r.LengthDelta = proxied.length - direct.length
+	}
+	for _, name := range fixtureHeaders {
+		if direct.headers.Get(name) == "" || proxied.headers.Get(name) != "" {
+			continue
+		}
+		*r.StripsHeaders = true
+		if !slices.Contains(r.MissingHeaders, name) {
+			r.MissingHeaders = append(r.MissingHeaders, name)
+		}
+	}
+}
+
+// checkTamper fetches the plain and TLS fixtures through the proxy. client
+// carries the proxy transport; the TLS fixture goes through a transport of its
+// own that accepts any certificate, so a substituted one can be fingerprinted
+// instead of just failing verification.
+func checkTamper(ctx context.Context, client *http.Client, target ProxyTarget, resolver *net.Resolver, fixtureURL, tlsFixtureURL string, roots *x509.CertPool) *TamperResult {
+	res := &TamperResult{}
+	var errs []string
+
+	if fixtureURL != "" {
+		direct, err := fixtures.lookup(ctx, fixtureURL, roots)
+		if err == nil {
+			var proxied fixtureSnapshot
+			if proxied, err = fetchFixture(ctx, client, fixtureURL); err == nil {
+				res.compare(direct, proxied)
+			}
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if tlsFixtureURL != "" {
+		if err := res.checkTLSFixture(ctx, target, resolver, tlsFixtureURL, roots); err != nil {
+			errs = append(errs, "tls: "+err.Error())
+		}
+	}
+
+	res.Error = strings.Join(errs, "; ")
+	return res
+}
+
+func (r *TamperResult) checkTLSFixture(ctx context.Context, target ProxyTarget, resolver *net.Resolver, rawURL string, roots *x509.CertPool) error {
+	direct, err := fixtures.lookup(ctx, rawURL, roots)
+	if err != nil {
+		return err
+	}
+
+	transport, err := buildTransport(target, resolver)
+	if err != nil {
+		return err
+	}
+	defer transport.CloseIdleConnections()
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// The fingerprint comparison below replaces chain verification.
+		InsecureSkipVerify: true,
+	}
+
+	proxied, err := fetchFixture(ctx, &http.Client{Transport: transport, Timeout: 10 * time.Second}, rawURL)
+	if err != nil {
+		return err
+	}
+	r.MITMTLS = boolPtr(proxied.leaf != direct.leaf)
+	r.compare(direct, proxied)
+	return nil
+}
@@ -0,0 +1,137 @@
+package checker
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func fixtureHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><body>fixture</body></html>"))
+	})
+}
+
+// startTamperingProxy is an HTTP proxy that appends to every page, drops
+// X-Frame-Options and sends CONNECT tunnels to impostor instead of the
+// requested host.
+func startTamperingProxy(t *testing.T, impostor string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect {
+			upstream, err := net.Dial("tcp", impostor)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			defer upstream.Close()
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+			go func() { _, _ = io.Copy(upstream, conn) }()
+			_, _ = io.Copy(conn, upstream)
+			return
+		}
+
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		body = append(body, []byte("<script src=//ads.example></script>")...)
+		for name, values := range resp.Header {
+			if name != "X-Frame-Options" && name != "Content-Length" {
+				w.Header()[name] = values
+			}
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, bytes.NewReader(body))
+	}))
+	t.Cleanup(server.Close)
+	return server.Listener.Addr().String()
+}
+
+func TestCheckProxy_Tamper(t *testing.T) {
+	judge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("203.0.113.5"))
+	}))
+	defer judge.Close()
+	fixture := httptest.NewServer(fixtureHandler())
+	defer fixture.Close()
+	tlsFixture := httptest.NewTLSServer(fixtureHandler())
+	defer tlsFixture.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(tlsFixture.Certificate())
+
+	impostor := httptest.NewUnstartedServer(fixtureHandler())
+	impostor.TLS = &tls.Config{Certificates: []tls.Certificate{selfSignedCert(t)}}
+	impostor.StartTLS()
+	defer impostor.Close()
+
+	honest, _ := startSOCKS5Server(t, "", "", 0x00)
+	tampering := startTamperingProxy(t, impostor.Listener.Addr().String())
+
+	cases := []struct {
+		name     string
+		target   ProxyTarget
+		injects  bool
+		strips   bool
+		mitm     bool
+		stripped string
+	}{
+		{"honest", ProxyTarget{Address: honest, Protocol: "socks5"}, false, false, false, ""},
+		{"tampering", ProxyTarget{Address: tampering, Protocol: "http"}, true, true, true, "X-Frame-Options"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			result := CheckProxyWithOptions(ctx, tc.target, CheckOptions{
+				JudgeURL:      judge.URL,
+				FixtureURL:    fixture.URL,
+				TLSFixtureURL: tlsFixture.URL,
+				TLSRootCAs:    roots,
+			})
+			if !result.Status || result.Tamper == nil {
+				t.Fatalf("expected a tamper result, got status %v error %q", result.Status, result.Error)
+			}
+			tamper := result.Tamper
+			if tamper.Error != "" {
+				t.Fatalf("unexpected tamper error %q", tamper.Error)
+			}
+			if tamper.InjectsContent == nil || *tamper.InjectsContent != tc.injects ||
+				tamper.StripsHeaders == nil || *tamper.StripsHeaders != tc.strips {
+				t.Errorf("unexpected flags: injects %v strips %v", tamper.InjectsContent, tamper.StripsHeaders)
+			}
+			if tamper.MITMTLS == nil || *tamper.MITMTLS != tc.mitm {
+				t.Errorf("expected mitm_tls %v, got %v", tc.mitm, tamper.MITMTLS)
+			}
+			if tc.stripped != "" && (len(tamper.MissingHeaders) != 1 || tamper.MissingHeaders[0] != tc.stripped) {
+				t.Errorf("expected %s to be reported missing, got %v", tc.stripped, tamper.MissingHeaders)
+			}
+			if tc.injects && tamper.LengthDelta <= 0 {
+				t.Errorf("expected a positive length delta, got %d", tamper.LengthDelta)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxTargets caps the custom targets a single check may visit.
+	MaxTargets = 10
+	// targetBodyLimit bounds how much of a target's body is searched for the
+	// expected substrings.
+	targetBodyLimit = 256 << 10
+)
+
+// TargetCheck is a site the proxy must reach, with the expectations its
+// response has to meet. Zero values fall back to a 2xx status, no body
+// requirements and no latency limit.
+type TargetCheck struct {
+	URL          string `json:"url"`
+	StatusMin    int    `json:"status_min,omitempty"`
+	StatusMax    int    `json:"status_max,omitempty"`
+	Contains     string `json:"contains,omitempty"`
+	NotContains  string `json:"not_contains,omitempty"`
+	MaxLatencyMS int64  `json:"max_latency_ms,omitempty"`
+}
+
+// TargetResult reports one TargetCheck. Failures lists every expectation the
+// response missed; Error is set when no response arrived at all.
+type TargetResult struct {
+	URL       string   `json:"url"`
+	Pass      bool     `json:"pass"`
+	Status    int      `json:"status,omitempty"`
+	LatencyMS int64    `json:"latency_ms"`
+	Failures  []string `json:"failures,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// statusRange returns the accepted status codes. A lone minimum means that
+// exact code.
+func (t TargetCheck) statusRange() (int, int) {
+	lo, hi := t.StatusMin, t.StatusMax
+	if lo == 0 && hi == 0 {
+		return 200, 299
+	}
+	if lo == 0 {
+		lo = 100
+	}
+	if hi == 0 {
+		hi = lo
+	}
+	return lo, hi
+}
+
+// ValidateTargets rejects target lists the checker will not run.
+func ValidateTargets(targets []TargetCheck) error {
+	if len(targets) > MaxTargets {
+		return fmt.Errorf("too many targets (max %d)", MaxTargets)
+	}
+	for _, t := range targets {
+		parsed, err := url.Parse(t.URL)
+		if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return fmt.Errorf("invalid target url %q", t.URL)
+		}
+		lo, hi := t.statusRange()
+		if lo < 100 || hi > 599 || lo > hi {
+			return fmt.Errorf("invalid status range for %q", t.URL)
+		}
+		if t.MaxLatencyMS < 0 {
+			return errors.New("max_latency_ms must not be negative")
+		}
+	}
+	return nil
+}
+
+// checkTargets visits every target in order through client. They share the
+// proxy transport, so connections to a repeated host are reused rather than
+// set up again.
+func checkTargets(ctx context.Context, client *http.Client, targets []TargetCheck) []TargetResult {
+	results := make([]TargetResult, 0, len(targets))
+	for _, t := range targets {
+		results = append(results, checkTarget(ctx, client, t))
+	}
+	return results
+}
+
+func checkTarget(ctx context.Context, client *http.Client, t TargetCheck) TargetResult {
+	res := TargetResult{URL: t.URL}
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.URL, nil)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, targetBodyLimit))
+	res.LatencyMS = time.Since(start).Milliseconds()
+	res.Status = resp.StatusCode
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	if lo, hi := t.statusRange(); resp.StatusCode < lo || resp.StatusCode > hi {
+		res.Failures = append(res.Failures, fmt.Sprintf("status %d outside %d-%d", resp.StatusCode, lo, hi))
+	}
+	if t.Contains != "" && !strings.Contains(string(body), t.Contains) {
+		res.Failures = append(res.Failures, fmt.Sprintf("body does not contain %q", t.Contains))
+	}
+	if t.NotContains != "" && strings.Contains(string(body), t.NotContains) {
+		res.Failures = append(res.Failures, fmt.Sprintf("body contains %q", t.NotContains))
+	}
+	if t.MaxLatencyMS > 0 && res.LatencyMS > t.MaxLatencyMS {
+		res.Failures = append(res.Failures, fmt.Sprintf("latency %dms over %dms", res.LatencyMS, t.MaxLatencyMS))
+	}
+	res.Pass = len(res.Failures) == 0
+	return res
+}
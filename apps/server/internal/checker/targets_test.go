@@ -0,0 +1,94 @@
+package checker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestValidateTargets(t *testing.T) {
+	valid := []TargetCheck{
+		{URL: "https://example.com/"},
+		{URL: "http://example.com/health", StatusMin: 200, StatusMax: 399, MaxLatencyMS: 1500},
+	}
+	if err := ValidateTargets(valid); err != nil {
+		t.Fatalf("expected valid targets, got %v", err)
+	}
+
+	invalid := [][]TargetCheck{
+		{{URL: "ftp://example.com/"}},
+		{{URL: "example.com"}},
+		{{URL: "https://example.com/", StatusMin: 500, StatusMax: 200}},
+		{{URL: "https://example.com/", StatusMax: 700}},
+		{{URL: "https://example.com/", MaxLatencyMS: -1}},
+		make([]TargetCheck, MaxTargets+1),
+	}
+	for i, targets := range invalid {
+		if err := ValidateTargets(targets); err == nil {
+			t.Errorf("case %d: expected an error", i)
+		}
+	}
+}
+
+func TestCheckProxy_Targets(t *testing.T) {
+	judge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("203.0.113.5"))
+	}))
+	defer judge.Close()
+
+	var conns atomic.Int32
+	site := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			_, _ = w.Write([]byte("welcome to the store"))
+		case "/blocked":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("access denied"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	site.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	site.Start()
+	defer site.Close()
+
+	proxyAddr, _ := startSOCKS5Server(t, "", "", 0x00)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := CheckProxyWithOptions(ctx, ProxyTarget{Address: proxyAddr, Protocol: "socks5"}, CheckOptions{
+		JudgeURL: judge.URL,
+		Targets: []TargetCheck{
+			{URL: site.URL + "/ok", Contains: "store", NotContains: "captcha"},
+			{URL: site.URL + "/blocked", NotContains: "denied"},
+			{URL: site.URL + "/missing", StatusMin: 404},
+		},
+	})
+	if !result.Status {
+		t.Fatalf("expected check to succeed, got error %q", result.Error)
+	}
+	if len(result.Targets) != 3 {
+		t.Fatalf("expected 3 target results, got %d", len(result.Targets))
+	}
+
+	if ok := result.Targets[0]; !ok.Pass || ok.Status != http.StatusOK {
+		t.Errorf("expected /ok to pass, got %+v", ok)
+	}
+	if blocked := result.Targets[1]; blocked.Pass || len(blocked.Failures) != 2 {
+		t.Errorf("expected /blocked to fail on status and body, got %+v", blocked)
+	}
+	if missing := result.Targets[2]; !missing.Pass || missing.Status != http.StatusNotFound {
+		t.Errorf("expected /missing to pass with an exact 404, got %+v", missing)
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("expected targets to share one connection, got %d", n)
+	}
+}
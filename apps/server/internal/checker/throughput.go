@@ -0,0 +1,75 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ThroughputResult reports a payload download through the proxy.
+type ThroughputResult struct {
+	Bytes      int64   `json:"bytes"`
+	KBps       float64 `json:"kbps"`
+	DurationMS int64   `json:"duration_ms"`
+	Completed  bool    `json:"completed"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// measureThroughput downloads size bytes from the payload endpoint through
+// client. The rate is computed from the first response byte to the end of the
+// body so connection setup, which the phase timings already cover, does not
+// drag it down. The pooled client's timeout bounds the whole transfer; a
+// proxy too slow to finish still reports the rate it managed.
+func measureThroughput(ctx context.Context, client *http.Client, payloadURL string, size int64) *ThroughputResult {
+	res := &ThroughputResult{}
+
+	target, err := url.Parse(payloadURL)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	query := target.Query()
+	query.Set("size", strconv.FormatInt(size, 10))
+	target.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		res.Error = fmt.Sprintf("payload endpoint returned status %d", resp.StatusCode)
+		return res
+	}
+
+	expected := size
+	if resp.ContentLength > 0 && resp.ContentLength < expected {
+		expected = resp.ContentLength
+	}
+
+	start := time.Now()
+	res.Bytes, err = io.Copy(io.Discard, io.LimitReader(resp.Body, expected))
+	elapsed := time.Since(start)
+
+	res.DurationMS = elapsed.Milliseconds()
+	if elapsed > 0 {
+		res.KBps = float64(int64(float64(res.Bytes)/1024/elapsed.Seconds()*10)) / 10
+	}
+	res.Completed = err == nil && res.Bytes == expected
+	if err != nil {
+		res.Error = err.Error()
+	} else if !res.Completed {
+		res.Error = fmt.Sprintf("transfer ended after %d of %d bytes", res.Bytes, expected)
+	}
+	return res
+}
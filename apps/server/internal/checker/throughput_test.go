@@ -0,0 +1,59 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCheckProxyWithOptions_Throughput(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/judge", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("127.0.0.1"))
+	})
+	mux.HandleFunc("/payload", func(w http.ResponseWriter, r *http.Request) {
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+		_, _ = w.Write(make([]byte, size))
+	})
+	mux.HandleFunc("/short", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", r.URL.Query().Get("size"))
+		_, _ = w.Write(make([]byte, 100))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	proxyAddr, _ := startSOCKS5Server(t, "", "", 0x00)
+	target := ProxyTarget{Address: proxyAddr, Protocol: "socks5"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := CheckProxyWithOptions(ctx, target, CheckOptions{
+		JudgeURL:        srv.URL + "/judge",
+		ThroughputURL:   srv.URL + "/payload",
+		ThroughputBytes: 64 << 10,
+	})
+	if !result.Status {
+		t.Fatalf("expected check to succeed, got %q", result.Error)
+	}
+	if result.Throughput == nil || !result.Throughput.Completed || result.Throughput.Bytes != 64<<10 {
+		t.Fatalf("expected completed 64KB transfer, got %+v", result.Throughput)
+	}
+
+	result = CheckProxyWithOptions(ctx, target, CheckOptions{
+		JudgeURL:        srv.URL + "/judge",
+		ThroughputURL:   srv.URL + "/short",
+		ThroughputBytes: 4096,
+	})
+	if result.Throughput == nil || result.Throughput.Completed || result.Throughput.Bytes != 100 {
+		t.Errorf("expected truncated transfer to be reported, got %+v", result.Throughput)
+	}
+
+	result = CheckProxyWithOptions(ctx, target, CheckOptions{JudgeURL: srv.URL + "/judge"})
+	if result.Throughput != nil {
+		t.Errorf("expected no throughput result without opt-in, got %+v", result.Throughput)
+	}
+}
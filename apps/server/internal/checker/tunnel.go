@@ -0,0 +1,180 @@
+package checker
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// tunnelResult is the outcome of a CONNECT + TLS probe through an HTTP proxy.
+type tunnelResult struct {
+	connect  bool
+	tls      bool
+	tampered bool
+	err      error
+}
+
+func (t tunnelResult) apply(result *ProxyResult) {
+	result.SupportsConnect = boolPtr(t.connect)
+	result.SupportsTLS = boolPtr(t.tls)
+	if t.connect {
+		result.TLSTampered = boolPtr(t.tampered)
+	}
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func isHTTPProxy(protocol string) bool {
+	return protocol == "http" || protocol == "https"
+}
+
+// checkConnectTunnel asks an HTTP proxy to CONNECT to the TLS judge, performs
+// the TLS handshake itself and fetches the judge over the tunnel. The server
+// certificate is verified separately from the handshake so that a proxy which
+// substitutes its own certificate is reported as tampering rather than just
+// failing.
+func checkConnectTunnel(ctx context.Context, target ProxyTarget, judgeURL string, roots *x509.CertPool) (res tunnelResult) {
+	judge, err := url.Parse(judgeURL)
+	if err != nil || judge.Scheme != "https" || judge.Hostname() == "" {
+		res.err = fmt.Errorf("invalid TLS judge url %q", judgeURL)
+		return res
+	}
+	serverName := judge.Hostname()
+	authority := judge.Host
+	if judge.Port() == "" {
+		authority = net.JoinHostPort(serverName, "443")
+	}
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", target.Address)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	defer conn.Close()
+
+	stop := watchConnContext(ctx, conn)
+	defer func() {
+		if ctxErr := stop(); ctxErr != nil && res.err != nil {
+			res.err = ctxErr
+		}
+	}()
+
+	connectReq := newConnectRequest(authority, target)
+	if err := connectReq.Write(conn); err != nil {
+		res.err = fmt.Errorf("write CONNECT: %w", err)
+		return res
+	}
+
+	reader := bufio.NewReader(conn)
+	connectResp, err := http.ReadResponse(reader, connectReq)
+	if err != nil {
+		res.err = fmt.Errorf("read CONNECT response: %w", err)
+		return res
+	}
+	connectResp.Body.Close()
+	if connectResp.StatusCode != http.StatusOK {
+		res.err = fmt.Errorf("CONNECT rejected with status %d", connectResp.StatusCode)
+		return res
+	}
+	res.connect = true
+
+	tlsConn := tls.Client(&bufferedConn{Conn: conn, reader: reader}, &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+		// Verification happens in VerifyConnection so a substituted chain can
+		// be told apart from a broken tunnel.
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			res.tampered = !verifyChain(state, serverName, roots)
+			return nil
+		},
+	})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		res.err = fmt.Errorf("tls handshake: %w", err)
+		return res
+	}
+	if res.tampered {
+		res.err = fmt.Errorf("certificate for %s failed verification", serverName)
+		return res
+	}
+
+	judgeReq, err := http.NewRequestWithContext(ctx, http.MethodGet, judgeURL, nil)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	judgeReq.Close = true
+	if err := judgeReq.Write(tlsConn); err != nil {
+		res.err = fmt.Errorf("write judge request: %w", err)
+		return res
+	}
+	judgeResp, err := http.ReadResponse(bufio.NewReader(tlsConn), judgeReq)
+	if err != nil {
+		res.err = fmt.Errorf("read judge response: %w", err)
+		return res
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(judgeResp.Body, judgeBodyLimit))
+	judgeResp.Body.Close()
+
+	res.tls = judgeResp.StatusCode >= 200 && judgeResp.StatusCode < 300
+	if !res.tls {
+		res.err = fmt.Errorf("TLS judge returned status %d", judgeResp.StatusCode)
+	}
+	return res
+}
+
+func newConnectRequest(authority string, target ProxyTarget) *http.Request {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: authority},
+		Host:   authority,
+		Header: make(http.Header),
+	}
+	setProxyAuth(req, target)
+	return req
+}
+
+func setProxyAuth(req *http.Request, target ProxyTarget) {
+	if target.Username != "" || target.Password != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(target.Username + ":" + target.Password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+}
+
+func verifyChain(state tls.ConnectionState, serverName string, roots *x509.CertPool) bool {
+	if len(state.PeerCertificates) == 0 {
+		return false
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err == nil
+}
+
+// bufferedConn hands bytes the CONNECT response reader may have buffered to
+// the TLS client before reading from the connection again.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
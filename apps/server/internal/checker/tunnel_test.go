@@ -0,0 +1,196 @@
+package checker
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startHTTPProxy runs a minimal forward proxy. CONNECT requests are tunnelled
+// to redirect when set (simulating a MITM box) or to the requested authority;
+// plain requests are answered directly with the loopback address.
+func startHTTPProxy(t *testing.T, allowConnect bool, redirect string) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveHTTPProxy(conn, allowConnect, redirect)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveHTTPProxy(conn net.Conn, allowConnect bool, redirect string) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	// Drop binary handshakes straight away instead of waiting for a request line.
+	if first, err := reader.Peek(1); err != nil || first[0] < 'A' || first[0] > 'Z' {
+		return
+	}
+	req, err := http.ReadRequest(reader)
+	if err != nil {
+		return
+	}
+
+	if req.Method != http.MethodConnect {
+		_, _ = io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 9\r\nConnection: close\r\n\r\n127.0.0.1")
+		return
+	}
+	if !allowConnect {
+		_, _ = io.WriteString(conn, "HTTP/1.1 405 Method Not Allowed\r\nContent-Length: 0\r\n\r\n")
+		return
+	}
+
+	dest := req.Host
+	if redirect != "" {
+		dest = redirect
+	}
+	upstream, err := net.Dial("tcp", dest)
+	if err != nil {
+		_, _ = io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\n\r\n")
+		return
+	}
+	defer upstream.Close()
+	_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+	go func() { _, _ = io.Copy(upstream, reader) }()
+	_, _ = io.Copy(conn, upstream)
+}
+
+func tlsJudge(t *testing.T) (*httptest.Server, *x509.CertPool) {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ip":"127.0.0.1","headers":{}}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	return srv, roots
+}
+
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mitm.invalid"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestCheckConnectTunnel(t *testing.T) {
+	judge, roots := tlsJudge(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	proxyAddr := startHTTPProxy(t, true, "")
+	res := checkConnectTunnel(ctx, ProxyTarget{Address: proxyAddr, Protocol: "http"}, judge.URL, roots)
+	if !res.connect || !res.tls || res.tampered || res.err != nil {
+		t.Fatalf("expected clean tunnel, got %+v", res)
+	}
+}
+
+func TestCheckConnectTunnel_Rejected(t *testing.T) {
+	judge, roots := tlsJudge(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	proxyAddr := startHTTPProxy(t, false, "")
+	res := checkConnectTunnel(ctx, ProxyTarget{Address: proxyAddr, Protocol: "http"}, judge.URL, roots)
+	if res.connect || res.tls {
+		t.Fatalf("expected CONNECT to be refused, got %+v", res)
+	}
+	if res.err == nil || !strings.Contains(res.err.Error(), "405") {
+		t.Errorf("expected status in error, got %v", res.err)
+	}
+}
+
+func TestCheckConnectTunnel_DetectsCertificateTampering(t *testing.T) {
+	judge, roots := tlsJudge(t)
+	// httptest servers share one certificate, so the impostor needs its own.
+	impostor := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("intercepted"))
+	}))
+	impostor.TLS = &tls.Config{Certificates: []tls.Certificate{selfSignedCert(t)}}
+	impostor.StartTLS()
+	defer impostor.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	proxyAddr := startHTTPProxy(t, true, impostor.Listener.Addr().String())
+	res := checkConnectTunnel(ctx, ProxyTarget{Address: proxyAddr, Protocol: "http"}, judge.URL, roots)
+	if !res.connect || res.tls || !res.tampered {
+		t.Fatalf("expected tampering to be detected, got %+v", res)
+	}
+}
+
+func TestCheckProxyWithOptions_ReportsTunnelSupport(t *testing.T) {
+	judge, roots := tlsJudge(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	proxyAddr := startHTTPProxy(t, true, "")
+	result := CheckProxyWithOptions(ctx, ProxyTarget{Address: proxyAddr, Protocol: "http"}, CheckOptions{
+		JudgeURL:    "http://judge.invalid/",
+		TLSJudgeURL: judge.URL,
+		TLSRootCAs:  roots,
+	})
+	if !result.Status {
+		t.Fatalf("expected plain check to succeed, got %q", result.Error)
+	}
+	if result.SupportsConnect == nil || !*result.SupportsConnect {
+		t.Errorf("expected supports_connect=true, got %v", result.SupportsConnect)
+	}
+	if result.SupportsTLS == nil || !*result.SupportsTLS {
+		t.Errorf("expected supports_tls=true, got %v (%s)", result.SupportsTLS, result.TLSError)
+	}
+	if result.TLSTampered == nil || *result.TLSTampered {
+		t.Errorf("expected tls_tampered=false, got %v", result.TLSTampered)
+	}
+
+	socks := CheckProxyWithOptions(ctx, ProxyTarget{Address: "127.0.0.1:1", Protocol: "socks5"}, CheckOptions{
+		JudgeURL:    "http://judge.invalid/",
+		TLSJudgeURL: judge.URL,
+	})
+	if socks.SupportsConnect != nil {
+		t.Errorf("expected tunnel check to be skipped for socks5")
+	}
+}
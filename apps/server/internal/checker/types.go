@@ -7,16 +7,56 @@ type ProxyTarget struct {
 	Protocol string
 	Username string
 	Password string
+	// Chain lists further proxies this one tunnels through, in order; the
+	// last one is where traffic exits.
+	Chain []ProxyTarget
+	// localDNS makes a socks5 hop resolve destination names itself.
+	localDNS bool
 }
 
 type ProxyResult struct {
-	IP        string `json:"ip"`
-	Port      string `json:"port"`
-	Protocol  string `json:"protocol"`
-	Status    bool   `json:"status"`
-	Latency   int64  `json:"latency"`
-	Country   string `json:"country"`
-	Anonymity string `json:"anonymity"`
+	IP       string `json:"ip"`
+	Port     string `json:"port"`
+	Protocol string `json:"protocol"`
+	// Protocols lists every protocol detected when checking in "auto" mode.
+	Protocols []string `json:"protocols,omitempty"`
+	Status    bool     `json:"status"`
+	Latency   int64    `json:"latency"`
+	Country   string   `json:"country"`
+	Anonymity string   `json:"anonymity"`
+	Anon      int      `json:"anon"`
+	ExitIP    string   `json:"exit_ip,omitempty"`
+	// IPVersion is the address family of the proxy itself (4 or 6).
+	IPVersion int `json:"ip_version,omitempty"`
+	// Exit addresses per family and a summary (ipv4, ipv6 or dual), set when
+	// single-stack judges are configured.
+	ExitIPv4 string `json:"exit_ipv4,omitempty"`
+	ExitIPv6 string `json:"exit_ipv6,omitempty"`
+	Egress   string `json:"egress,omitempty"`
+	// EntryGeo locates the address the proxy was reached on, ExitGeo the
+	// address the judge saw. ExitDiffers is set when the two addresses differ.
+	EntryGeo    *GeoInfo `json:"entry_geo,omitempty"`
+	ExitGeo     *GeoInfo `json:"exit_geo,omitempty"`
+	ExitDiffers bool     `json:"exit_differs,omitempty"`
+
+	// Sampling is set when the judge was queried more than once; Latency is
+	// then the median of the successful attempts.
+	Sampling   *SampleStats      `json:"sampling,omitempty"`
+	Phases     *PhaseTimings     `json:"phases,omitempty"`
+	Throughput *ThroughputResult `json:"throughput,omitempty"`
+	DNS        *DNSResult        `json:"dns,omitempty"`
+	Tamper     *TamperResult     `json:"tamper,omitempty"`
+	// Hops reports each proxy of a chain; Latency stays end to end.
+	Hops []HopResult `json:"hops,omitempty"`
+	// Targets reports the custom target checks, in request order.
+	Targets []TargetResult `json:"targets,omitempty"`
+
+	// Set for HTTP proxies when a TLS judge is configured.
+	SupportsConnect *bool  `json:"supports_connect,omitempty"`
+	SupportsTLS     *bool  `json:"supports_tls,omitempty"`
+	TLSTampered     *bool  `json:"tls_tampered,omitempty"`
+	TLSError        string `json:"tls_error,omitempty"`
+
 	CheckedAt string `json:"checkedAt"`
 	Error     string `json:"error,omitempty"`
 }
@@ -10,31 +10,66 @@ import (
 )
 
 type Config struct {
-	Port                    string
-	RedisAddr               string
-	RedisPassword           string
-	RedisDB                 int
-	DatabasePath            string
-	DatabaseURL             string
-	DatabaseSchema          string
-	JudgeURL                string
-	GeoIPPath               string
-	GeoIPASNPath            string
-	ProxyListPath           string
-	ProxySourceURL          string
-	ProxySyncInterval       time.Duration
-	ProxyWebCacheTTL        time.Duration
-	ProxyAPICacheTTL        time.Duration
-	ProxyListWindowHours    int
-	ProxyStatsWindowHours   int
-	ProxyRetentionHours     int
-	APIKeys                 []string
+	Port                  string
+	RedisAddr             string
+	RedisPassword         string
+	RedisDB               int
+	DatabasePath          string
+	DatabaseURL           string
+	DatabaseSchema        string
+	JudgeURL              string
+	JudgeURLs             []string
+	JudgeConsensus        bool
+	JudgeHealthInterval   time.Duration
+	TLSJudgeURL           string
+	IPv4JudgeURL          string
+	IPv6JudgeURL          string
+	DNSProbeZone          string
+	DNSProbeListen        string
+	DNSProbeTarget        string
+	FixtureURL            string
+	TLSFixtureURL         string
+	CheckSamples          int
+	CheckSampleBackoff    time.Duration
+	CheckFlakyMin         float64
+	CheckFlakyMax         float64
+	ThroughputURL         string
+	ThroughputMaxKB       RateLimitTier
+	GeoIPPath             string
+	GeoIPASNPath          string
+	ASNClassPath          string
+	ProxyListPath         string
+	ProxySourceURL        string
+	ProxySyncInterval     time.Duration
+	ProxyWebCacheTTL      time.Duration
+	ProxyAPICacheTTL      time.Duration
+	ProxyListWindowHours  int
+	ProxyStatsWindowHours int
+	ProxyRetentionHours   int
+	APIKeys               []string
+	// APIKeyTiers assigns API keys a tier; unlisted keys are basic.
+	APIKeyTiers             map[string]string
 	APIRateLimitHour        int
 	APIRateLimitWindow      time.Duration
 	APIRateLimitLight       int
 	APIRateLimitStandard    int
 	APIRateLimitHeavy       int
 	MaxConcurrent           int
+	CheckWorkers            int
+	CheckClientQueue        int
+	PoliteSubnetConcurrency int
+	PoliteASNConcurrency    int
+	CheckJobTTL             time.Duration
+	CheckJobReplay          int
+	// Per-tier check quotas: proxies per batch, jobs running at once and
+	// proxies checked per day.
+	CheckBatchMax   RateLimitTier
+	CheckJobsMax    RateLimitTier
+	CheckDailyQuota RateLimitTier
+	// Uploaded lists may be larger than a batch: CheckUploadMax caps their
+	// proxies per tier, CheckUploadMaxMB their uncompressed size.
+	CheckUploadMax          RateLimitTier
+	CheckUploadMaxMB        int
 	RateLimitPerDay         int
 	RateLimitTiered         RateLimitTier
 	AllowedOrigins          []string
@@ -66,6 +101,9 @@ type RateLimitTier struct {
 	Pro   int
 }
 
+// defaultFallbackJudges back up JUDGE_URL when JUDGE_URLS is not set.
+const defaultFallbackJudges = "text|https://api.ipify.org?format=text,json|https://httpbin.org/ip"
+
 var (
 	ErrInvalidPort      = fmt.Errorf("invalid port number")
 	ErrInvalidRedisDB   = fmt.Errorf("invalid redis db number")
@@ -81,9 +119,25 @@ func Load() Config {
 		DatabasePath:            getEnv("DB_PATH", "./data/socksproxies.db"),
 		DatabaseURL:             getEnv("DATABASE_URL", ""),
 		DatabaseSchema:          getEnv("DATABASE_SCHEMA", "socksproxies"),
-		JudgeURL:                getEnv("JUDGE_URL", "https://api.ipify.org?format=text"),
+		JudgeURL:                getEnv("JUDGE_URL", "https://api.socks5proxies.com/api/judge"),
+		ThroughputURL:           getEnv("THROUGHPUT_URL", "https://api.socks5proxies.com/api/judge/payload"),
+		TLSJudgeURL:             getEnv("TLS_JUDGE_URL", "https://api.socks5proxies.com/api/judge"),
+		IPv4JudgeURL:            getEnvOptional("JUDGE_IPV4_URL", ""),
+		IPv6JudgeURL:            getEnvOptional("JUDGE_IPV6_URL", ""),
+		DNSProbeZone:            getEnv("DNS_PROBE_ZONE", ""),
+		DNSProbeListen:          getEnv("DNS_PROBE_LISTEN", ":53"),
+		DNSProbeTarget:          getEnv("DNS_PROBE_TARGET", ""),
+		FixtureURL:              getEnvOptional("TAMPER_FIXTURE_URL", "http://api.socks5proxies.com/api/judge/fixture"),
+		TLSFixtureURL:           getEnvOptional("TAMPER_FIXTURE_TLS_URL", "https://api.socks5proxies.com/api/judge/fixture"),
+		CheckSamples:            getEnvInt("CHECK_SAMPLES", 1),
+		CheckSampleBackoff:      getEnvDuration("CHECK_SAMPLE_BACKOFF", 250*time.Millisecond),
+		CheckFlakyMin:           getEnvFloat("CHECK_FLAKY_MIN", 0.3),
+		CheckFlakyMax:           getEnvFloat("CHECK_FLAKY_MAX", 1),
+		JudgeConsensus:          getEnvBool("JUDGE_CONSENSUS", false),
+		JudgeHealthInterval:     getEnvDuration("JUDGE_HEALTH_INTERVAL", time.Minute),
 		GeoIPPath:               getEnv("GEOIP_CITY_DB", getEnv("GEOIP_DB", "")),
 		GeoIPASNPath:            getEnv("GEOIP_ASN_DB", ""),
+		ASNClassPath:            getEnv("ASN_CLASS_FILE", ""),
 		ProxyListPath:           getEnv("PROXY_LIST_PATH", ""),
 		ProxySourceURL:          getEnv("PROXY_SOURCE_URL", ""),
 		ProxySyncInterval:       getEnvDuration("PROXY_SYNC_INTERVAL", 5*time.Minute),
@@ -99,6 +153,12 @@ func Load() Config {
 		APIRateLimitStandard:    getEnvInt("API_RATE_LIMIT_STANDARD", 1200),
 		APIRateLimitHeavy:       getEnvInt("API_RATE_LIMIT_HEAVY", 300),
 		MaxConcurrent:           getEnvInt("MAX_CONCURRENT", 50),
+		CheckWorkers:            getEnvInt("CHECK_WORKERS", 200),
+		CheckClientQueue:        getEnvInt("CHECK_CLIENT_QUEUE", 0),
+		PoliteSubnetConcurrency: getEnvInt("POLITE_SUBNET_CONCURRENCY", 8),
+		PoliteASNConcurrency:    getEnvInt("POLITE_ASN_CONCURRENCY", 32),
+		CheckJobTTL:             getEnvDuration("CHECK_JOB_TTL", 30*time.Minute),
+		CheckJobReplay:          getEnvInt("CHECK_JOB_REPLAY", 1024),
 		RateLimitPerDay:         getEnvInt("RATE_LIMIT_PER_DAY", 100),
 		AllowedOrigins:          getEnvList("ALLOWED_ORIGINS", "*"),
 		TrustedProxies:          getEnvList("TRUSTED_PROXIES", "127.0.0.1,::1"),
@@ -128,6 +188,39 @@ func Load() Config {
 		Pro:   getEnvInt("RATE_LIMIT_PRO", 10000),
 	}
 
+	// JUDGE_URLS entries are "format|url" or bare URLs; see checker.ParseJudge.
+	cfg.JudgeURLs = getEnvList("JUDGE_URLS", cfg.JudgeURL+","+defaultFallbackJudges)
+
+	// Largest throughput test payload a client of each tier may request.
+	cfg.ThroughputMaxKB = RateLimitTier{
+		Free:  getEnvInt("THROUGHPUT_MAX_KB_FREE", 256),
+		Basic: getEnvInt("THROUGHPUT_MAX_KB_BASIC", 2048),
+		Pro:   getEnvInt("THROUGHPUT_MAX_KB_PRO", 10240),
+	}
+
+	cfg.APIKeyTiers = parseAPIKeyTiers(getEnvList("API_KEY_TIERS", ""))
+	cfg.CheckBatchMax = RateLimitTier{
+		Free:  getEnvInt("CHECK_BATCH_MAX_FREE", 500),
+		Basic: getEnvInt("CHECK_BATCH_MAX_BASIC", 2000),
+		Pro:   getEnvInt("CHECK_BATCH_MAX_PRO", 10000),
+	}
+	cfg.CheckJobsMax = RateLimitTier{
+		Free:  getEnvInt("CHECK_JOBS_MAX_FREE", 4),
+		Basic: getEnvInt("CHECK_JOBS_MAX_BASIC", 8),
+		Pro:   getEnvInt("CHECK_JOBS_MAX_PRO", 16),
+	}
+	cfg.CheckDailyQuota = RateLimitTier{
+		Free:  getEnvInt("CHECK_DAILY_QUOTA_FREE", 5000),
+		Basic: getEnvInt("CHECK_DAILY_QUOTA_BASIC", 50000),
+		Pro:   getEnvInt("CHECK_DAILY_QUOTA_PRO", 500000),
+	}
+	cfg.CheckUploadMax = RateLimitTier{
+		Free:  getEnvInt("CHECK_UPLOAD_MAX_FREE", 1000),
+		Basic: getEnvInt("CHECK_UPLOAD_MAX_BASIC", 20000),
+		Pro:   getEnvInt("CHECK_UPLOAD_MAX_PRO", 100000),
+	}
+	cfg.CheckUploadMaxMB = getEnvInt("CHECK_UPLOAD_MAX_MB", 20)
+
 	cfg.WAFEnabled = getEnvBool("WAF_ENABLED", cfg.Environment == "production")
 
 	if err := cfg.Validate(); err != nil {
@@ -181,6 +274,42 @@ func (c *Config) Validate() error {
 		c.MaxConcurrent = 500
 	}
 
+	// The worker pool is shared by every session; each client may queue up
+	// to CheckClientQueue checks, MaxConcurrent unless set.
+	if c.CheckWorkers < 1 {
+		c.CheckWorkers = 200
+	}
+	if c.CheckClientQueue < 1 {
+		c.CheckClientQueue = c.MaxConcurrent
+	}
+
+	// Politeness caps apply across sessions; zero disables one.
+	if c.PoliteSubnetConcurrency < 0 {
+		c.PoliteSubnetConcurrency = 0
+	}
+	if c.PoliteASNConcurrency < 0 {
+		c.PoliteASNConcurrency = 0
+	}
+
+	// Check jobs outlive their connection for CheckJobTTL; the replay buffer
+	// should hold a whole batch (a result and a queued event per proxy).
+	if c.CheckJobTTL < time.Minute {
+		c.CheckJobTTL = 30 * time.Minute
+	}
+	if c.CheckJobReplay < 64 {
+		c.CheckJobReplay = 64
+	}
+	if c.CheckJobReplay > 10000 {
+		c.CheckJobReplay = 10000
+	}
+
+	c.CheckBatchMax = c.CheckBatchMax.clamp(1, 10000)
+	c.CheckJobsMax = c.CheckJobsMax.clamp(1, 100)
+	c.CheckUploadMax = c.CheckUploadMax.clamp(1, 1000000)
+	if c.CheckUploadMaxMB < 1 {
+		c.CheckUploadMaxMB = 20
+	}
+
 	if c.MaxWebSocketConnections < 1 {
 		c.MaxWebSocketConnections = 5
 	}
@@ -223,6 +352,31 @@ func (c *Config) Validate() error {
 		c.SlowRequestThreshold = 0
 	}
 
+	// Sampling: a proxy below CheckFlakyMin is dead, one below CheckFlakyMax
+	// is flaky.
+	if c.CheckSamples < 1 {
+		c.CheckSamples = 1
+	}
+	if c.CheckSamples > 10 {
+		c.CheckSamples = 10
+	}
+	if c.CheckSampleBackoff < 0 {
+		c.CheckSampleBackoff = 0
+	}
+	if c.CheckSampleBackoff > 5*time.Second {
+		c.CheckSampleBackoff = 5 * time.Second
+	}
+	if c.CheckFlakyMax <= 0 || c.CheckFlakyMax > 1 {
+		c.CheckFlakyMax = 1
+	}
+	if c.CheckFlakyMin < 0 || c.CheckFlakyMin > c.CheckFlakyMax {
+		c.CheckFlakyMin = min(0.3, c.CheckFlakyMax)
+	}
+
+	if c.JudgeHealthInterval <= 0 {
+		c.JudgeHealthInterval = time.Minute
+	}
+
 	if c.ExportDir == "" {
 		c.ExportDir = "./data/exports"
 	}
@@ -242,16 +396,49 @@ func (c *Config) IsDevelopment() bool {
 }
 
 func (c *Config) GetRateLimitForTier(tier string) int {
+	return c.RateLimitTiered.ForTier(tier)
+}
+
+// ForTier returns the value for the named tier; unknown tiers get Free.
+func (t RateLimitTier) ForTier(tier string) int {
 	switch strings.ToLower(tier) {
 	case "pro":
-		return c.RateLimitTiered.Pro
+		return t.Pro
 	case "basic":
-		return c.RateLimitTiered.Basic
+		return t.Basic
 	default:
-		return c.RateLimitTiered.Free
+		return t.Free
+	}
+}
+
+func (t RateLimitTier) clamp(lo, hi int) RateLimitTier {
+	return RateLimitTier{
+		Free:  min(max(t.Free, lo), hi),
+		Basic: min(max(t.Basic, lo), hi),
+		Pro:   min(max(t.Pro, lo), hi),
 	}
 }
 
+// parseAPIKeyTiers reads "key=tier" pairs.
+func parseAPIKeyTiers(entries []string) map[string]string {
+	tiers := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		key, tier, ok := strings.Cut(entry, "=")
+		key, tier = strings.TrimSpace(key), strings.ToLower(strings.TrimSpace(tier))
+		if !ok || key == "" {
+			continue
+		}
+		tiers[key] = tier
+	}
+	return tiers
+}
+
+// GetThroughputLimitForTier returns the largest throughput payload, in KB,
+// that a client of the given tier may request. Zero disables the test.
+func (c *Config) GetThroughputLimitForTier(tier string) int {
+	return c.ThroughputMaxKB.ForTier(tier)
+}
+
 func getEnv(key, fallback string) string {
 	if val := os.Getenv(key); val != "" {
 		return val
@@ -259,6 +446,15 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getEnvOptional is getEnv for settings that can be switched off with "off".
+func getEnvOptional(key, fallback string) string {
+	val := getEnv(key, fallback)
+	if strings.EqualFold(strings.TrimSpace(val), "off") {
+		return ""
+	}
+	return val
+}
+
 func getEnvInt(key string, fallback int) int {
 	val := getEnv(key, "")
 	if val == "" {
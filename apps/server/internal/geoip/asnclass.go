@@ -0,0 +1,102 @@
+package geoip
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Network classes an ASN can be assigned to.
+const (
+	ASNClassHosting = "hosting"
+	ASNClassISP     = "isp"
+	ASNClassMobile  = "mobile"
+)
+
+// classAliases maps the names accepted in classification files to classes.
+var classAliases = map[string]string{
+	"hosting":     ASNClassHosting,
+	"datacenter":  ASNClassHosting,
+	"isp":         ASNClassISP,
+	"residential": ASNClassISP,
+	"mobile":      ASNClassMobile,
+	"cellular":    ASNClassMobile,
+}
+
+// ASNClassifier tells hosting networks from consumer ISPs and mobile carriers.
+type ASNClassifier struct {
+	classes map[int]string
+}
+
+// LoadASNClasses reads a classification file: one "asn,class" pair per line,
+// "AS" prefixes allowed, blank lines and "#" comments ignored. Like Load, a
+// missing file disables the feature instead of failing.
+func LoadASNClasses(path string) (*ASNClassifier, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseASNClasses(file)
+}
+
+// ParseASNClasses reads classifications in the LoadASNClasses format.
+func ParseASNClasses(r io.Reader) (*ASNClassifier, error) {
+	c := &ASNClassifier{classes: make(map[int]string)}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected asn,class", line)
+		}
+		raw := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(fields[0])), "AS")
+		asn, err := strconv.Atoi(raw)
+		if err != nil {
+			if line == 1 {
+				// Header row.
+				continue
+			}
+			return nil, fmt.Errorf("line %d: invalid asn %q", line, fields[0])
+		}
+		class, ok := classAliases[strings.ToLower(strings.TrimSpace(fields[1]))]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown class %q", line, fields[1])
+		}
+		c.classes[asn] = class
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Classify returns the class of an ASN, or "" when it is not listed.
+func (c *ASNClassifier) Classify(asn int) string {
+	if c == nil {
+		return ""
+	}
+	return c.classes[asn]
+}
+
+// Len reports how many ASNs are classified.
+func (c *ASNClassifier) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.classes)
+}
@@ -0,0 +1,68 @@
+package geoip
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseASNClasses(t *testing.T) {
+	input := `asn,class
+# cloud providers
+AS16509,hosting
+14061, datacenter
+7922,residential
+21928,Mobile
+`
+	classes, err := ParseASNClasses(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cases := map[int]string{
+		16509: ASNClassHosting,
+		14061: ASNClassHosting,
+		7922:  ASNClassISP,
+		21928: ASNClassMobile,
+		13335: "",
+	}
+	for asn, want := range cases {
+		if got := classes.Classify(asn); got != want {
+			t.Errorf("AS%d: expected %q, got %q", asn, want, got)
+		}
+	}
+	if classes.Len() != 4 {
+		t.Errorf("expected 4 classified ASNs, got %d", classes.Len())
+	}
+}
+
+func TestParseASNClasses_Invalid(t *testing.T) {
+	for name, input := range map[string]string{
+		"missing_class": "16509\n",
+		"bad_asn":       "16509,hosting\nASX,hosting\n",
+		"bad_class":     "16509,satellite\n",
+	} {
+		if _, err := ParseASNClasses(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLoadASNClasses(t *testing.T) {
+	classes, err := LoadASNClasses(filepath.Join(t.TempDir(), "missing.csv"))
+	if err != nil || classes != nil {
+		t.Fatalf("expected a missing file to disable classification, got %v %v", classes, err)
+	}
+	if classes.Classify(16509) != "" {
+		t.Error("expected a nil classifier to know nothing")
+	}
+
+	path := filepath.Join(t.TempDir(), "asn.csv")
+	if err := os.WriteFile(path, []byte("16509,hosting\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	classes, err = LoadASNClasses(path)
+	if err != nil || classes.Classify(16509) != ASNClassHosting {
+		t.Fatalf("expected the file to load, got %v", err)
+	}
+}
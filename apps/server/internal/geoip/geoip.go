@@ -3,6 +3,7 @@ package geoip
 import (
 	"net"
 	"os"
+	"strings"
 
 	"github.com/oschwald/geoip2-golang"
 )
@@ -61,7 +62,7 @@ func (r *Reader) LookupCountry(ip string) string {
 	if r == nil || r.db == nil {
 		return ""
 	}
-	parsed := net.ParseIP(ip)
+	parsed := parseIP(ip)
 	if parsed == nil {
 		return ""
 	}
@@ -83,7 +84,7 @@ func (r *Reader) LookupCity(ip string) CityInfo {
 		return CityInfo{}
 	}
 
-	parsed := net.ParseIP(ip)
+	parsed := parseIP(ip)
 	if parsed == nil {
 		return CityInfo{}
 	}
@@ -112,7 +113,7 @@ func (r *Reader) LookupASN(ip string) ASNInfo {
 		return ASNInfo{}
 	}
 
-	parsed := net.ParseIP(ip)
+	parsed := parseIP(ip)
 	if parsed == nil {
 		return ASNInfo{}
 	}
@@ -129,6 +130,22 @@ func (r *Reader) LookupASN(ip string) ASNInfo {
 	}
 }
 
+// parseIP accepts addresses the way proxies and exports write them:
+// bracketed IPv6 ("[2001:db8::1]"), zoned link-local ("fe80::1%eth0") and
+// IPv4-mapped IPv6, which is looked up as plain IPv4.
+func parseIP(raw string) net.IP {
+	raw = strings.TrimSpace(raw)
+	raw = strings.TrimSuffix(strings.TrimPrefix(raw, "["), "]")
+	if zone := strings.IndexByte(raw, '%'); zone >= 0 {
+		raw = raw[:zone]
+	}
+	parsed := net.ParseIP(raw)
+	if v4 := parsed.To4(); v4 != nil {
+		return v4
+	}
+	return parsed
+}
+
 func (r *Reader) Close() error {
 	if r == nil {
 		return nil
@@ -198,3 +198,23 @@ func TestReader_LookupCountry_IPFormats(t *testing.T) {
 		}
 	}
 }
+
+func TestParseIP(t *testing.T) {
+	cases := map[string]string{
+		"203.0.113.1":        "203.0.113.1",
+		"[2001:db8::1]":      "2001:db8::1",
+		"fe80::1%eth0":       "fe80::1",
+		"::ffff:192.0.2.1":   "192.0.2.1",
+		" 2001:db8::2 ":      "2001:db8::2",
+		"not-an-ip":          "<nil>",
+		"[2001:db8::1]:1080": "<nil>",
+	}
+	for input, want := range cases {
+		if got := parseIP(input).String(); got != want {
+			t.Errorf("parseIP(%q) = %s, want %s", input, got, want)
+		}
+	}
+	if len(parseIP("::ffff:192.0.2.1")) != 4 {
+		t.Error("expected IPv4-mapped address to be reduced to 4 bytes")
+	}
+}
@@ -0,0 +1,91 @@
+package proxylist
+
+import (
+	"net"
+	"strconv"
+
+	"socksproxies.com/server/internal/store"
+)
+
+// ChangeType is how a proxy changed from one sync to the next.
+type ChangeType string
+
+const (
+	ChangeAdded   ChangeType = "added"
+	ChangeRemoved ChangeType = "removed"
+	ChangeUpdated ChangeType = "updated"
+)
+
+// Change is a proxy that entered, left or changed in the source list. Record
+// is the latest known state; for removals, the one from the previous sync.
+type Change struct {
+	Type   ChangeType            `json:"type"`
+	Record store.ProxyListRecord `json:"record"`
+}
+
+// changeTracker compares each sync with the one before. The first sync after
+// start only primes it, since everything would look new.
+type changeTracker struct {
+	previous map[string]store.ProxyListRecord
+	current  map[string]store.ProxyListRecord
+}
+
+func (t *changeTracker) observe(records []store.ProxyListRecord) {
+	if t.current == nil {
+		t.current = make(map[string]store.ProxyListRecord, len(t.previous))
+	}
+	for _, record := range records {
+		t.current[net.JoinHostPort(record.IP, strconv.Itoa(record.Port))] = record
+	}
+}
+
+// reset starts observing a new sync.
+func (t *changeTracker) reset() {
+	t.current = nil
+}
+
+// diff returns what changed since the previous sync and makes the current
+// one the baseline for the next. A sync that read no proxies at all is taken
+// for a bad fetch rather than everything going away.
+func (t *changeTracker) diff() []Change {
+	previous, current := t.previous, t.current
+	if current == nil {
+		return nil
+	}
+	t.previous, t.current = current, nil
+	if previous == nil {
+		return nil
+	}
+
+	var changes []Change
+	for key, record := range current {
+		before, ok := previous[key]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Type: ChangeAdded, Record: record})
+		case recordChanged(before, record):
+			changes = append(changes, Change{Type: ChangeUpdated, Record: record})
+		}
+	}
+	for key, record := range previous {
+		if _, ok := current[key]; !ok {
+			changes = append(changes, Change{Type: ChangeRemoved, Record: record})
+		}
+	}
+	return changes
+}
+
+// recordChanged compares what subscribers filter and sort on; check counters
+// and timestamps move on every sync and are left out.
+func recordChanged(a, b store.ProxyListRecord) bool {
+	return a.Delay != b.Delay ||
+		a.Anon != b.Anon ||
+		a.HTTP != b.HTTP ||
+		a.SSL != b.SSL ||
+		a.Socks4 != b.Socks4 ||
+		a.Socks5 != b.Socks5 ||
+		a.CountryCode != b.CountryCode ||
+		a.City != b.City ||
+		a.Region != b.Region ||
+		a.ASN != b.ASN
+}
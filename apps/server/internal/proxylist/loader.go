@@ -29,7 +29,7 @@ func SeedFromFile(ctx context.Context, st store.Storer, path string, defaultProt
 			continue
 		}
 		parsed, err := checker.ParseProxyLine(line, defaultProtocol)
-		if err != nil {
+		if err != nil || len(parsed.Chain) > 0 {
 			continue
 		}
 		_, _ = st.UpsertProxy(ctx, store.ProxyRecord{Address: parsed.Address, Protocol: parsed.Protocol})
@@ -4,6 +4,7 @@ import (
 	"encoding/csv"
 	"fmt"
 	"io"
+	"net"
 	"strconv"
 	"strings"
 	"time"
@@ -64,10 +65,10 @@ func ParseCSVInBatches(
 			return processed, fmt.Errorf("read row: %w", err)
 		}
 
-		ip := get(row, "ip")
+		ip := normalizeIP(get(row, "ip"))
 		host := get(row, "host")
 		if ip == "" {
-			ip = host
+			ip = normalizeIP(host)
 		}
 
 		port := parseInt(get(row, "port"))
@@ -159,6 +160,22 @@ func parseLastSeen(raw string, now time.Time) time.Time {
 	}
 }
 
+// normalizeIP strips the brackets some feeds put around IPv6 addresses and
+// rewrites address literals in canonical form so the same proxy always maps
+// to the same (ip, port) row. Hostnames are returned unchanged.
+func normalizeIP(raw string) string {
+	raw = strings.TrimSpace(raw)
+	unbracketed := strings.TrimSuffix(strings.TrimPrefix(raw, "["), "]")
+	parsed := net.ParseIP(unbracketed)
+	if parsed == nil {
+		return raw
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.String()
+	}
+	return parsed.String()
+}
+
 func fallback(primary, secondary string) string {
 	if primary != "" {
 		return primary
@@ -79,6 +79,29 @@ func TestParseCSV_IPFallbackFromHost(t *testing.T) {
 	}
 }
 
+func TestParseCSV_IPv6(t *testing.T) {
+	csv := `ip;port;host
+[2001:DB8::1];1080;
+;3128;[2001:db8:0:0::2]
+::ffff:192.0.2.1;8080;`
+
+	records, err := ParseCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+
+	expected := []string{"2001:db8::1", "2001:db8::2", "192.0.2.1"}
+	for i, want := range expected {
+		if records[i].IP != want {
+			t.Errorf("record %d: expected IP %s, got %s", i, want, records[i].IP)
+		}
+	}
+}
+
 func TestParseCSV_SkipsInvalidRows(t *testing.T) {
 	csv := `ip;port;country_code
 192.168.1.1;8080;US
@@ -22,6 +22,9 @@ type SyncConfig struct {
 	Retention      time.Duration
 	RequestTimeout time.Duration
 	AfterSync      func(context.Context)
+	// OnChange, if set, gets the proxies added, removed or updated by each
+	// sync after the first.
+	OnChange func(context.Context, []Change)
 }
 
 type Syncer struct {
@@ -30,6 +33,8 @@ type Syncer struct {
 	redis  *redis.Client
 	geo    *geoip.Reader
 	client *http.Client
+	// changes is only touched by sync, which never runs concurrently.
+	changes changeTracker
 }
 
 func NewSyncer(config SyncConfig, store store.ProxyListStore, redis *redis.Client, geo *geoip.Reader) *Syncer {
@@ -79,6 +84,8 @@ func (s *Syncer) sync(ctx context.Context) error {
 	defer cancel()
 
 	start := time.Now()
+	// Drop whatever a failed sync left half observed.
+	s.changes.reset()
 
 	reader, err := s.fetchCSV(syncCtx)
 	if err != nil {
@@ -93,6 +100,9 @@ func (s *Syncer) sync(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
+		if s.config.OnChange != nil {
+			s.changes.observe(enriched)
+		}
 		updated += count
 		return nil
 	})
@@ -129,6 +139,14 @@ func (s *Syncer) sync(ctx context.Context) error {
 		cancel()
 	}
 
+	if s.config.OnChange != nil {
+		if changes := s.changes.diff(); len(changes) > 0 {
+			changeCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			s.config.OnChange(changeCtx, changes)
+			cancel()
+		}
+	}
+
 	log.Printf("[proxylist] synced %d/%d records in %s", updated, processed, time.Since(start))
 	return nil
 }
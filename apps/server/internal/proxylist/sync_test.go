@@ -479,3 +479,50 @@ func TestSyncer_Start_PeriodicSync(t *testing.T) {
 		t.Errorf("expected at least 2 syncs (initial + periodic), got %d", count)
 	}
 }
+
+func TestSyncer_Sync_OnChange(t *testing.T) {
+	var body atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body.Load().(string)))
+	}))
+	defer server.Close()
+
+	var got [][]Change
+	syncer := NewSyncer(SyncConfig{
+		SourceURL:      server.URL,
+		RequestTimeout: 5 * time.Second,
+		OnChange: func(ctx context.Context, changes []Change) {
+			got = append(got, changes)
+		},
+	}, &mockProxyListStore{}, nil, nil)
+
+	steps := []string{
+		"ip;port;delay\n192.0.2.1;1080;100\n192.0.2.2;1080;200",
+		"ip;port;delay\n192.0.2.1;1080;100\n192.0.2.2;1080;250\n192.0.2.3;8080;300",
+		"ip;port;delay",
+		"ip;port;delay\n192.0.2.2;1080;250\n192.0.2.3;8080;300",
+	}
+	for i, step := range steps {
+		body.Store(step)
+		if err := syncer.sync(context.Background()); err != nil {
+			t.Fatalf("sync %d: %v", i, err)
+		}
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected changes from the second and last syncs only, got %d calls", len(got))
+	}
+	want := map[string]ChangeType{"192.0.2.2": ChangeUpdated, "192.0.2.3": ChangeAdded}
+	if len(got[0]) != len(want) {
+		t.Fatalf("unexpected changes %+v", got[0])
+	}
+	for _, change := range got[0] {
+		if want[change.Record.IP] != change.Type {
+			t.Errorf("unexpected change %s for %s", change.Type, change.Record.IP)
+		}
+	}
+	// An empty fetch is not taken for every proxy going away.
+	if len(got[1]) != 1 || got[1][0].Type != ChangeRemoved || got[1][0].Record.IP != "192.0.2.1" {
+		t.Errorf("expected only 192.0.2.1 removed, got %+v", got[1])
+	}
+}
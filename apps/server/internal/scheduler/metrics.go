@@ -0,0 +1,44 @@
+package scheduler
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Totals across every scheduler in the process.
+	workersTotal atomic.Int64
+	workersBusy  atomic.Int64
+
+	queueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "check_scheduler_queue_depth",
+			Help: "Checks waiting for a scheduler worker.",
+		},
+	)
+	workersBusyGauge = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "check_scheduler_workers_busy",
+			Help: "Scheduler workers currently running a check.",
+		},
+		func() float64 { return float64(workersBusy.Load()) },
+	)
+	workerUtilization = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "check_scheduler_worker_utilization",
+			Help: "Share of scheduler workers currently running a check, between 0 and 1.",
+		},
+		func() float64 {
+			total := workersTotal.Load()
+			if total == 0 {
+				return 0
+			}
+			return float64(workersBusy.Load()) / float64(total)
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(queueDepth, workersBusyGauge, workerUtilization)
+}
@@ -0,0 +1,135 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Caps that can hold a check back.
+const (
+	ReasonSubnet = "subnet"
+	ReasonASN    = "asn"
+)
+
+// Politeness caps how many checks run at once against one network: per /24
+// (/64 for IPv6) and per ASN. One instance is shared by every session so the
+// caps hold across all of them.
+type Politeness struct {
+	perSubnet int
+	perASN    int
+	asn       func(ip string) int
+
+	mu     sync.Mutex
+	active map[string]int
+	// changed is closed and replaced whenever a slot is released.
+	changed chan struct{}
+}
+
+type limitKey struct {
+	name   string
+	limit  int
+	reason string
+}
+
+// NewPoliteness returns a limiter with the given caps; zero disables a cap.
+// asn maps an IP to its ASN (0 when unknown) and may be nil.
+func NewPoliteness(perSubnet, perASN int, asn func(ip string) int) *Politeness {
+	return &Politeness{
+		perSubnet: perSubnet,
+		perASN:    perASN,
+		asn:       asn,
+		active:    make(map[string]int),
+		changed:   make(chan struct{}),
+	}
+}
+
+// Acquire waits until host's subnet and ASN are under their caps and takes a
+// slot in each. When it has to wait, onQueued is called once with the cap
+// that was hit. The returned release must be called when the check is done.
+func (p *Politeness) Acquire(ctx context.Context, host string, onQueued func(reason string)) (func(), error) {
+	keys := p.keys(host)
+	if len(keys) == 0 {
+		return func() {}, nil
+	}
+
+	queued := false
+	for {
+		p.mu.Lock()
+		reason := p.blocked(keys)
+		if reason == "" {
+			for _, key := range keys {
+				p.active[key.name]++
+			}
+			p.mu.Unlock()
+			var once sync.Once
+			return func() { once.Do(func() { p.release(keys) }) }, nil
+		}
+		wait := p.changed
+		p.mu.Unlock()
+
+		if !queued {
+			queued = true
+			if onQueued != nil {
+				onQueued(reason)
+			}
+		}
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (p *Politeness) blocked(keys []limitKey) string {
+	for _, key := range keys {
+		if p.active[key.name] >= key.limit {
+			return key.reason
+		}
+	}
+	return ""
+}
+
+func (p *Politeness) release(keys []limitKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, key := range keys {
+		if p.active[key.name]--; p.active[key.name] <= 0 {
+			delete(p.active, key.name)
+		}
+	}
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// keys returns the caps that apply to host. Hostnames are capped on their
+// own since their network is unknown until the proxy is dialled.
+func (p *Politeness) keys(host string) []limitKey {
+	if p == nil || host == "" {
+		return nil
+	}
+	var keys []limitKey
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	if p.perSubnet > 0 {
+		keys = append(keys, limitKey{name: subnetKey(ip, host), limit: p.perSubnet, reason: ReasonSubnet})
+	}
+	if p.perASN > 0 && p.asn != nil && ip != nil {
+		if asn := p.asn(ip.String()); asn > 0 {
+			keys = append(keys, limitKey{name: fmt.Sprintf("asn:%d", asn), limit: p.perASN, reason: ReasonASN})
+		}
+	}
+	return keys
+}
+
+func subnetKey(ip net.IP, host string) string {
+	if ip == nil {
+		return "host:" + strings.ToLower(host)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return "net:" + v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return "net:" + ip.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
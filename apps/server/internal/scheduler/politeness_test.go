@@ -0,0 +1,92 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPoliteness_SubnetCap(t *testing.T) {
+	p := NewPoliteness(1, 0, nil)
+	ctx := context.Background()
+
+	release, err := p.Acquire(ctx, "192.0.2.10", nil)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	// Another /24 is not affected.
+	other, err := p.Acquire(ctx, "198.51.100.10", func(string) { t.Error("unexpected queueing") })
+	if err != nil {
+		t.Fatalf("acquire other subnet: %v", err)
+	}
+	other()
+
+	queued := make(chan string, 1)
+	acquired := make(chan func(), 1)
+	go func() {
+		r, err := p.Acquire(ctx, "192.0.2.200", func(reason string) { queued <- reason })
+		if err == nil {
+			acquired <- r
+		}
+	}()
+
+	select {
+	case reason := <-queued:
+		if reason != ReasonSubnet {
+			t.Errorf("expected subnet reason, got %q", reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the second check in the /24 to be queued")
+	}
+	select {
+	case <-acquired:
+		t.Fatal("acquired while the subnet was full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release()
+	release() // releasing twice is harmless
+	select {
+	case r := <-acquired:
+		r()
+	case <-time.After(time.Second):
+		t.Fatal("expected the queued check to start after release")
+	}
+}
+
+func TestPoliteness_ASNCapAndCancel(t *testing.T) {
+	p := NewPoliteness(0, 1, func(string) int { return 64500 })
+
+	release, err := p.Acquire(context.Background(), "192.0.2.1", nil)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	var reason string
+	if _, err := p.Acquire(ctx, "203.0.113.1", func(r string) { reason = r }); err == nil {
+		t.Fatal("expected the wait to end with the context")
+	}
+	if reason != ReasonASN {
+		t.Errorf("expected asn reason, got %q", reason)
+	}
+}
+
+func TestSubnetKey(t *testing.T) {
+	p := NewPoliteness(1, 0, nil)
+	cases := map[string]string{
+		"192.0.2.77":           "net:192.0.2.0/24",
+		"2001:db8:1:2:3::4":    "net:2001:db8:1:2::/64",
+		"[2001:db8:1:2:3::4]":  "net:2001:db8:1:2::/64",
+		"Proxy.Example.com":    "host:proxy.example.com",
+		"::ffff:198.51.100.20": "net:198.51.100.0/24",
+	}
+	for host, want := range cases {
+		keys := p.keys(host)
+		if len(keys) != 1 || keys[0].name != want {
+			t.Errorf("%s: expected %s, got %+v", host, want, keys)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"socksproxies.com/server/internal/rate"
+)
+
+// ErrClosed is returned when work is submitted to a closed scheduler.
+var ErrClosed = errors.New("scheduler closed")
+
+// tierWeights is how many checks a client of each tier gets per turn.
+var tierWeights = map[rate.Tier]int{
+	rate.TierFree:  1,
+	rate.TierBasic: 2,
+	rate.TierPro:   4,
+}
+
+// Scheduler runs checks on a fixed pool of workers shared by every session.
+// Clients are served in turn, each getting as many checks per turn as its
+// tier's weight, so one big batch cannot starve everybody else. Each client
+// may have a bounded number of checks waiting; Submit blocks beyond that.
+type Scheduler struct {
+	workers    int
+	queueLimit int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	clients map[string]*clientQueue
+	// ring holds the clients with waiting checks, in service order.
+	ring   []*clientQueue
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type clientQueue struct {
+	id     string
+	weight int
+	tasks  []func()
+	// slots holds one token per waiting check; it is the backpressure.
+	slots chan struct{}
+	// refs counts waiting checks and blocked submitters, so the queue is
+	// dropped once nobody uses it.
+	refs   int
+	served int
+}
+
+// New starts a scheduler with the given number of workers, each client
+// allowed queueLimit waiting checks.
+func New(workers, queueLimit int) *Scheduler {
+	s := &Scheduler{
+		workers:    max(workers, 1),
+		queueLimit: max(queueLimit, 1),
+		clients:    make(map[string]*clientQueue),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	workersTotal.Add(int64(s.workers))
+	s.wg.Add(s.workers)
+	for range s.workers {
+		go s.work()
+	}
+	return s
+}
+
+// Submit queues run for client, waiting while the client already has its
+// full share of checks queued. It returns once run is queued, not when it
+// has finished.
+func (s *Scheduler) Submit(ctx context.Context, client string, tier rate.Tier, run func()) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	q := s.clients[client]
+	if q == nil {
+		q = &clientQueue{id: client, slots: make(chan struct{}, s.queueLimit)}
+		s.clients[client] = q
+	}
+	q.weight = tierWeight(tier)
+	q.refs++
+	s.mu.Unlock()
+
+	select {
+	case q.slots <- struct{}{}:
+	case <-ctx.Done():
+		s.mu.Lock()
+		s.unref(q)
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		<-q.slots
+		s.unref(q)
+		return ErrClosed
+	}
+	q.tasks = append(q.tasks, run)
+	if len(q.tasks) == 1 {
+		s.ring = append(s.ring, q)
+	}
+	queueDepth.Inc()
+	s.cond.Signal()
+	return nil
+}
+
+// Workers reports the size of the pool.
+func (s *Scheduler) Workers() int {
+	return s.workers
+}
+
+// QueueLimit reports how many checks a client may have waiting.
+func (s *Scheduler) QueueLimit() int {
+	return s.queueLimit
+}
+
+// Close stops accepting work and waits for the queued checks to finish.
+func (s *Scheduler) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	s.wg.Wait()
+	workersTotal.Add(-int64(s.workers))
+}
+
+func (s *Scheduler) work() {
+	defer s.wg.Done()
+	for {
+		run, ok := s.next()
+		if !ok {
+			return
+		}
+		workersBusy.Add(1)
+		s.run(run)
+		workersBusy.Add(-1)
+	}
+}
+
+func (s *Scheduler) run(run func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[PANIC] Recovered in scheduled check: %v", r)
+		}
+	}()
+	run()
+}
+
+// next takes the next check in fair order, waiting for one if needed. It
+// reports false once the scheduler is closed and drained.
+func (s *Scheduler) next() (func(), bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.ring) == 0 {
+		if s.closed {
+			return nil, false
+		}
+		s.cond.Wait()
+	}
+
+	q := s.ring[0]
+	run := q.tasks[0]
+	q.tasks[0] = nil
+	q.tasks = q.tasks[1:]
+	q.served++
+	switch {
+	case len(q.tasks) == 0:
+		s.ring = s.ring[1:]
+		q.served = 0
+	case q.served >= q.weight:
+		s.ring = append(s.ring[1:], q)
+		q.served = 0
+	}
+
+	<-q.slots
+	s.unref(q)
+	queueDepth.Dec()
+	return run, true
+}
+
+func (s *Scheduler) unref(q *clientQueue) {
+	if q.refs--; q.refs == 0 {
+		delete(s.clients, q.id)
+	}
+}
+
+func tierWeight(tier rate.Tier) int {
+	if weight, ok := tierWeights[tier]; ok {
+		return weight
+	}
+	return tierWeights[rate.TierFree]
+}
@@ -0,0 +1,102 @@
+package scheduler
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"socksproxies.com/server/internal/rate"
+)
+
+// blockWorker occupies the only worker of s until the returned func is
+// called.
+func blockWorker(t *testing.T, s *Scheduler) func() {
+	t.Helper()
+	gate := make(chan struct{})
+	started := make(chan struct{})
+	if err := s.Submit(context.Background(), "gate", rate.TierFree, func() {
+		close(started)
+		<-gate
+	}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	<-started
+	return func() { close(gate) }
+}
+
+func TestScheduler_FairOrder(t *testing.T) {
+	s := New(1, 10)
+	defer s.Close()
+	release := blockWorker(t, s)
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	submit := func(client string, tier rate.Tier, n int) {
+		for range n {
+			wg.Add(1)
+			if err := s.Submit(context.Background(), client, tier, func() {
+				defer wg.Done()
+				mu.Lock()
+				order = append(order, client)
+				mu.Unlock()
+			}); err != nil {
+				t.Fatalf("submit: %v", err)
+			}
+		}
+	}
+	submit("bulk", rate.TierFree, 4)
+	submit("small", rate.TierFree, 2)
+	submit("paid", rate.TierPro, 5)
+	release()
+	wg.Wait()
+
+	want := []string{"bulk", "small", "paid", "paid", "paid", "paid", "bulk", "small", "paid", "bulk", "bulk"}
+	if !slices.Equal(order, want) {
+		t.Errorf("expected %v, got %v", want, order)
+	}
+}
+
+func TestScheduler_Backpressure(t *testing.T) {
+	s := New(1, 1)
+	defer s.Close()
+	release := blockWorker(t, s)
+	defer release()
+
+	if err := s.Submit(context.Background(), "client", rate.TierFree, func() {}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := s.Submit(ctx, "client", rate.TierFree, func() {}); err == nil {
+		t.Fatal("expected a full client queue to block until the context ended")
+	}
+	// Other clients still get in.
+	if err := s.Submit(context.Background(), "other", rate.TierFree, func() {}); err != nil {
+		t.Fatalf("expected another client to be accepted, got %v", err)
+	}
+}
+
+func TestScheduler_CloseDrains(t *testing.T) {
+	s := New(2, 5)
+	var mu sync.Mutex
+	ran := 0
+	for range 5 {
+		if err := s.Submit(context.Background(), "client", rate.TierBasic, func() {
+			mu.Lock()
+			ran++
+			mu.Unlock()
+		}); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	s.Close()
+	if ran != 5 {
+		t.Errorf("expected queued checks to run before Close returned, ran %d", ran)
+	}
+	if err := s.Submit(context.Background(), "client", rate.TierFree, func() {}); err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
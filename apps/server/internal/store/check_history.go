@@ -0,0 +1,235 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Check history bucket sizes.
+const (
+	HistoryHour = "hour"
+	HistoryDay  = "day"
+)
+
+// ProxyHistoryFilters selects the checks recorded for one proxy address,
+// across every protocol it was checked with. Zero Since or Until leaves that
+// end of the range open.
+type ProxyHistoryFilters struct {
+	IP     string
+	Port   int
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+	Offset int
+}
+
+func (filters ProxyHistoryFilters) address() string {
+	return net.JoinHostPort(filters.IP, strconv.Itoa(filters.Port))
+}
+
+// ProxyDetail is a proxy with its latest checks. Record is nil, and Checks
+// empty, for a proxy that is not on the synced list: checks of arbitrary
+// addresses submitted by users are not served back.
+type ProxyDetail struct {
+	Record *ProxyListRecord
+	Checks []CheckRecord
+}
+
+// CheckBucket sums up the checks of one hour or day. Latency percentiles are
+// in milliseconds over the working checks, nil when there were none.
+type CheckBucket struct {
+	Start      time.Time `json:"start"`
+	Checks     int       `json:"checks"`
+	Up         int       `json:"up"`
+	Uptime     float64   `json:"uptime"`
+	LatencyP50 *float64  `json:"latency_p50_ms,omitempty"`
+	LatencyP90 *float64  `json:"latency_p90_ms,omitempty"`
+	LatencyP99 *float64  `json:"latency_p99_ms,omitempty"`
+}
+
+func normalizeHistoryPaging(filters *ProxyHistoryFilters) {
+	if filters.Limit <= 0 {
+		filters.Limit = 50
+	}
+	if filters.Limit > 500 {
+		filters.Limit = 500
+	}
+	if filters.Offset < 0 {
+		filters.Offset = 0
+	}
+}
+
+const checkHistoryColumns = `
+		c.id, c.proxy_id, p.address, p.protocol, c.status, COALESCE(c.latency, 0) AS latency, c.checked_at,
+		COALESCE(c.ip, '') AS ip, COALESCE(c.country, '') AS country, COALESCE(c.anonymity, '') AS anonymity,
+		COALESCE(c.connect_ms, 0) AS connect_ms, COALESCE(c.handshake_ms, 0) AS handshake_ms,
+		COALESCE(c.tunnel_ms, 0) AS tunnel_ms, COALESCE(c.tls_ms, 0) AS tls_ms, COALESCE(c.ttfb_ms, 0) AS ttfb_ms,
+		COALESCE(c.dns_mode, '') AS dns_mode, c.remote_dns, c.dns_leak,
+		c.injects_content, c.strips_headers, c.mitm_tls`
+
+// historyWhere limits checks to the proxy and time range of filters.
+func historyWhere(filters ProxyHistoryFilters) (string, []any) {
+	where := "WHERE p.address = ?"
+	args := []any{filters.address()}
+	if !filters.Since.IsZero() {
+		where += " AND c.checked_at >= ?"
+		args = append(args, filters.Since.UTC())
+	}
+	if !filters.Until.IsZero() {
+		where += " AND c.checked_at < ?"
+		args = append(args, filters.Until.UTC())
+	}
+	return where, args
+}
+
+func (s *Store) GetProxyDetail(ctx context.Context, ip string, port int, recent int) (ProxyDetail, error) {
+	var detail ProxyDetail
+	var record ProxyListRecord
+	err := s.DB.GetContext(ctx, &record, `
+		SELECT id, host, ip, port, last_seen, delay, cid,
+		       country_code, country_name, city, region,
+		       asn, asn_name, org, continent_code,
+		       checks_up, checks_down, anon,
+		       http, ssl, socks4, socks5,
+		       injects_content, strips_headers, mitm_tls,
+		       created_at, updated_at
+		FROM proxy_list
+		WHERE ip = ? AND port = ?
+	`, ip, port)
+	switch {
+	case err == sql.ErrNoRows:
+		return detail, nil
+	case err != nil:
+		return detail, err
+	}
+	detail.Record = &record
+	if recent <= 0 {
+		return detail, nil
+	}
+
+	checks, _, err := s.ListProxyChecks(ctx, ProxyHistoryFilters{IP: ip, Port: port, Limit: recent})
+	if err != nil {
+		return detail, err
+	}
+	detail.Checks = checks
+	return detail, nil
+}
+
+func (s *Store) ListProxyChecks(ctx context.Context, filters ProxyHistoryFilters) ([]CheckRecord, int, error) {
+	normalizeHistoryPaging(&filters)
+	where, args := historyWhere(filters)
+	from := " FROM checks c JOIN proxies p ON p.id = c.proxy_id " + where
+
+	var total int
+	if err := s.DB.GetContext(ctx, &total, "SELECT COUNT(*)"+from, args...); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filters.Limit, filters.Offset)
+	records := make([]CheckRecord, 0, filters.Limit)
+	query := "SELECT" + checkHistoryColumns + from + " ORDER BY c.checked_at DESC, c.id DESC LIMIT ? OFFSET ?"
+	if err := s.DB.SelectContext(ctx, &records, query, args...); err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+// AggregateProxyChecks buckets the checks by hour or day (UTC). SQLite has
+// no percentile function, so the rows are summed up here as they stream in.
+func (s *Store) AggregateProxyChecks(ctx context.Context, filters ProxyHistoryFilters, bucket string) ([]CheckBucket, error) {
+	where, args := historyWhere(filters)
+	rows, err := s.DB.QueryxContext(ctx, `
+		SELECT c.status, COALESCE(c.latency, 0), c.checked_at
+		FROM checks c JOIN proxies p ON p.id = c.proxy_id
+	`+where+" ORDER BY c.checked_at", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		buckets   []CheckBucket
+		latencies []float64
+	)
+	for rows.Next() {
+		var (
+			status    bool
+			latency   int64
+			checkedAt time.Time
+		)
+		if err := rows.Scan(&status, &latency, &checkedAt); err != nil {
+			return nil, err
+		}
+		start := truncateBucket(checkedAt, bucket)
+		if len(buckets) == 0 || !buckets[len(buckets)-1].Start.Equal(start) {
+			if len(buckets) > 0 {
+				buckets[len(buckets)-1].setLatencies(latencies)
+			}
+			buckets = append(buckets, CheckBucket{Start: start})
+			latencies = latencies[:0]
+		}
+		b := &buckets[len(buckets)-1]
+		b.Checks++
+		if status {
+			b.Up++
+			if latency > 0 {
+				latencies = append(latencies, float64(latency))
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(buckets) > 0 {
+		buckets[len(buckets)-1].setLatencies(latencies)
+	}
+	for i := range buckets {
+		buckets[i].Uptime = uptimePercent(buckets[i].Up, buckets[i].Checks)
+	}
+	return buckets, nil
+}
+
+func truncateBucket(t time.Time, bucket string) time.Time {
+	t = t.UTC()
+	if bucket == HistoryDay {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Hour)
+}
+
+func (b *CheckBucket) setLatencies(latencies []float64) {
+	if len(latencies) == 0 {
+		return
+	}
+	slices.Sort(latencies)
+	b.LatencyP50 = percentile(latencies, 0.5)
+	b.LatencyP90 = percentile(latencies, 0.9)
+	b.LatencyP99 = percentile(latencies, 0.99)
+}
+
+// percentile interpolates between the closest ranks of sorted values, the
+// way Postgres' percentile_cont does.
+func percentile(sorted []float64, p float64) *float64 {
+	pos := p * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	value := roundTenth(sorted[lower] + (sorted[upper]-sorted[lower])*(pos-float64(lower)))
+	return &value
+}
+
+func roundTenth(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// uptimePercent is the share of working checks, to two decimals.
+func uptimePercent(up, checks int) float64 {
+	if checks == 0 {
+		return 0
+	}
+	return math.Round(float64(up)/float64(checks)*10000) / 100
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// historyWherePostgres is historyWhere with numbered placeholders.
+func historyWherePostgres(filters ProxyHistoryFilters) (string, []any) {
+	where := "WHERE p.address = $1"
+	args := []any{filters.address()}
+	if !filters.Since.IsZero() {
+		args = append(args, filters.Since.UTC())
+		where += fmt.Sprintf(" AND c.checked_at >= $%d", len(args))
+	}
+	if !filters.Until.IsZero() {
+		args = append(args, filters.Until.UTC())
+		where += fmt.Sprintf(" AND c.checked_at < $%d", len(args))
+	}
+	return where, args
+}
+
+func (s *PostgresStore) GetProxyDetail(ctx context.Context, ip string, port int, recent int) (ProxyDetail, error) {
+	var detail ProxyDetail
+	rows, err := s.DB.Query(ctx, fmt.Sprintf(`
+		SELECT id, host, ip, port, last_seen, delay, cid,
+		       country_code, country_name, city, region,
+		       asn, asn_name, org, continent_code,
+		       checks_up, checks_down, anon,
+		       http, ssl, socks4, socks5,
+		       created_at, updated_at
+		FROM %s.proxy_list
+		WHERE ip = $1 AND port = $2
+	`, s.QuoteSchema()), ip, port)
+	if err != nil {
+		return detail, fmt.Errorf("query proxy list record: %w", err)
+	}
+	records, err := scanProxyListRows(rows)
+	rows.Close()
+	if err != nil {
+		return detail, fmt.Errorf("scan proxy list record: %w", err)
+	}
+	if len(records) == 0 {
+		return detail, nil
+	}
+	record := records[0]
+	// scanProxyListRows is shared with queries that skip the tamper flags.
+	err = s.DB.QueryRow(ctx, fmt.Sprintf(`
+		SELECT injects_content, strips_headers, mitm_tls FROM %s.proxy_list WHERE id = $1
+	`, s.QuoteSchema()), record.ID).Scan(&record.InjectsContent, &record.StripsHeaders, &record.MITMTLS)
+	if err != nil {
+		return detail, fmt.Errorf("query tamper flags: %w", err)
+	}
+	detail.Record = &record
+	if recent <= 0 {
+		return detail, nil
+	}
+
+	checks, _, err := s.ListProxyChecks(ctx, ProxyHistoryFilters{IP: ip, Port: port, Limit: recent})
+	if err != nil {
+		return detail, err
+	}
+	detail.Checks = checks
+	return detail, nil
+}
+
+func (s *PostgresStore) ListProxyChecks(ctx context.Context, filters ProxyHistoryFilters) ([]CheckRecord, int, error) {
+	normalizeHistoryPaging(&filters)
+	where, args := historyWherePostgres(filters)
+	from := fmt.Sprintf(" FROM %s.checks c JOIN %s.proxies p ON p.id = c.proxy_id %s", s.QuoteSchema(), s.QuoteSchema(), where)
+
+	var total int
+	if err := s.DB.QueryRow(ctx, "SELECT COUNT(*)"+from, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count checks: %w", err)
+	}
+
+	args = append(args, filters.Limit, filters.Offset)
+	query := fmt.Sprintf("SELECT%s%s ORDER BY c.checked_at DESC, c.id DESC LIMIT $%d OFFSET $%d",
+		checkHistoryColumns, from, len(args)-1, len(args))
+	rows, err := s.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query checks: %w", err)
+	}
+	defer rows.Close()
+
+	records := make([]CheckRecord, 0, filters.Limit)
+	for rows.Next() {
+		var (
+			record    CheckRecord
+			id        uuid.UUID
+			proxyID   uuid.UUID
+			latency   int32
+			connectMS int32
+			handshake int32
+			tunnelMS  int32
+			tlsMS     int32
+			ttfbMS    int32
+			checkedAt *time.Time
+		)
+		if err := rows.Scan(
+			&id,
+			&proxyID,
+			&record.Address,
+			&record.Protocol,
+			&record.Status,
+			&latency,
+			&checkedAt,
+			&record.IP,
+			&record.Country,
+			&record.Anonymity,
+			&connectMS,
+			&handshake,
+			&tunnelMS,
+			&tlsMS,
+			&ttfbMS,
+			&record.DNSMode,
+			&record.RemoteDNS,
+			&record.DNSLeak,
+			&record.InjectsContent,
+			&record.StripsHeaders,
+			&record.MITMTLS,
+		); err != nil {
+			return nil, 0, fmt.Errorf("scan check: %w", err)
+		}
+		record.ID = hashUUIDToInt64(id)
+		record.ProxyID = hashUUIDToInt64(proxyID)
+		record.Latency = int64(latency)
+		record.ConnectMS = int64(connectMS)
+		record.HandshakeMS = int64(handshake)
+		record.TunnelMS = int64(tunnelMS)
+		record.TLSMS = int64(tlsMS)
+		record.TTFBMS = int64(ttfbMS)
+		if checkedAt != nil {
+			record.CheckedAt = *checkedAt
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("scan checks: %w", err)
+	}
+	return records, total, nil
+}
+
+// AggregateProxyChecks buckets the checks by hour or day (UTC) in the
+// database.
+func (s *PostgresStore) AggregateProxyChecks(ctx context.Context, filters ProxyHistoryFilters, bucket string) ([]CheckBucket, error) {
+	if bucket != HistoryDay {
+		bucket = HistoryHour
+	}
+	where, args := historyWherePostgres(filters)
+	args = append(args, bucket)
+	query := fmt.Sprintf(`
+		SELECT date_trunc($%d, c.checked_at AT TIME ZONE 'UTC') AS start,
+		       COUNT(*) AS checks,
+		       COUNT(*) FILTER (WHERE c.status) AS up,
+		       percentile_cont(0.5) WITHIN GROUP (ORDER BY c.latency) FILTER (WHERE c.status AND c.latency > 0) AS p50,
+		       percentile_cont(0.9) WITHIN GROUP (ORDER BY c.latency) FILTER (WHERE c.status AND c.latency > 0) AS p90,
+		       percentile_cont(0.99) WITHIN GROUP (ORDER BY c.latency) FILTER (WHERE c.status AND c.latency > 0) AS p99
+		FROM %s.checks c
+		JOIN %s.proxies p ON p.id = c.proxy_id
+		%s
+		GROUP BY 1
+		ORDER BY 1
+	`, len(args), s.QuoteSchema(), s.QuoteSchema(), where)
+
+	rows, err := s.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate checks: %w", err)
+	}
+	defer rows.Close()
+
+	buckets, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (CheckBucket, error) {
+		var b CheckBucket
+		var start time.Time
+		if err := row.Scan(&start, &b.Checks, &b.Up, &b.LatencyP50, &b.LatencyP90, &b.LatencyP99); err != nil {
+			return b, err
+		}
+		// AT TIME ZONE yields a timestamp without zone, read back as UTC.
+		b.Start = time.Date(start.Year(), start.Month(), start.Day(), start.Hour(), 0, 0, 0, time.UTC)
+		b.Uptime = uptimePercent(b.Up, b.Checks)
+		for _, p := range []*float64{b.LatencyP50, b.LatencyP90, b.LatencyP99} {
+			if p != nil {
+				*p = roundTenth(*p)
+			}
+		}
+		return b, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan check buckets: %w", err)
+	}
+	return buckets, nil
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStore_ProxyHistory(t *testing.T) {
+	store, err := Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	defer store.DB.Close()
+
+	ctx := context.Background()
+	if _, err := store.UpsertProxyListBatch(ctx, []ProxyListRecord{{Host: "192.0.2.1", IP: "192.0.2.1", Port: 1080, Socks5: 1, LastSeen: time.Now().UTC()}}); err != nil {
+		t.Fatalf("failed to upsert proxy list: %v", err)
+	}
+	socks5, err := store.UpsertProxy(ctx, ProxyRecord{Address: "192.0.2.1:1080", Protocol: "socks5"})
+	if err != nil {
+		t.Fatalf("failed to upsert proxy: %v", err)
+	}
+	http, err := store.UpsertProxy(ctx, ProxyRecord{Address: "192.0.2.1:1080", Protocol: "http"})
+	if err != nil {
+		t.Fatalf("failed to upsert proxy: %v", err)
+	}
+	other, err := store.UpsertProxy(ctx, ProxyRecord{Address: "192.0.2.2:1080", Protocol: "socks5"})
+	if err != nil {
+		t.Fatalf("failed to upsert proxy: %v", err)
+	}
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	checks := []CheckRecord{
+		{ProxyID: socks5, Status: true, Latency: 100, CheckedAt: day.Add(10 * time.Minute)},
+		{ProxyID: socks5, Status: true, Latency: 300, CheckedAt: day.Add(20 * time.Minute)},
+		{ProxyID: http, Status: false, CheckedAt: day.Add(30 * time.Minute)},
+		{ProxyID: http, Status: true, Latency: 200, CheckedAt: day.Add(2 * time.Hour)},
+		{ProxyID: socks5, Status: false, CheckedAt: day.Add(26 * time.Hour)},
+		{ProxyID: other, Status: true, Latency: 50, CheckedAt: day.Add(15 * time.Minute)},
+	}
+	for _, check := range checks {
+		if err := store.InsertCheck(ctx, check); err != nil {
+			t.Fatalf("failed to insert check: %v", err)
+		}
+	}
+
+	detail, err := store.GetProxyDetail(ctx, "192.0.2.1", 1080, 2)
+	if err != nil {
+		t.Fatalf("GetProxyDetail: %v", err)
+	}
+	if detail.Record == nil || detail.Record.Socks5 != 1 {
+		t.Errorf("expected the proxy list record, got %+v", detail.Record)
+	}
+	if len(detail.Checks) != 2 || !detail.Checks[0].CheckedAt.Equal(day.Add(26*time.Hour)) || detail.Checks[1].Protocol != "http" {
+		t.Errorf("expected the two latest checks across protocols, got %+v", detail.Checks)
+	}
+	for _, ip := range []string{"198.51.100.1", "192.0.2.2"} {
+		if detail, err := store.GetProxyDetail(ctx, ip, 1080, 5); err != nil || detail.Record != nil || len(detail.Checks) > 0 {
+			t.Errorf("expected nothing for %s, which is not on the list, got %+v (%v)", ip, detail, err)
+		}
+	}
+	if detail, err := store.GetProxyDetail(ctx, "192.0.2.1", 1080, 0); err != nil || detail.Record == nil || len(detail.Checks) > 0 {
+		t.Errorf("expected only the record without recent checks, got %+v (%v)", detail, err)
+	}
+
+	page, total, err := store.ListProxyChecks(ctx, ProxyHistoryFilters{IP: "192.0.2.1", Port: 1080, Until: day.Add(24 * time.Hour), Limit: 2, Offset: 1})
+	if err != nil {
+		t.Fatalf("ListProxyChecks: %v", err)
+	}
+	if total != 4 || len(page) != 2 || page[0].Latency != 0 || page[1].Latency != 300 {
+		t.Errorf("unexpected page %+v of %d", page, total)
+	}
+
+	hourly, err := store.AggregateProxyChecks(ctx, ProxyHistoryFilters{IP: "192.0.2.1", Port: 1080}, HistoryHour)
+	if err != nil {
+		t.Fatalf("AggregateProxyChecks: %v", err)
+	}
+	if len(hourly) != 3 {
+		t.Fatalf("expected 3 hourly buckets, got %+v", hourly)
+	}
+	first := hourly[0]
+	if !first.Start.Equal(day) || first.Checks != 3 || first.Up != 2 || first.Uptime != 66.67 {
+		t.Errorf("unexpected first bucket %+v", first)
+	}
+	if first.LatencyP50 == nil || *first.LatencyP50 != 200 || *first.LatencyP90 != 280 {
+		t.Errorf("unexpected latency percentiles %v %v", first.LatencyP50, first.LatencyP90)
+	}
+	if hourly[2].LatencyP50 != nil || hourly[2].Uptime != 0 {
+		t.Errorf("expected no latency for a bucket without working checks, got %+v", hourly[2])
+	}
+
+	daily, err := store.AggregateProxyChecks(ctx, ProxyHistoryFilters{IP: "192.0.2.1", Port: 1080, Since: day}, HistoryDay)
+	if err != nil {
+		t.Fatalf("AggregateProxyChecks: %v", err)
+	}
+	if len(daily) != 2 || daily[0].Checks != 4 || daily[0].Uptime != 75 || daily[1].Checks != 1 {
+		t.Errorf("unexpected daily buckets %+v", daily)
+	}
+}
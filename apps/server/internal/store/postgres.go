@@ -223,8 +223,10 @@ func (s *PostgresStore) InsertCheck(ctx context.Context, record CheckRecord) err
 	// Use Address and Protocol to look up the proxy_id (UUID)
 	// This is necessary because CheckRecord uses int64 ProxyID for SQLite compatibility
 	query := fmt.Sprintf(`
-		INSERT INTO %s.checks (proxy_id, status, latency, checked_at, ip, country, anonymity)
-		SELECT id, $3, $4, $5, $6, $7, $8
+		INSERT INTO %s.checks (proxy_id, status, latency, checked_at, ip, country, anonymity,
+			connect_ms, handshake_ms, tunnel_ms, tls_ms, ttfb_ms, dns_mode, remote_dns, dns_leak,
+			injects_content, strips_headers, mitm_tls)
+		SELECT id, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19
 		FROM %s.proxies
 		WHERE address = $1 AND protocol = $2
 		LIMIT 1
@@ -265,12 +267,40 @@ func (s *PostgresStore) InsertCheck(ctx context.Context, record CheckRecord) err
 		ip,
 		country,
 		anonymity,
+		record.ConnectMS,
+		record.HandshakeMS,
+		record.TunnelMS,
+		record.TLSMS,
+		record.TTFBMS,
+		record.DNSMode,
+		record.RemoteDNS,
+		record.DNSLeak,
+		record.InjectsContent,
+		record.StripsHeaders,
+		record.MITMTLS,
 	)
 
 	if err != nil {
 		return fmt.Errorf("insert check: %w", err)
 	}
 
+	if record.hasTamperFlags() {
+		if ip, port, ok := splitAddress(record.Address); ok {
+			// COALESCE keeps a flag from an earlier check when this one could
+			// not make that comparison.
+			_, err := s.DB.Exec(ctx, fmt.Sprintf(`
+				UPDATE %s.proxy_list SET
+					injects_content = COALESCE($1, injects_content),
+					strips_headers = COALESCE($2, strips_headers),
+					mitm_tls = COALESCE($3, mitm_tls)
+				WHERE ip = $4 AND port = $5
+			`, s.QuoteSchema()), record.InjectsContent, record.StripsHeaders, record.MITMTLS, ip, port)
+			if err != nil {
+				return fmt.Errorf("update proxy list tamper flags: %w", err)
+			}
+		}
+	}
+
 	rowsAffected := result.RowsAffected()
 	if rowsAffected == 0 {
 		// If no proxy found, that's okay - it might have been deleted
@@ -6,6 +6,7 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 )
@@ -75,6 +76,13 @@ type ProxyListFilters struct {
 	Limit       int
 	Offset      int
 	Since       time.Time
+	// IPVersion limits results to IPv4 (4) or IPv6 (6) proxies; 0 means both.
+	IPVersion int
+	// Tamper flags match proxies whose latest tamper test found (true) or
+	// ruled out (false) the behaviour; nil means no filter.
+	InjectsContent *bool
+	StripsHeaders  *bool
+	MITMTLS        *bool
 }
 
 type ProxyListRecord struct {
@@ -100,8 +108,12 @@ type ProxyListRecord struct {
 	SSL           int       `db:"ssl"`
 	Socks4        int       `db:"socks4"`
 	Socks5        int       `db:"socks5"`
-	CreatedAt     time.Time `db:"created_at"`
-	UpdatedAt     time.Time `db:"updated_at"`
+	// Tamper flags from the latest check through our own checker, if any.
+	InjectsContent *bool     `db:"injects_content"`
+	StripsHeaders  *bool     `db:"strips_headers"`
+	MITMTLS        *bool     `db:"mitm_tls"`
+	CreatedAt      time.Time `db:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at"`
 }
 
 type FacetRecord struct {
@@ -295,6 +307,7 @@ func (s *Store) ListProxyList(ctx context.Context, filters ProxyListFilters) ([]
 		       asn, asn_name, org, continent_code,
 		       checks_up, checks_down, anon,
 		       http, ssl, socks4, socks5,
+		       injects_content, strips_headers, mitm_tls,
 		       created_at, updated_at
 		FROM proxy_list
 	` + whereClause + " ORDER BY last_seen DESC LIMIT ? OFFSET ?"
@@ -821,6 +834,13 @@ func buildProxyListWhere(filters ProxyListFilters) (string, []interface{}) {
 		clauses = append(clauses, "asn = ?")
 		args = append(args, filters.ASN)
 	}
+	if clause := ipVersionClause(filters.IPVersion); clause != "" {
+		clauses = append(clauses, clause)
+	}
+	for _, flag := range tamperFilters(filters) {
+		clauses = append(clauses, flag.column+" = ?")
+		args = append(args, flag.value)
+	}
 	if filters.Anonymity != "" {
 		values := anonymityLevels(filters.Anonymity)
 		if len(values) > 0 {
@@ -840,6 +860,90 @@ func buildProxyListWhere(filters ProxyListFilters) (string, []interface{}) {
 	return "WHERE " + strings.Join(clauses, " AND "), args
 }
 
+type tamperFilter struct {
+	column string
+	value  bool
+}
+
+// tamperFilters lists the tamper flag columns a filter constrains.
+func tamperFilters(filters ProxyListFilters) []tamperFilter {
+	var out []tamperFilter
+	for _, f := range []struct {
+		column string
+		value  *bool
+	}{
+		{"injects_content", filters.InjectsContent},
+		{"strips_headers", filters.StripsHeaders},
+		{"mitm_tls", filters.MITMTLS},
+	} {
+		if f.value != nil {
+			out = append(out, tamperFilter{column: f.column, value: *f.value})
+		}
+	}
+	return out
+}
+
+// Matches reports whether ListProxyList would return record for these
+// filters, leaving out paging and Since.
+func (filters ProxyListFilters) Matches(record ProxyListRecord) bool {
+	if filters.CountryCode != "" && record.CountryCode != strings.ToUpper(filters.CountryCode) {
+		return false
+	}
+	if filters.Port > 0 && record.Port != filters.Port {
+		return false
+	}
+	switch protocolColumn(filters.Protocol) {
+	case "http":
+		if record.HTTP != 1 {
+			return false
+		}
+	case "ssl":
+		if record.SSL != 1 {
+			return false
+		}
+	case "socks4":
+		if record.Socks4 != 1 {
+			return false
+		}
+	case "socks5":
+		if record.Socks5 != 1 {
+			return false
+		}
+	}
+	if filters.City != "" && !strings.EqualFold(record.City, filters.City) {
+		return false
+	}
+	if filters.Region != "" && !strings.EqualFold(record.Region, filters.Region) {
+		return false
+	}
+	if filters.ASN > 0 && record.ASN != filters.ASN {
+		return false
+	}
+	switch filters.IPVersion {
+	case 4:
+		if strings.Contains(record.IP, ":") {
+			return false
+		}
+	case 6:
+		if !strings.Contains(record.IP, ":") {
+			return false
+		}
+	}
+	for _, flag := range []struct{ want, got *bool }{
+		{filters.InjectsContent, record.InjectsContent},
+		{filters.StripsHeaders, record.StripsHeaders},
+		{filters.MITMTLS, record.MITMTLS},
+	} {
+		if flag.want != nil && (flag.got == nil || *flag.got != *flag.want) {
+			return false
+		}
+	}
+	if levels := anonymityLevels(filters.Anonymity); len(levels) > 0 && !slices.Contains(levels, record.Anon) {
+		return false
+	}
+	return true
+}
+
 func protocolColumn(protocol string) string {
 	switch strings.ToLower(protocol) {
 	case "http":
@@ -855,6 +959,19 @@ func protocolColumn(protocol string) string {
 	}
 }
 
+// ipVersionClause relies on IPv6 literals being the only stored addresses
+// that contain a colon, which holds for both SQLite and Postgres.
+func ipVersionClause(version int) string {
+	switch version {
+	case 4:
+		return "ip NOT LIKE '%:%'"
+	case 6:
+		return "ip LIKE '%:%'"
+	default:
+		return ""
+	}
+}
+
 func anonymityLevels(level string) []int {
 	switch strings.ToLower(level) {
 	case "elite":
@@ -147,6 +147,7 @@ func (s *PostgresStore) ListProxyList(ctx context.Context, filters ProxyListFilt
 		       asn, asn_name, org, continent_code,
 		       checks_up, checks_down, anon,
 		       http, ssl, socks4, socks5,
+		       injects_content, strips_headers, mitm_tls,
 		       created_at, updated_at
 		FROM %s.proxy_list
 		%s
@@ -201,6 +202,9 @@ func (s *PostgresStore) ListProxyList(ctx context.Context, filters ProxyListFilt
 			&record.SSL,
 			&record.Socks4,
 			&record.Socks5,
+			&record.InjectsContent,
+			&record.StripsHeaders,
+			&record.MITMTLS,
 			&createdAt,
 			&updatedAt,
 		); err != nil {
@@ -881,6 +885,14 @@ func buildProxyListWherePostgres(filters ProxyListFilters, startIndex int) (stri
 		args = append(args, filters.ASN)
 		index++
 	}
+	if clause := ipVersionClause(filters.IPVersion); clause != "" {
+		clauses = append(clauses, clause)
+	}
+	for _, flag := range tamperFilters(filters) {
+		clauses = append(clauses, fmt.Sprintf("%s = $%d", flag.column, index))
+		args = append(args, flag.value)
+		index++
+	}
 	if filters.Anonymity != "" {
 		values := anonymityLevels(filters.Anonymity)
 		if len(values) > 0 {
@@ -39,6 +39,120 @@ func TestProxyListStore_ListProxyList_Basic(t *testing.T) {
 	}
 }
 
+func TestProxyListStore_ListProxyList_FilterByIPVersion(t *testing.T) {
+	store, err := Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	defer store.DB.Close()
+
+	ctx := context.Background()
+
+	records := []ProxyListRecord{
+		{IP: "192.168.1.1", Port: 8080, Host: "proxy1.example.com", LastSeen: time.Now()},
+		{IP: "2001:db8::1", Port: 1080, Host: "2001:db8::1", LastSeen: time.Now()},
+		{IP: "2001:db8::2", Port: 3128, Host: "proxy3.example.com", LastSeen: time.Now()},
+	}
+
+	_, err = store.UpsertProxyListBatch(ctx, records)
+	if err != nil {
+		t.Fatalf("failed to upsert records: %v", err)
+	}
+
+	testCases := []struct {
+		version  int
+		expected int
+	}{
+		{0, 3},
+		{4, 1},
+		{6, 2},
+	}
+
+	for _, tc := range testCases {
+		result, total, err := store.ListProxyList(ctx, ProxyListFilters{IPVersion: tc.version})
+		if err != nil {
+			t.Fatalf("failed to list proxies for version %d: %v", tc.version, err)
+		}
+		if total != tc.expected || len(result) != tc.expected {
+			t.Errorf("version %d: expected %d, got total %d / %d records", tc.version, tc.expected, total, len(result))
+		}
+	}
+}
+
+func TestProxyListStore_ListProxyList_FilterByTamper(t *testing.T) {
+	store, err := Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	defer store.DB.Close()
+
+	ctx := context.Background()
+	_, err = store.UpsertProxyListBatch(ctx, []ProxyListRecord{
+		{IP: "192.168.1.1", Port: 8080, Host: "proxy1.example.com", LastSeen: time.Now()},
+		{IP: "192.168.1.2", Port: 3128, Host: "proxy2.example.com", LastSeen: time.Now()},
+		{IP: "2001:db8::1", Port: 1080, Host: "2001:db8::1", LastSeen: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("failed to upsert records: %v", err)
+	}
+
+	yes, no := true, false
+	checks := []CheckRecord{
+		{Address: "192.168.1.1:8080", InjectsContent: &yes, StripsHeaders: &no, MITMTLS: &no},
+		{Address: "192.168.1.2:3128", InjectsContent: &no, StripsHeaders: &no},
+		{Address: "[2001:db8::1]:1080", InjectsContent: &no, StripsHeaders: &yes, MITMTLS: &yes},
+		// A later check that could not run the TLS comparison keeps the
+		// earlier mitm_tls result.
+		{Address: "[2001:db8::1]:1080", InjectsContent: &no, StripsHeaders: &yes},
+	}
+	for _, check := range checks {
+		if err := store.InsertCheck(ctx, check); err != nil {
+			t.Fatalf("failed to insert check: %v", err)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		filters  ProxyListFilters
+		expected []string
+	}{
+		{"injects", ProxyListFilters{InjectsContent: &yes}, []string{"192.168.1.1"}},
+		{"clean_content", ProxyListFilters{InjectsContent: &no}, []string{"192.168.1.2", "2001:db8::1"}},
+		{"strips", ProxyListFilters{StripsHeaders: &yes}, []string{"2001:db8::1"}},
+		{"mitm", ProxyListFilters{MITMTLS: &yes}, []string{"2001:db8::1"}},
+		{"no_mitm", ProxyListFilters{MITMTLS: &no}, []string{"192.168.1.1"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, total, err := store.ListProxyList(ctx, tc.filters)
+			if err != nil {
+				t.Fatalf("failed to list proxies: %v", err)
+			}
+			if total != len(tc.expected) {
+				t.Fatalf("expected %d proxies, got %d", len(tc.expected), total)
+			}
+			got := make(map[string]bool, len(result))
+			for _, record := range result {
+				got[record.IP] = true
+			}
+			for _, ip := range tc.expected {
+				if !got[ip] {
+					t.Errorf("expected %s in %v", ip, got)
+				}
+			}
+		})
+	}
+
+	result, _, err := store.ListProxyList(ctx, ProxyListFilters{MITMTLS: &yes})
+	if err != nil || len(result) != 1 {
+		t.Fatalf("failed to list intercepting proxy: %v", err)
+	}
+	if record := result[0]; record.InjectsContent == nil || *record.InjectsContent || record.MITMTLS == nil || !*record.MITMTLS {
+		t.Errorf("expected flags on the listed record, got %+v", record)
+	}
+}
+
 func TestProxyListStore_ListProxyList_FilterByCountry(t *testing.T) {
 	store, err := Open(t.TempDir() + "/test.db")
 	if err != nil {
@@ -811,3 +925,55 @@ func TestProxyListStore_RebuildProxyFacets_Empty(t *testing.T) {
 		t.Errorf("expected 0 facets for empty table, got %d", count)
 	}
 }
+
+func TestProxyListFilters_MatchesAgreesWithList(t *testing.T) {
+	store, err := Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	defer store.DB.Close()
+
+	ctx := context.Background()
+	_, err = store.UpsertProxyListBatch(ctx, []ProxyListRecord{
+		{IP: "192.168.1.1", Port: 8080, Host: "a", CountryCode: "US", City: "Austin", Region: "Texas", ASN: 100, Anon: 5, HTTP: 1, LastSeen: time.Now()},
+		{IP: "192.168.1.2", Port: 1080, Host: "b", CountryCode: "DE", City: "Berlin", ASN: 200, Anon: 2, Socks5: 1, LastSeen: time.Now()},
+		{IP: "2001:db8::1", Port: 1080, Host: "c", CountryCode: "US", ASN: 100, Anon: 0, Socks4: 1, SSL: 1, LastSeen: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("failed to upsert records: %v", err)
+	}
+	all, _, err := store.ListProxyList(ctx, ProxyListFilters{})
+	if err != nil {
+		t.Fatalf("failed to list proxies: %v", err)
+	}
+
+	filters := []ProxyListFilters{
+		{},
+		{CountryCode: "us"},
+		{Port: 1080},
+		{Protocol: "socks5"},
+		{Protocol: "https"},
+		{City: "austin"},
+		{Region: "TEXAS"},
+		{ASN: 100},
+		{Anonymity: "elite"},
+		{Anonymity: "transparent"},
+		{IPVersion: 6},
+		{CountryCode: "US", Port: 1080},
+	}
+	for _, f := range filters {
+		listed, _, err := store.ListProxyList(ctx, f)
+		if err != nil {
+			t.Fatalf("failed to list proxies: %v", err)
+		}
+		want := make(map[string]bool, len(listed))
+		for _, record := range listed {
+			want[record.IP] = true
+		}
+		for _, record := range all {
+			if got := f.Matches(record); got != want[record.IP] {
+				t.Errorf("%+v: Matches(%s) = %v, ListProxyList disagrees", f, record.IP, got)
+			}
+		}
+	}
+}
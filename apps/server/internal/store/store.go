@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -26,6 +28,9 @@ type Storer interface {
 	InsertCheck(ctx context.Context, record CheckRecord) error
 	ListProxies(ctx context.Context, limit int) ([]ProxyRecord, error)
 	CountProxies(ctx context.Context) (int, error)
+	GetProxyDetail(ctx context.Context, ip string, port int, recent int) (ProxyDetail, error)
+	ListProxyChecks(ctx context.Context, filters ProxyHistoryFilters) ([]CheckRecord, int, error)
+	AggregateProxyChecks(ctx context.Context, filters ProxyHistoryFilters, bucket string) ([]CheckBucket, error)
 }
 
 // UnifiedStore wraps either SQLite or PostgreSQL backend
@@ -65,6 +70,25 @@ type CheckRecord struct {
 	IP        string    `db:"ip"`
 	Country   string    `db:"country"`
 	Anonymity string    `db:"anonymity"`
+
+	// Per-phase latency breakdown in milliseconds.
+	ConnectMS   int64 `db:"connect_ms"`
+	HandshakeMS int64 `db:"handshake_ms"`
+	TunnelMS    int64 `db:"tunnel_ms"`
+	TLSMS       int64 `db:"tls_ms"`
+	TTFBMS      int64 `db:"ttfb_ms"`
+
+	// DNS resolution test; nil when the test did not run.
+	DNSMode   string `db:"dns_mode"`
+	RemoteDNS *bool  `db:"remote_dns"`
+	DNSLeak   *bool  `db:"dns_leak"`
+
+	// Tamper test flags; nil when the comparison did not run. InsertCheck
+	// also copies them onto the matching proxy_list row so the list can be
+	// filtered by them.
+	InjectsContent *bool `db:"injects_content"`
+	StripsHeaders  *bool `db:"strips_headers"`
+	MITMTLS        *bool `db:"mitm_tls"`
 }
 
 func Open(path string) (*Store, error) {
@@ -125,12 +149,52 @@ func (s *Store) InsertCheck(ctx context.Context, record CheckRecord) error {
 		record.CheckedAt = time.Now().UTC()
 	}
 	_, err := s.DB.ExecContext(ctx, `
-		INSERT INTO checks (proxy_id, status, latency, checked_at, ip, country, anonymity)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, record.ProxyID, record.Status, record.Latency, record.CheckedAt, record.IP, record.Country, record.Anonymity)
+		INSERT INTO checks (proxy_id, status, latency, checked_at, ip, country, anonymity,
+			connect_ms, handshake_ms, tunnel_ms, tls_ms, ttfb_ms, dns_mode, remote_dns, dns_leak,
+			injects_content, strips_headers, mitm_tls)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, record.ProxyID, record.Status, record.Latency, record.CheckedAt, record.IP, record.Country, record.Anonymity,
+		record.ConnectMS, record.HandshakeMS, record.TunnelMS, record.TLSMS, record.TTFBMS,
+		record.DNSMode, record.RemoteDNS, record.DNSLeak,
+		record.InjectsContent, record.StripsHeaders, record.MITMTLS)
+	if err != nil || !record.hasTamperFlags() {
+		return err
+	}
+
+	ip, port, ok := splitAddress(record.Address)
+	if !ok {
+		return nil
+	}
+	// COALESCE keeps a flag from an earlier check when this one could not
+	// make that comparison.
+	_, err = s.DB.ExecContext(ctx, `
+		UPDATE proxy_list SET
+			injects_content = COALESCE(?, injects_content),
+			strips_headers = COALESCE(?, strips_headers),
+			mitm_tls = COALESCE(?, mitm_tls)
+		WHERE ip = ? AND port = ?
+	`, record.InjectsContent, record.StripsHeaders, record.MITMTLS, ip, port)
 	return err
 }
 
+func (r CheckRecord) hasTamperFlags() bool {
+	return r.InjectsContent != nil || r.StripsHeaders != nil || r.MITMTLS != nil
+}
+
+// splitAddress splits an "ip:port" (or "[v6]:port") proxy address into the
+// ip and port columns proxy_list is keyed by.
+func splitAddress(address string) (string, int, bool) {
+	host, rawPort, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, false
+	}
+	port, err := strconv.Atoi(rawPort)
+	if err != nil {
+		return "", 0, false
+	}
+	return host, port, true
+}
+
 func (s *Store) ListProxies(ctx context.Context, limit int) ([]ProxyRecord, error) {
 	if limit <= 0 {
 		limit = 50
@@ -180,6 +244,17 @@ func migrate(db *sqlx.DB) error {
 		ip TEXT,
 		country TEXT,
 		anonymity TEXT,
+		connect_ms INTEGER DEFAULT 0,
+		handshake_ms INTEGER DEFAULT 0,
+		tunnel_ms INTEGER DEFAULT 0,
+		tls_ms INTEGER DEFAULT 0,
+		ttfb_ms INTEGER DEFAULT 0,
+		dns_mode TEXT DEFAULT '',
+		remote_dns BOOLEAN,
+		dns_leak BOOLEAN,
+		injects_content BOOLEAN,
+		strips_headers BOOLEAN,
+		mitm_tls BOOLEAN,
 		FOREIGN KEY(proxy_id) REFERENCES proxies(id)
 	);
 
@@ -211,6 +286,9 @@ func migrate(db *sqlx.DB) error {
 		ssl INTEGER DEFAULT 0,
 		socks4 INTEGER DEFAULT 0,
 		socks5 INTEGER DEFAULT 0,
+		injects_content BOOLEAN,
+		strips_headers BOOLEAN,
+		mitm_tls BOOLEAN,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		UNIQUE(ip, port)
@@ -244,6 +322,38 @@ func migrate(db *sqlx.DB) error {
 		return fmt.Errorf("migrate schema: %w", err)
 	}
 
+	// Columns added after the initial schema; CREATE TABLE IF NOT EXISTS
+	// leaves existing databases without them.
+	if err := ensureColumns(db, "checks", []columnDef{
+		{"connect_ms", "INTEGER DEFAULT 0"},
+		{"handshake_ms", "INTEGER DEFAULT 0"},
+		{"tunnel_ms", "INTEGER DEFAULT 0"},
+		{"tls_ms", "INTEGER DEFAULT 0"},
+		{"ttfb_ms", "INTEGER DEFAULT 0"},
+		{"dns_mode", "TEXT DEFAULT ''"},
+		{"remote_dns", "BOOLEAN"},
+		{"dns_leak", "BOOLEAN"},
+		{"injects_content", "BOOLEAN"},
+		{"strips_headers", "BOOLEAN"},
+		{"mitm_tls", "BOOLEAN"},
+	}); err != nil {
+		return err
+	}
+	if err := ensureColumns(db, "proxy_list", []columnDef{
+		{"injects_content", "BOOLEAN"},
+		{"strips_headers", "BOOLEAN"},
+		{"mitm_tls", "BOOLEAN"},
+	}); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_checks_handshake_ms ON checks(handshake_ms)`); err != nil {
+		return fmt.Errorf("migrate schema: %w", err)
+	}
+	// Per-proxy history reads a proxy's checks newest first.
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_checks_proxy_checked_at ON checks(proxy_id, checked_at DESC)`); err != nil {
+		return fmt.Errorf("migrate schema: %w", err)
+	}
+
 	// Performance: Enable WAL mode for better concurrent read/write
 	_, err := db.Exec("PRAGMA journal_mode=WAL;")
 	if err != nil && err != sql.ErrNoRows {
@@ -265,6 +375,35 @@ func migrate(db *sqlx.DB) error {
 	return nil
 }
 
+type columnDef struct {
+	name string
+	def  string
+}
+
+// ensureColumns adds any missing columns to an existing SQLite table.
+func ensureColumns(db *sqlx.DB, table string, columns []columnDef) error {
+	var existing []struct {
+		Name string `db:"name"`
+	}
+	if err := db.Select(&existing, "SELECT name FROM pragma_table_info(?)", table); err != nil {
+		return fmt.Errorf("inspect %s columns: %w", table, err)
+	}
+	have := make(map[string]bool, len(existing))
+	for _, col := range existing {
+		have[col.Name] = true
+	}
+
+	for _, col := range columns {
+		if have[col.name] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, col.name, col.def)); err != nil {
+			return fmt.Errorf("add column %s.%s: %w", table, col.name, err)
+		}
+	}
+	return nil
+}
+
 // OpenStore creates a store based on configuration
 // Prefers PostgreSQL if DATABASE_URL is provided, otherwise falls back to SQLite
 func OpenStore(databaseURL, databaseSchema, sqlitePath string) (*UnifiedStore, error) {
@@ -346,6 +485,36 @@ func (s *UnifiedStore) CountProxies(ctx context.Context) (int, error) {
 	}
 }
 
+// GetProxyDetail forwards to the appropriate backend
+func (s *UnifiedStore) GetProxyDetail(ctx context.Context, ip string, port int, recent int) (ProxyDetail, error) {
+	switch s.backend {
+	case BackendPostgres:
+		return s.postgres.GetProxyDetail(ctx, ip, port, recent)
+	default:
+		return s.sqlite.GetProxyDetail(ctx, ip, port, recent)
+	}
+}
+
+// ListProxyChecks forwards to the appropriate backend
+func (s *UnifiedStore) ListProxyChecks(ctx context.Context, filters ProxyHistoryFilters) ([]CheckRecord, int, error) {
+	switch s.backend {
+	case BackendPostgres:
+		return s.postgres.ListProxyChecks(ctx, filters)
+	default:
+		return s.sqlite.ListProxyChecks(ctx, filters)
+	}
+}
+
+// AggregateProxyChecks forwards to the appropriate backend
+func (s *UnifiedStore) AggregateProxyChecks(ctx context.Context, filters ProxyHistoryFilters, bucket string) ([]CheckBucket, error) {
+	switch s.backend {
+	case BackendPostgres:
+		return s.postgres.AggregateProxyChecks(ctx, filters, bucket)
+	default:
+		return s.sqlite.AggregateProxyChecks(ctx, filters, bucket)
+	}
+}
+
 // UpsertProxyListBatch forwards to the appropriate backend
 func (s *UnifiedStore) UpsertProxyListBatch(ctx context.Context, records []ProxyListRecord) (int, error) {
 	switch s.backend {
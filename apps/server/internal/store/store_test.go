@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestStore_InsertCheck_Phases(t *testing.T) {
+	store, err := Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	defer store.DB.Close()
+
+	ctx := context.Background()
+	proxyID, err := store.UpsertProxy(ctx, ProxyRecord{Address: "1.2.3.4:1080", Protocol: "socks5", LastStatus: true})
+	if err != nil {
+		t.Fatalf("failed to upsert proxy: %v", err)
+	}
+
+	err = store.InsertCheck(ctx, CheckRecord{
+		ProxyID:     proxyID,
+		Status:      true,
+		Latency:     120,
+		CheckedAt:   time.Now().UTC(),
+		ConnectMS:   20,
+		HandshakeMS: 35,
+		TunnelMS:    40,
+		TTFBMS:      25,
+	})
+	if err != nil {
+		t.Fatalf("failed to insert check: %v", err)
+	}
+
+	var got CheckRecord
+	if err := store.DB.Get(&got, `SELECT id, proxy_id, status, latency, checked_at, ip, country, anonymity,
+		connect_ms, handshake_ms, tunnel_ms, tls_ms, ttfb_ms FROM checks WHERE proxy_id = ?`, proxyID); err != nil {
+		t.Fatalf("failed to read check: %v", err)
+	}
+	if got.ConnectMS != 20 || got.HandshakeMS != 35 || got.TunnelMS != 40 || got.TLSMS != 0 || got.TTFBMS != 25 {
+		t.Errorf("unexpected phases: %+v", got)
+	}
+}
+
+func TestStore_InsertCheck_DNS(t *testing.T) {
+	store, err := Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	defer store.DB.Close()
+
+	ctx := context.Background()
+	proxyID, err := store.UpsertProxy(ctx, ProxyRecord{Address: "1.2.3.4:1080", Protocol: "socks5h", LastStatus: true})
+	if err != nil {
+		t.Fatalf("failed to upsert proxy: %v", err)
+	}
+
+	remote, leak := true, false
+	for _, record := range []CheckRecord{
+		{ProxyID: proxyID, Status: true, DNSMode: "remote", RemoteDNS: &remote, DNSLeak: &leak},
+		{ProxyID: proxyID, Status: true},
+	} {
+		if err := store.InsertCheck(ctx, record); err != nil {
+			t.Fatalf("failed to insert check: %v", err)
+		}
+	}
+
+	var got []CheckRecord
+	if err := store.DB.Select(&got, `SELECT id, proxy_id, dns_mode, remote_dns, dns_leak
+		FROM checks WHERE proxy_id = ? ORDER BY id`, proxyID); err != nil {
+		t.Fatalf("failed to read checks: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 checks, got %d", len(got))
+	}
+	if got[0].DNSMode != "remote" || got[0].RemoteDNS == nil || !*got[0].RemoteDNS || got[0].DNSLeak == nil || *got[0].DNSLeak {
+		t.Errorf("unexpected DNS columns: %+v", got[0])
+	}
+	if got[1].RemoteDNS != nil || got[1].DNSLeak != nil {
+		t.Errorf("expected NULL DNS columns when the test did not run, got %+v", got[1])
+	}
+}
+
+func TestMigrate_AddsMissingCheckColumns(t *testing.T) {
+	path := t.TempDir() + "/legacy.db"
+	legacy, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("failed to open legacy db: %v", err)
+	}
+	if _, err := legacy.Exec(`CREATE TABLE checks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		proxy_id INTEGER NOT NULL,
+		status BOOLEAN,
+		latency INTEGER,
+		checked_at DATETIME,
+		ip TEXT,
+		country TEXT,
+		anonymity TEXT
+	)`); err != nil {
+		t.Fatalf("failed to create legacy table: %v", err)
+	}
+	legacy.Close()
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("failed to migrate legacy db: %v", err)
+	}
+	defer store.DB.Close()
+
+	if err := store.InsertCheck(context.Background(), CheckRecord{ProxyID: 1, HandshakeMS: 12}); err != nil {
+		t.Fatalf("insert after migration failed: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package ws
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"socksproxies.com/server/internal/rate"
+)
+
+var errInvalidCredentials = errors.New("invalid api key or token")
+
+// caller is who a check request comes from: the subject its quotas and
+// scheduling are keyed by, and its tier.
+type caller struct {
+	subject string
+	tier    rate.Tier
+}
+
+// identify authenticates a request by API key or signed token, given as a
+// bearer token or, for browsers that cannot set headers on a WebSocket or an
+// EventSource, the token query parameter. The api_key query parameter is
+// only read on WebSocket upgrades. Requests without credentials are
+// anonymous and free; bad credentials are an error rather than a downgrade.
+func (h *Handler) identify(c *gin.Context) (caller, error) {
+	credential := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	if credential == "" {
+		credential = c.Query("token")
+	}
+	if credential == "" && websocket.IsWebSocketUpgrade(c.Request) {
+		credential = c.Query("api_key")
+	}
+	if credential == "" {
+		return caller{subject: c.ClientIP(), tier: rate.TierFree}, nil
+	}
+
+	for _, key := range h.cfg.APIKeys {
+		if key != "" && subtle.ConstantTimeCompare([]byte(credential), []byte(key)) == 1 {
+			tier := rate.TierBasic
+			if t, ok := h.cfg.APIKeyTiers[key]; ok {
+				tier = parseTier(t)
+			}
+			return caller{subject: "apikey:" + keyID(key), tier: tier}, nil
+		}
+	}
+	if claims, ok := verifyToken(credential, h.cfg.JWTSecret, time.Now()); ok {
+		return caller{subject: "user:" + claims.Subject, tier: parseTier(claims.Tier)}, nil
+	}
+	return caller{}, errInvalidCredentials
+}
+
+// keyID names an API key in quota keys, job owners and logs without giving
+// the key away.
+func keyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// tokenClaims are the claims read from a signed token.
+type tokenClaims struct {
+	Subject string `json:"sub"`
+	Tier    string `json:"tier"`
+	Expires int64  `json:"exp"`
+}
+
+// verifyToken checks an HS256 JWT signed with secret and returns its claims.
+// Tokens need a subject and an expiry in the future.
+func verifyToken(token, secret string, now time.Time) (tokenClaims, bool) {
+	if secret == "" {
+		return tokenClaims{}, false
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return tokenClaims{}, false
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if !decodeSegment(parts[0], &header) || header.Alg != "HS256" {
+		return tokenClaims{}, false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return tokenClaims{}, false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return tokenClaims{}, false
+	}
+
+	var claims tokenClaims
+	if !decodeSegment(parts[1], &claims) || claims.Subject == "" || claims.Expires <= now.Unix() {
+		return tokenClaims{}, false
+	}
+	return claims, true
+}
+
+func decodeSegment(segment string, v any) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(raw, v) == nil
+}
+
+func parseTier(tier string) rate.Tier {
+	switch rate.Tier(strings.ToLower(tier)) {
+	case rate.TierPro:
+		return rate.TierPro
+	case rate.TierBasic:
+		return rate.TierBasic
+	default:
+		return rate.TierFree
+	}
+}
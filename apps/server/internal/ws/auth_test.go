@@ -0,0 +1,186 @@
+package ws
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"socksproxies.com/server/internal/config"
+	"socksproxies.com/server/internal/rate"
+)
+
+func signToken(header, claims, secret string) string {
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(header)) + "." + enc.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyToken(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	hs256 := `{"alg":"HS256","typ":"JWT"}`
+	valid := `{"sub":"42","tier":"pro","exp":1700000600}`
+
+	claims, ok := verifyToken(signToken(hs256, valid, "secret"), "secret", now)
+	if !ok || claims.Subject != "42" || claims.Tier != "pro" {
+		t.Fatalf("expected a valid token, got %+v %v", claims, ok)
+	}
+
+	tests := map[string]string{
+		"wrong secret": signToken(hs256, valid, "other"),
+		"expired":      signToken(hs256, `{"sub":"42","exp":1699999999}`, "secret"),
+		"no subject":   signToken(hs256, `{"exp":1700000600}`, "secret"),
+		"alg none":     signToken(`{"alg":"none"}`, valid, "secret"),
+		"malformed":    "not-a-token",
+	}
+	for name, token := range tests {
+		if _, ok := verifyToken(token, "secret", now); ok {
+			t.Errorf("%s: expected the token to be rejected", name)
+		}
+	}
+	if _, ok := verifyToken(signToken(hs256, valid, ""), "", now); ok {
+		t.Error("expected tokens to be rejected without a secret")
+	}
+}
+
+func TestHandler_Identify(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{cfg: config.Config{
+		APIKeys:     []string{"basic-key", "pro-key"},
+		APIKeyTiers: map[string]string{"pro-key": "pro"},
+		JWTSecret:   "secret",
+	}}
+	token := signToken(`{"alg":"HS256"}`, `{"sub":"7","tier":"basic","exp":`+strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)+`}`, "secret")
+
+	tests := []struct {
+		name    string
+		target  string
+		auth    string
+		upgrade bool
+		subject string
+		tier    rate.Tier
+		wantErr bool
+	}{
+		{name: "anonymous", target: "/ws", subject: "192.0.2.1", tier: rate.TierFree},
+		{name: "default key tier", target: "/ws", auth: "Bearer basic-key", subject: "apikey:" + keyID("basic-key"), tier: rate.TierBasic},
+		{name: "key in upgrade query", target: "/ws?api_key=pro-key", upgrade: true, subject: "apikey:" + keyID("pro-key"), tier: rate.TierPro},
+		{name: "key in plain query", target: "/api/checks?api_key=pro-key", subject: "192.0.2.1", tier: rate.TierFree},
+		{name: "token in query", target: "/ws?token=" + token, subject: "user:7", tier: rate.TierBasic},
+		{name: "bad key", target: "/ws", auth: "Bearer nope", wantErr: true},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, tt.target, nil)
+		c.Request.RemoteAddr = "192.0.2.1:5000"
+		if tt.auth != "" {
+			c.Request.Header.Set("Authorization", tt.auth)
+		}
+		if tt.upgrade {
+			c.Request.Header.Set("Connection", "Upgrade")
+			c.Request.Header.Set("Upgrade", "websocket")
+		}
+		who, err := h.identify(c)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil || who.subject != tt.subject || who.tier != tt.tier {
+			t.Errorf("%s: got %+v, %v", tt.name, who, err)
+		}
+	}
+}
+
+func TestHandler_CheckQuota(t *testing.T) {
+	useTestProbers()
+	cfg := config.Config{
+		JudgeURL:         "http://judge.invalid",
+		MaxConcurrent:    4,
+		CheckClientQueue: 4,
+		CheckDailyQuota:  config.RateLimitTier{Free: 2, Basic: 10, Pro: 100},
+	}
+	quota := rate.NewLimiterWithConfig(rate.NewMemoryCounter(), rate.LimiterConfig{
+		FreeLimit:      cfg.CheckDailyQuota.Free,
+		BasicLimit:     cfg.CheckDailyQuota.Basic,
+		ProLimit:       cfg.CheckDailyQuota.Pro,
+		WindowDuration: 24 * time.Hour,
+	})
+	h := NewHandler(cfg, nil, nil, nil, WithCheckQuota(quota))
+	who := caller{subject: "192.0.2.1", tier: rate.TierFree}
+	data := payload{Proxies: []string{"192.0.2.10:1080", "192.0.2.11:1080", "192.0.2.12:1080"}, Protocol: "socks5", Prober: "ws-test-slow"}
+
+	b, rerr := h.newBatch(context.Background(), who, data, h.batchLimit(who.tier))
+	if rerr != nil {
+		t.Fatalf("newBatch: %+v", rerr)
+	}
+	summary := h.runBatch(context.Background(), b, func(batchEvent) {})
+	if !summary.QuotaExceeded || summary.Completed != 2 {
+		t.Errorf("expected the quota to stop the batch after 2 checks, got %+v", summary)
+	}
+	if summary.Quota == nil || summary.Quota.Limit != 2 || summary.Quota.Remaining != 0 {
+		t.Errorf("expected the summary to report an exhausted quota, got %+v", summary.Quota)
+	}
+
+	if _, rerr := h.newBatch(context.Background(), who, data, h.batchLimit(who.tier)); rerr == nil || rerr.code != codeQuotaExceeded {
+		t.Errorf("expected QUOTA_EXCEEDED once the quota is spent, got %+v", rerr)
+	}
+	other := caller{subject: "apikey:k", tier: rate.TierBasic}
+	if _, rerr := h.newBatch(context.Background(), other, data, h.batchLimit(other.tier)); rerr != nil {
+		t.Errorf("expected other callers to keep their quota, got %+v", rerr)
+	}
+}
+
+func TestHandler_CheckQuota_OnlyChecksThatRun(t *testing.T) {
+	useTestProbers()
+	cfg := config.Config{
+		JudgeURL:         "http://judge.invalid",
+		MaxConcurrent:    4,
+		CheckClientQueue: 4,
+		CheckDailyQuota:  config.RateLimitTier{Free: 10},
+	}
+	quota := rate.NewLimiterWithConfig(rate.NewMemoryCounter(), rate.LimiterConfig{
+		FreeLimit:      cfg.CheckDailyQuota.Free,
+		WindowDuration: 24 * time.Hour,
+	})
+	h := NewHandler(cfg, nil, nil, nil, WithCheckQuota(quota))
+	h.pool.Close()
+	who := caller{subject: "192.0.2.1", tier: rate.TierFree}
+	data := payload{Proxies: []string{"192.0.2.10:1080", "192.0.2.11:1080"}, Protocol: "socks5", Prober: "ws-test-slow"}
+
+	b, rerr := h.newBatch(context.Background(), who, data, h.batchLimit(who.tier))
+	if rerr != nil {
+		t.Fatalf("newBatch: %+v", rerr)
+	}
+	summary := h.runBatch(context.Background(), b, func(batchEvent) {})
+	if summary.Failed != 2 {
+		t.Errorf("expected both proxies to be refused by the closed pool, got %+v", summary)
+	}
+	if summary.Quota == nil || summary.Quota.Used != 0 {
+		t.Errorf("expected checks that never ran to leave the quota alone, got %+v", summary.Quota)
+	}
+}
+
+func TestHandler_RejectsBadCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ws", newV2Handler().Handle)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/ws?api_key=wrong", nil)
+	req.Header.Set("Origin", "http://allowed.test")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 before the upgrade, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,307 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"socksproxies.com/server/internal/api"
+	"socksproxies.com/server/internal/checker"
+	"socksproxies.com/server/internal/rate"
+)
+
+const (
+	// maxBatchProxies caps one batch for tiers without a configured limit.
+	maxBatchProxies = 500
+	batchTimeout    = 5 * time.Minute
+)
+
+// Error codes shared by every way of submitting a check.
+const (
+	codeInvalidRequest        = "INVALID_REQUEST"
+	codeEmptyProxyList        = "EMPTY_PROXY_LIST"
+	codeLimitExceeded         = "LIMIT_EXCEEDED"
+	codeInvalidInput          = "INVALID_INPUT"
+	codeInvalidTargets        = "INVALID_TARGETS"
+	codeInvalidSampling       = "INVALID_SAMPLING"
+	codeUnknownProber         = "UNKNOWN_PROBER"
+	codeThroughputUnavailable = "THROUGHPUT_UNAVAILABLE"
+	codeTamperUnavailable     = "TAMPER_UNAVAILABLE"
+	codeQuotaExceeded         = "QUOTA_EXCEEDED"
+)
+
+// requestError is a check request that was turned down.
+type requestError struct {
+	status  int
+	code    string
+	message string
+	details any
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func badRequest(code, message string) *requestError {
+	return &requestError{status: http.StatusBadRequest, code: code, message: message}
+}
+
+// batch is a validated check request, ready to run. entries yields its
+// proxies by index; for uploaded lists it reads them from disk as it goes.
+type batch struct {
+	who             caller
+	data            payload
+	total           int
+	entries         iter.Seq2[int, string]
+	prober          checker.Prober
+	throughputBytes int64
+}
+
+// batchEvent is something a running batch reports about the proxy at Index:
+// either its result, or that it is queued behind a politeness cap.
+type batchEvent struct {
+	Index  int
+	Proxy  string
+	Result *checker.ProxyResult
+	Reason string
+}
+
+// batchSummary totals a finished batch. QuotaExceeded is set when the
+// daily quota ran out before every proxy was checked.
+type batchSummary struct {
+	Total         int          `json:"total"`
+	Completed     int          `json:"completed"`
+	Working       int          `json:"working"`
+	Failed        int          `json:"failed"`
+	Flaky         int          `json:"flaky"`
+	Cancelled     bool         `json:"cancelled"`
+	QuotaExceeded bool         `json:"quota_exceeded,omitempty"`
+	DurationMS    int64        `json:"duration_ms"`
+	Quota         *quotaStatus `json:"quota,omitempty"`
+}
+
+// quotaStatus reports a caller's daily check quota.
+type quotaStatus struct {
+	Tier      rate.Tier `json:"tier"`
+	Limit     int       `json:"limit"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+}
+
+func (s *batchSummary) add(res checker.ProxyResult) {
+	s.Completed++
+	if res.Status {
+		s.Working++
+	} else {
+		s.Failed++
+	}
+	if res.Sampling != nil && res.Sampling.Verdict == checker.VerdictFlaky {
+		s.Flaky++
+	}
+}
+
+// newBatch validates a request the same way for every transport. limit caps
+// the number of proxies.
+func (h *Handler) newBatch(ctx context.Context, who caller, data payload, limit int) (batch, *requestError) {
+	if len(data.Proxies) == 0 {
+		return batch{}, badRequest(codeEmptyProxyList, "empty proxy list")
+	}
+	if len(data.Proxies) > limit {
+		return batch{}, badRequest(codeLimitExceeded, fmt.Sprintf("limit exceeded (max %d)", limit))
+	}
+	for _, p := range data.Proxies {
+		if api.ContainsSQLInjection(p) || api.ContainsXSS(p) {
+			return batch{}, badRequest(codeInvalidInput, "invalid input detected")
+		}
+	}
+
+	b, rerr := h.prepareBatch(ctx, who, data)
+	if rerr != nil {
+		return batch{}, rerr
+	}
+	b.total = len(data.Proxies)
+	b.entries = slices.All(data.Proxies)
+	return b, nil
+}
+
+// prepareBatch validates the options of a request, leaving the proxy list
+// to the caller.
+func (h *Handler) prepareBatch(ctx context.Context, who caller, data payload) (batch, *requestError) {
+	if err := checker.ValidateTargets(data.Targets); err != nil {
+		return batch{}, badRequest(codeInvalidTargets, err.Error())
+	}
+	if err := checker.ValidateSamplePolicy(h.samplePolicy(data)); err != nil {
+		return batch{}, badRequest(codeInvalidSampling, err.Error())
+	}
+	prober, ok := checker.LookupProber(data.Prober)
+	if !ok {
+		err := badRequest(codeUnknownProber, "unknown prober")
+		err.details = gin.H{"available": checker.ProberNames()}
+		return batch{}, err
+	}
+
+	throughputBytes := h.throughputBytes(data, who.tier)
+	if data.Throughput && throughputBytes == 0 {
+		return batch{}, &requestError{status: http.StatusForbidden, code: codeThroughputUnavailable, message: "throughput test not available for this tier"}
+	}
+	if data.Tamper && h.cfg.FixtureURL == "" && h.cfg.TLSFixtureURL == "" {
+		return batch{}, &requestError{status: http.StatusServiceUnavailable, code: codeTamperUnavailable, message: "tamper test not configured"}
+	}
+	if quota := h.quotaStatus(ctx, who); quota != nil && quota.Remaining == 0 {
+		return batch{}, &requestError{status: http.StatusTooManyRequests, code: codeQuotaExceeded, message: "daily check quota exceeded", details: quota}
+	}
+
+	return batch{who: who, data: data, prober: prober, throughputBytes: throughputBytes}, nil
+}
+
+// batchLimit is the largest batch a tier may submit.
+func (h *Handler) batchLimit(tier rate.Tier) int {
+	if n := h.cfg.CheckBatchMax.ForTier(string(tier)); n > 0 {
+		return n
+	}
+	return maxBatchProxies
+}
+
+// jobLimit is how many jobs a caller of the tier may run at once.
+func (h *Handler) jobLimit(tier rate.Tier) int {
+	if n := h.cfg.CheckJobsMax.ForTier(string(tier)); n > 0 {
+		return n
+	}
+	return maxJobsPerClient
+}
+
+// quotaStatus reports the caller's daily quota, or nil when checks are not
+// metered.
+func (h *Handler) quotaStatus(ctx context.Context, who caller) *quotaStatus {
+	if h.quota == nil {
+		return nil
+	}
+	usage, err := h.quota.GetUsage(ctx, quotaSubject(who))
+	if err != nil || usage == nil {
+		return nil
+	}
+	limit := h.cfg.CheckDailyQuota.ForTier(string(who.tier))
+	used := min(usage["current"], int64(limit))
+	return &quotaStatus{Tier: who.tier, Limit: limit, Used: used, Remaining: int64(limit) - used}
+}
+
+func quotaSubject(who caller) string {
+	return "checks:" + who.subject
+}
+
+// runBatch checks every proxy of b and reports each one through emit, which
+// may be called concurrently. Proxies still waiting when ctx ends are
+// skipped and the summary is marked cancelled.
+func (h *Handler) runBatch(ctx context.Context, b batch, emit func(batchEvent)) batchSummary {
+	start := time.Now()
+	opts := h.checkOptions(b.data, b.throughputBytes)
+
+	var (
+		mu      sync.Mutex
+		summary = batchSummary{Total: b.total}
+		wg      sync.WaitGroup
+	)
+	report := func(index int, raw string, res checker.ProxyResult) {
+		mu.Lock()
+		summary.add(res)
+		mu.Unlock()
+		emit(batchEvent{Index: index, Proxy: raw, Result: &res})
+	}
+	// Every proxy that gets checked counts against the daily quota, metered
+	// as its check starts. Once it runs out the rest of the list is skipped.
+	var quotaExceeded atomic.Bool
+	meter := func() bool {
+		if h.quota == nil {
+			return true
+		}
+		allowed, _, err := h.quota.AllowTier(ctx, quotaSubject(b.who), b.who.tier)
+		if err != nil {
+			log.Printf("[WARN] check quota error for %s: %v", b.who.subject, err)
+			return true
+		}
+		if !allowed {
+			quotaExceeded.Store(true)
+		}
+		return allowed
+	}
+	// Backpressure: stop reading the list while this batch has a full client
+	// queue of checks outstanding.
+	pending := make(chan struct{}, h.pool.QueueLimit())
+
+outer:
+	for i, raw := range b.entries {
+		if ctx.Err() != nil || quotaExceeded.Load() {
+			break
+		}
+		target, err := checker.ParseProxyLine(raw, b.data.Protocol)
+		if err != nil {
+			report(i, raw, checker.ProxyResult{Protocol: b.data.Protocol, Error: "invalid proxy"}.WithCheckedAt())
+			continue
+		}
+
+		select {
+		case pending <- struct{}{}:
+		case <-ctx.Done():
+			break outer
+		}
+		wg.Add(1)
+		go func(i int, raw string, target checker.ProxyTarget) {
+			defer wg.Done()
+			defer func() { <-pending }()
+			// A panic here, e.g. from a follower's callback, fails this
+			// proxy rather than the process.
+			reported := false
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("[PANIC] Recovered in proxy check: %v", r)
+					if !reported {
+						reported = true
+						defer func() { _ = recover() }()
+						report(i, raw, checker.ProxyResult{Protocol: target.Protocol, Error: "check failed"}.WithCheckedAt())
+					}
+				}
+			}()
+			// Politeness comes before the shared pool so a crowded subnet
+			// does not tie up workers.
+			release, err := h.politeness.Acquire(ctx, targetHost(target), func(reason string) {
+				emit(batchEvent{Index: i, Proxy: raw, Reason: reason})
+			})
+			if err != nil {
+				return
+			}
+			defer release()
+
+			err = h.runCheck(ctx, b.who.subject, b.who.tier, func() {
+				if !meter() {
+					return
+				}
+				res := b.prober.Probe(ctx, target, opts)
+				_ = h.saveResult(ctx, target, res)
+				reported = true
+				report(i, raw, res)
+			})
+			// A check the pool would not take, e.g. during shutdown, still
+			// gets a result unless the batch itself was cancelled.
+			if err != nil && ctx.Err() == nil {
+				reported = true
+				report(i, raw, checker.ProxyResult{Protocol: target.Protocol, Error: "check not run: " + err.Error()}.WithCheckedAt())
+			}
+		}(i, raw, target)
+	}
+	wg.Wait()
+
+	summary.QuotaExceeded = quotaExceeded.Load()
+
+	summary.Cancelled = ctx.Err() != nil
+	summary.DurationMS = time.Since(start).Milliseconds()
+	summary.Quota = h.quotaStatus(context.WithoutCancel(ctx), b.who)
+	return summary
+}
@@ -0,0 +1,69 @@
+package ws
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"socksproxies.com/server/internal/api"
+	"socksproxies.com/server/internal/checker"
+)
+
+const (
+	// maxRESTCheckProxies keeps a synchronous check short enough to answer
+	// within one request; bigger batches belong on the WebSocket.
+	maxRESTCheckProxies = 50
+	restCheckTimeout    = 2 * time.Minute
+)
+
+// Check is the REST equivalent of the WebSocket check: it takes the same
+// payload and answers once every proxy has been checked, with results in
+// request order.
+func (h *Handler) Check(c *gin.Context) {
+	var data payload
+	if err := c.ShouldBindJSON(&data); err != nil {
+		api.RespondError(c, http.StatusBadRequest, codeInvalidRequest, "invalid request body", nil)
+		return
+	}
+	who, err := h.identify(c)
+	if err != nil {
+		api.RespondError(c, http.StatusUnauthorized, "UNAUTHORIZED", err.Error(), nil)
+		return
+	}
+	b, rerr := h.newBatch(c.Request.Context(), who, data, maxRESTCheckProxies)
+	if rerr != nil {
+		if rerr.code == codeInvalidInput {
+			log.Printf("[SECURITY] Potential injection attempt from %s", c.ClientIP())
+		}
+		api.RespondError(c, rerr.status, rerr.code, rerr.message, rerr.details)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), restCheckTimeout)
+	defer cancel()
+
+	results := make([]checker.ProxyResult, len(data.Proxies))
+	checked := make([]bool, len(data.Proxies))
+	h.runBatch(ctx, b, func(ev batchEvent) {
+		if ev.Result != nil {
+			results[ev.Index] = *ev.Result
+			checked[ev.Index] = true
+		}
+	})
+	for i, ok := range checked {
+		if ok {
+			continue
+		}
+		// Skipped because the request ran out of time.
+		msg := "check not run"
+		if err := ctx.Err(); err != nil {
+			msg = err.Error()
+		}
+		results[i] = checker.ProxyResult{Protocol: data.Protocol, Error: msg}.WithCheckedAt()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
@@ -0,0 +1,235 @@
+package ws
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"socksproxies.com/server/internal/api"
+)
+
+const (
+	checkJobDefaultPageSize = 100
+	checkJobMaxPageSize     = 500
+)
+
+// CreateCheckJob starts a check job for an API client. It takes the same
+// payload as the WebSocket and answers at once with the job; progress and
+// results are polled from GetCheckJob.
+func (h *Handler) CreateCheckJob(c *gin.Context) {
+	who, err := h.identify(c)
+	if err != nil {
+		api.RespondError(c, http.StatusUnauthorized, "UNAUTHORIZED", err.Error(), nil)
+		return
+	}
+	job, ok := h.startCheckJob(c, who)
+	if !ok {
+		return
+	}
+	c.Header("Location", checkJobURL(job.ID))
+	c.JSON(http.StatusAccepted, gin.H{
+		"data":  job,
+		"links": checkJobLinks(job.ID),
+	})
+}
+
+// startCheckJob validates the request body and starts a job for the caller,
+// answering the request itself if it cannot.
+func (h *Handler) startCheckJob(c *gin.Context, who caller) (*CheckJob, bool) {
+	var data payload
+	if err := c.ShouldBindJSON(&data); err != nil {
+		api.RespondError(c, http.StatusBadRequest, codeInvalidRequest, "invalid request body", nil)
+		return nil, false
+	}
+	b, rerr := h.newBatch(c.Request.Context(), who, data, h.batchLimit(who.tier))
+	if rerr != nil {
+		if rerr.code == codeInvalidInput {
+			log.Printf("[SECURITY] Potential injection attempt from %s", c.ClientIP())
+		}
+		api.RespondError(c, rerr.status, rerr.code, rerr.message, rerr.details)
+		return nil, false
+	}
+	return h.launchCheckJob(c, who, b, nil)
+}
+
+// launchCheckJob starts a job for a validated batch, answering the request
+// itself if it cannot. cleanup, if set, runs once the job is over or failed
+// to start.
+func (h *Handler) launchCheckJob(c *gin.Context, who caller, b batch, cleanup func()) (*CheckJob, bool) {
+	jobID := uuid.NewString()
+	job, err := h.jobs.start(jobID, who.subject, h.jobLimit(who.tier), b.total, func(ctx context.Context, emit func(serverMessage)) batchSummary {
+		if cleanup != nil {
+			defer cleanup()
+		}
+		return h.runJob(ctx, jobID, b, emit)
+	})
+	if err != nil && cleanup != nil {
+		cleanup()
+	}
+	switch {
+	case errors.Is(err, errTooManyJobs):
+		api.RespondError(c, http.StatusTooManyRequests, codeTooManyJobs, fmt.Sprintf("too many running jobs (max %d)", h.jobLimit(who.tier)), nil)
+		return nil, false
+	case err != nil:
+		log.Printf("[WARN] starting check job failed: %v", err)
+		api.RespondError(c, http.StatusServiceUnavailable, codeJobUnavailable, "could not start job", nil)
+		return nil, false
+	}
+	return job, true
+}
+
+// GetCheckJob reports a job's progress and summary with a page of its
+// results, in the order they finished.
+func (h *Handler) GetCheckJob(c *gin.Context) {
+	job, ok := h.ownCheckJob(c)
+	if !ok {
+		return
+	}
+
+	offset := max(queryInt(c, "offset", 0), 0)
+	limit := min(max(queryInt(c, "limit", checkJobDefaultPageSize), 1), checkJobMaxPageSize)
+	results, err := h.jobs.results(c.Request.Context(), job.ID, offset, limit)
+	if err != nil {
+		respondCheckJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":    job,
+		"results": results,
+		"pagination": gin.H{
+			"offset": offset,
+			"limit":  limit,
+			"total":  job.Completed - job.ResultsDropped,
+		},
+		"links": checkJobLinks(job.ID),
+	})
+}
+
+// DownloadCheckJob sends every result of a finished job, in request order,
+// as CSV or JSON.
+func (h *Handler) DownloadCheckJob(c *gin.Context) {
+	format := strings.ToLower(c.DefaultQuery("format", "json"))
+	if format != "json" && format != "csv" {
+		api.RespondError(c, http.StatusBadRequest, "INVALID_FORMAT", "format must be csv or json", nil)
+		return
+	}
+	job, ok := h.ownCheckJob(c)
+	if !ok {
+		return
+	}
+	if job.Status == checkJobRunning {
+		api.RespondError(c, http.StatusConflict, "CHECK_JOB_NOT_READY", "check job is still running", nil)
+		return
+	}
+	results, err := h.jobs.results(c.Request.Context(), job.ID, 0, 0)
+	if err != nil {
+		respondCheckJobError(c, err)
+		return
+	}
+	slices.SortFunc(results, func(a, b jobResult) int { return a.Index - b.Index })
+
+	c.Header("Cache-Control", "private, max-age=60")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="check-%s.%s"`, job.ID, format))
+	if job.ResultsDropped > 0 {
+		c.Header("X-Results-Dropped", strconv.Itoa(job.ResultsDropped))
+	}
+	if format == "json" {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(c.Writer).Encode(gin.H{"data": job, "results": results})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{"index", "proxy", "ip", "port", "protocol", "status", "latency_ms", "country", "anonymity", "exit_ip", "verdict", "throughput_kbps", "throughput_completed", "error", "checked_at"})
+	for _, r := range results {
+		verdict := ""
+		if r.Result.Sampling != nil {
+			verdict = r.Result.Sampling.Verdict
+		}
+		kbps, completed := "", ""
+		if t := r.Result.Throughput; t != nil {
+			kbps, completed = strconv.FormatFloat(t.KBps, 'f', 1, 64), strconv.FormatBool(t.Completed)
+		}
+		_ = w.Write([]string{
+			strconv.Itoa(r.Index),
+			r.Proxy,
+			r.Result.IP,
+			r.Result.Port,
+			r.Result.Protocol,
+			strconv.FormatBool(r.Result.Status),
+			strconv.FormatInt(r.Result.Latency, 10),
+			r.Result.Country,
+			r.Result.Anonymity,
+			r.Result.ExitIP,
+			verdict,
+			kbps,
+			completed,
+			r.Result.Error,
+			r.Result.CheckedAt,
+		})
+	}
+	w.Flush()
+}
+
+// ownCheckJob loads the job named in the path for the caller that started
+// it, answering the request itself otherwise. Other callers' jobs are not
+// found.
+func (h *Handler) ownCheckJob(c *gin.Context) (CheckJob, bool) {
+	who, err := h.identify(c)
+	if err != nil {
+		api.RespondError(c, http.StatusUnauthorized, "UNAUTHORIZED", err.Error(), nil)
+		return CheckJob{}, false
+	}
+	jobID := strings.TrimSpace(c.Param("id"))
+	ctx := c.Request.Context()
+	if err := h.jobs.authorize(ctx, jobID, who.subject); err != nil {
+		respondCheckJobError(c, err)
+		return CheckJob{}, false
+	}
+	job, err := h.jobs.get(ctx, jobID)
+	if err != nil {
+		respondCheckJobError(c, err)
+		return CheckJob{}, false
+	}
+	return job, true
+}
+
+func respondCheckJobError(c *gin.Context, err error) {
+	if errors.Is(err, errJobNotFound) {
+		api.RespondError(c, http.StatusNotFound, "CHECK_JOB_NOT_FOUND", "check job not found", nil)
+		return
+	}
+	log.Printf("[WARN] loading check job failed: %v", err)
+	api.RespondError(c, http.StatusServiceUnavailable, codeJobUnavailable, "check job unavailable", nil)
+}
+
+func checkJobURL(id string) string {
+	return "/api/v1/checks/" + id
+}
+
+func checkJobLinks(id string) gin.H {
+	return gin.H{
+		"status":   checkJobURL(id),
+		"download": checkJobURL(id) + "/download",
+	}
+}
+
+func queryInt(c *gin.Context, name string, fallback int) int {
+	value, err := strconv.Atoi(c.Query(name))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
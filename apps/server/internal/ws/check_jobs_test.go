@@ -0,0 +1,147 @@
+package ws
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"socksproxies.com/server/internal/api"
+)
+
+func checkJobRouter(h *Handler) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	checks := router.Group("/api/v1/checks", api.RequireAPIKey(h.cfg.APIKeys))
+	checks.POST("", h.CreateCheckJob)
+	checks.POST("/upload", h.UploadCheckJob)
+	checks.GET("/:id", h.GetCheckJob)
+	checks.GET("/:id/download", h.DownloadCheckJob)
+	checks.GET("/:id/export/:format", h.ExportCheckJob)
+	return router
+}
+
+func serveCheckJob(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	return serveCheckJobAs(router, "test-key", method, path, body)
+}
+
+func serveCheckJobAs(router *gin.Engine, key, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+key)
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_CheckJob_Lifecycle(t *testing.T) {
+	router := checkJobRouter(newV2Handler())
+
+	rec := serveCheckJob(router, http.MethodPost, "/api/v1/checks", `{"proxies":["192.0.2.1:1080","bogus","198.51.100.1:1080"],"protocol":"socks5","prober":"ws-test-slow"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		Data CheckJob `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if created.Data.ID == "" || created.Data.Total != 3 || rec.Header().Get("Location") != "/api/v1/checks/"+created.Data.ID {
+		t.Fatalf("unexpected job %+v", created.Data)
+	}
+	path := "/api/v1/checks/" + created.Data.ID
+
+	if rec := serveCheckJob(router, http.MethodGet, path+"/download", ""); rec.Code != http.StatusConflict {
+		t.Errorf("expected a running job to refuse downloads, got %d", rec.Code)
+	}
+
+	var status struct {
+		Data    CheckJob    `json:"data"`
+		Results []jobResult `json:"results"`
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := serveCheckJob(router, http.MethodGet, path+"?limit=2", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if status.Data.Status != checkJobRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job did not finish")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if status.Data.Status != checkJobCompleted || status.Data.Completed != 3 || status.Data.Summary == nil || status.Data.Summary.Working != 2 {
+		t.Errorf("unexpected finished job %+v", status.Data)
+	}
+	if len(status.Results) != 2 {
+		t.Errorf("expected a page of 2 results, got %d", len(status.Results))
+	}
+
+	rec = serveCheckJob(router, http.MethodGet, path+"/download?format=csv", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(rows) != 4 || rows[2][0] != "1" || rows[2][1] != "bogus" || rows[2][5] != "false" {
+		t.Errorf("expected a header and 3 rows in request order, got %v", rows)
+	}
+	if rows[0][11] != "throughput_kbps" || rows[0][12] != "throughput_completed" {
+		t.Errorf("expected the throughput columns after the verdict, got %v", rows[0])
+	}
+
+	if rec := serveCheckJob(router, http.MethodGet, "/api/v1/checks/nope", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown job, got %d", rec.Code)
+	}
+}
+
+func TestHandler_CheckJob_OtherClients(t *testing.T) {
+	h := newV2Handler()
+	h.cfg.APIKeys = append(h.cfg.APIKeys, "other-key")
+	router := checkJobRouter(h)
+
+	rec := serveCheckJob(router, http.MethodPost, "/api/v1/checks", `{"proxies":["192.0.2.1:1080"],"protocol":"socks5","prober":"ws-test-slow"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		Data CheckJob `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	path := "/api/v1/checks/" + created.Data.ID
+
+	for _, p := range []string{path, path + "/download", path + "/export/txt"} {
+		if rec := serveCheckJobAs(router, "other-key", http.MethodGet, p, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404 for another client's job, got %d", p, rec.Code)
+		}
+	}
+	if rec := serveCheckJob(router, http.MethodGet, path, ""); rec.Code != http.StatusOK {
+		t.Errorf("expected the owner to see the job, got %d", rec.Code)
+	}
+}
+
+func TestHandler_CheckJob_RequiresAPIKey(t *testing.T) {
+	router := checkJobRouter(newV2Handler())
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/checks", strings.NewReader(`{"proxies":["192.0.2.1:1080"]}`))
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,140 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"socksproxies.com/server/internal/checker"
+	"socksproxies.com/server/internal/config"
+)
+
+// forwardProxy is a minimal HTTP proxy for absolute-URI requests.
+func forwardProxy(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.RequestURI = ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func postCheck(h *Handler, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/check", h.Check)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/check", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_Check_Targets(t *testing.T) {
+	judge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("203.0.113.5"))
+	}))
+	defer judge.Close()
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("in stock"))
+	}))
+	defer site.Close()
+	proxy := forwardProxy(t)
+
+	h := NewHandler(config.Config{JudgeURL: judge.URL, MaxConcurrent: 2}, nil, nil, nil)
+	proxyAddr := strings.TrimPrefix(proxy.URL, "http://")
+	body := `{"proxies":["` + proxyAddr + `","not a proxy"],"protocol":"http",` +
+		`"targets":[{"url":"` + site.URL + `","contains":"in stock","max_latency_ms":5000}]}`
+
+	rec := postCheck(h, body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Results []checker.ProxyResult `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(resp.Results))
+	}
+	first := resp.Results[0]
+	if !first.Status || len(first.Targets) != 1 || !first.Targets[0].Pass {
+		t.Errorf("expected the proxy to pass its target, got %+v", first)
+	}
+	if resp.Results[1].Status || resp.Results[1].Error != "invalid proxy" {
+		t.Errorf("expected the second line to be rejected, got %+v", resp.Results[1])
+	}
+}
+
+func TestHandler_Check_RejectsInvalidRequests(t *testing.T) {
+	h := NewHandler(config.Config{JudgeURL: "http://judge.invalid", MaxConcurrent: 1}, nil, nil, nil)
+
+	cases := map[string]string{
+		"empty":        `{"proxies":[]}`,
+		"bad_json":     `{"proxies":`,
+		"bad_target":   `{"proxies":["1.2.3.4:1080"],"targets":[{"url":"ftp://example.com"}]}`,
+		"bad_sampling": `{"proxies":["1.2.3.4:1080"],"sampling":{"samples":50}}`,
+		"too_many":     `{"proxies":[` + strings.Repeat(`"1.2.3.4:1080",`, maxRESTCheckProxies) + `"1.2.3.4:1080"]}`,
+	}
+	for name, body := range cases {
+		t.Run(name, func(t *testing.T) {
+			if rec := postCheck(h, body); rec.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+var (
+	registerStubProber sync.Once
+	stubProbed         atomic.Value
+)
+
+func TestHandler_Check_Prober(t *testing.T) {
+	registerStubProber.Do(func() {
+		checker.RegisterProber("ws-test-stub", checker.ProberFunc(func(ctx context.Context, target checker.ProxyTarget, opts checker.CheckOptions) checker.ProxyResult {
+			stubProbed.Store(target.Address)
+			return checker.ProxyResult{Protocol: target.Protocol, Status: true, Latency: 42}.WithCheckedAt()
+		}))
+	})
+
+	h := NewHandler(config.Config{JudgeURL: "http://judge.invalid", MaxConcurrent: 1}, nil, nil, nil)
+	rec := postCheck(h, `{"proxies":["192.0.2.1:1080"],"prober":"ws-test-stub"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Results []checker.ProxyResult `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Results) != 1 || resp.Results[0].Latency != 42 {
+		t.Errorf("expected the stub result, got %+v", resp.Results)
+	}
+	if got, _ := stubProbed.Load().(string); got != "192.0.2.1:1080" {
+		t.Errorf("expected the stub to probe the proxy, got %q", got)
+	}
+
+	if rec := postCheck(h, `{"proxies":["192.0.2.1:1080"],"prober":"nope"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown prober, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,323 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"socksproxies.com/server/internal/api"
+	"socksproxies.com/server/internal/config"
+	"socksproxies.com/server/internal/proxylist"
+	"socksproxies.com/server/internal/store"
+)
+
+const (
+	feedChannel = "proxylist:changes"
+	// feedLockKey makes one instance per sync publish, since every instance
+	// runs the syncer.
+	feedLockKey = "proxylist:changes:lock"
+	// feedChunk caps the changes in one pub/sub message.
+	feedChunk = 500
+	// feedBuffer is how many messages a subscriber may fall behind by before
+	// it is dropped.
+	feedBuffer = 4096
+)
+
+// Feed message types.
+const (
+	feedSubscribed = "subscribed"
+	feedSync       = "sync"
+	feedError      = "error"
+)
+
+// Feed fans proxy list changes out to WebSocket subscribers. With Redis the
+// syncing instance publishes and every instance delivers to its own
+// subscribers; without it changes only reach this instance's.
+type Feed struct {
+	redis    *redis.Client
+	interval time.Duration
+	ctx      context.Context
+	stop     context.CancelFunc
+	done     chan struct{}
+
+	mu   sync.Mutex
+	subs map[*feedSubscriber]struct{}
+}
+
+// feedBatch is one pub/sub message. A sync is published as one or more
+// batches; the last carries Last.
+type feedBatch struct {
+	SyncedAt time.Time          `json:"synced_at"`
+	Changes  []proxylist.Change `json:"changes"`
+	Last     bool               `json:"last"`
+}
+
+// feedEvent tells a subscriber about one proxy.
+type feedEvent struct {
+	Type     proxylist.ChangeType `json:"type"`
+	Proxy    api.ProxyListItem    `json:"proxy"`
+	SyncedAt time.Time            `json:"synced_at"`
+}
+
+// feedSummary closes a sync with the subscriber's share of its changes.
+type feedSummary struct {
+	Type     string    `json:"type"`
+	SyncedAt time.Time `json:"synced_at"`
+	Added    int       `json:"added"`
+	Removed  int       `json:"removed"`
+	Updated  int       `json:"updated"`
+}
+
+type feedSubscriber struct {
+	filters store.ProxyListFilters
+	ch      chan any
+	dropped chan struct{}
+	once    sync.Once
+	counts  map[proxylist.ChangeType]int
+}
+
+func (s *feedSubscriber) drop() {
+	s.once.Do(func() { close(s.dropped) })
+}
+
+// NewFeed starts listening for changes published by other instances.
+func NewFeed(cfg config.Config, redis *redis.Client) *Feed {
+	ctx, stop := context.WithCancel(context.Background())
+	f := &Feed{
+		redis:    redis,
+		interval: cfg.ProxySyncInterval,
+		ctx:      ctx,
+		stop:     stop,
+		done:     make(chan struct{}),
+		subs:     make(map[*feedSubscriber]struct{}),
+	}
+	if redis == nil {
+		close(f.done)
+		return f
+	}
+	go f.listen()
+	return f
+}
+
+// Close stops listening. Subscribers are left to their connections.
+func (f *Feed) Close() {
+	f.stop()
+	<-f.done
+}
+
+func (f *Feed) listen() {
+	defer close(f.done)
+	pubsub := f.redis.Subscribe(f.ctx, feedChannel)
+	defer pubsub.Close()
+
+	// The channel only closes with the pubsub, so Close is watched for here.
+	messages := pubsub.Channel()
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var batch feedBatch
+			if err := json.Unmarshal([]byte(msg.Payload), &batch); err != nil {
+				log.Printf("[WARN] bad proxy feed message: %v", err)
+				continue
+			}
+			f.dispatch(batch)
+		case <-f.ctx.Done():
+			return
+		}
+	}
+}
+
+// Publish sends the changes of a sync to subscribers on every instance. It
+// fits proxylist.SyncConfig.OnChange.
+func (f *Feed) Publish(ctx context.Context, changes []proxylist.Change) {
+	syncedAt := time.Now().UTC()
+	if f.redis == nil {
+		f.dispatch(feedBatch{SyncedAt: syncedAt, Changes: changes, Last: true})
+		return
+	}
+
+	// Another instance that synced moments ago has published the same list.
+	ok, err := f.redis.SetNX(ctx, feedLockKey, syncedAt.Unix(), max(f.interval/2, time.Second)).Result()
+	if err != nil {
+		log.Printf("[WARN] proxy feed lock failed: %v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	for start := 0; start < len(changes); start += feedChunk {
+		end := min(start+feedChunk, len(changes))
+		raw, err := json.Marshal(feedBatch{SyncedAt: syncedAt, Changes: changes[start:end], Last: end == len(changes)})
+		if err != nil {
+			log.Printf("[WARN] encoding proxy feed message failed: %v", err)
+			return
+		}
+		if err := f.redis.Publish(ctx, feedChannel, raw).Err(); err != nil {
+			log.Printf("[WARN] publishing proxy feed failed: %v", err)
+			return
+		}
+	}
+}
+
+// dispatch hands each subscriber the changes that match its filters. A
+// subscriber too far behind to take them is dropped rather than waited for.
+func (f *Feed) dispatch(batch feedBatch) {
+	items := make([]api.ProxyListItem, len(batch.Changes))
+	for i, change := range batch.Changes {
+		items[i] = api.NewProxyListItem(change.Record)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for sub := range f.subs {
+		messages := make([]any, 0)
+		for i, change := range batch.Changes {
+			if sub.filters.Matches(change.Record) {
+				sub.counts[change.Type]++
+				messages = append(messages, feedEvent{Type: change.Type, Proxy: items[i], SyncedAt: batch.SyncedAt})
+			}
+		}
+		if batch.Last {
+			messages = append(messages, feedSummary{
+				Type:     feedSync,
+				SyncedAt: batch.SyncedAt,
+				Added:    sub.counts[proxylist.ChangeAdded],
+				Removed:  sub.counts[proxylist.ChangeRemoved],
+				Updated:  sub.counts[proxylist.ChangeUpdated],
+			})
+			clear(sub.counts)
+		}
+		for _, msg := range messages {
+			select {
+			case sub.ch <- msg:
+			default:
+				sub.drop()
+				delete(f.subs, sub)
+			}
+		}
+	}
+}
+
+func (f *Feed) subscribe(filters store.ProxyListFilters) *feedSubscriber {
+	sub := &feedSubscriber{
+		filters: filters,
+		ch:      make(chan any, feedBuffer),
+		dropped: make(chan struct{}),
+		counts:  make(map[proxylist.ChangeType]int),
+	}
+	f.mu.Lock()
+	f.subs[sub] = struct{}{}
+	f.mu.Unlock()
+	return sub
+}
+
+func (f *Feed) unsubscribe(sub *feedSubscriber) {
+	f.mu.Lock()
+	delete(f.subs, sub)
+	f.mu.Unlock()
+}
+
+// ServeFeed subscribes a WebSocket to proxy list changes. It takes the
+// filters of the proxy list API from the query string, e.g.
+// /ws/feed?country=US&protocol=socks5, and after every sync sends an added,
+// removed or updated message per matching proxy, then a sync summary.
+func (h *Handler) ServeFeed(c *gin.Context) {
+	if h.feed == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "proxy feed unavailable"})
+		return
+	}
+	clientIP := c.ClientIP()
+	release, ok := h.admit(c, clientIP)
+	if !ok {
+		return
+	}
+	defer release()
+	filters := api.ParseProxyListFilters(c)
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("[WARN] websocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(4 << 10)
+	stopPings := h.keepAlive(conn, clientIP)
+	defer stopPings()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := newOutbox(conn, 64, cancel)
+	defer out.close()
+
+	sub := h.feed.subscribe(filters)
+	defer h.feed.unsubscribe(sub)
+
+	// Nothing is expected from the client; reading notices when it leaves.
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	out.send(ctx, gin.H{"type": feedSubscribed, "filters": feedFilters(filters)})
+	for {
+		select {
+		case msg := <-sub.ch:
+			if !out.send(ctx, msg) {
+				return
+			}
+		case <-sub.dropped:
+			out.send(ctx, gin.H{"type": feedError, "message": "feed fell too far behind"})
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// feedFilters echoes the filters a subscriber got, in query parameter names.
+func feedFilters(filters store.ProxyListFilters) gin.H {
+	out := gin.H{}
+	for name, value := range map[string]string{
+		"country":   filters.CountryCode,
+		"protocol":  filters.Protocol,
+		"anonymity": filters.Anonymity,
+		"city":      filters.City,
+		"region":    filters.Region,
+	} {
+		if value != "" {
+			out[name] = value
+		}
+	}
+	for name, value := range map[string]int{
+		"port":       filters.Port,
+		"asn":        filters.ASN,
+		"ip_version": filters.IPVersion,
+	} {
+		if value != 0 {
+			out[name] = value
+		}
+	}
+	for name, value := range map[string]*bool{
+		"injects_content": filters.InjectsContent,
+		"strips_headers":  filters.StripsHeaders,
+		"mitm_tls":        filters.MITMTLS,
+	} {
+		if value != nil {
+			out[name] = *value
+		}
+	}
+	return out
+}
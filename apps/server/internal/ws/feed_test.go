@@ -0,0 +1,130 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+
+	"socksproxies.com/server/internal/config"
+	"socksproxies.com/server/internal/proxylist"
+	"socksproxies.com/server/internal/store"
+)
+
+func TestHandler_ServeFeed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := newV2Handler()
+	feed := NewFeed(h.cfg, nil)
+	defer feed.Close()
+	h.feed = feed
+
+	router := gin.New()
+	router.GET("/ws/feed", h.ServeFeed)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	header := http.Header{"Origin": []string{"http://allowed.test"}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/feed?country=us&protocol=socks5", header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var subscribed struct {
+		Type    string            `json:"type"`
+		Filters map[string]string `json:"filters"`
+	}
+	if err := conn.ReadJSON(&subscribed); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if subscribed.Type != feedSubscribed || subscribed.Filters["country"] != "US" || subscribed.Filters["protocol"] != "socks5" {
+		t.Fatalf("unexpected subscription %+v", subscribed)
+	}
+
+	feed.Publish(context.Background(), []proxylist.Change{
+		{Type: proxylist.ChangeAdded, Record: store.ProxyListRecord{IP: "192.0.2.1", Port: 1080, CountryCode: "US", Socks5: 1}},
+		{Type: proxylist.ChangeAdded, Record: store.ProxyListRecord{IP: "192.0.2.2", Port: 1080, CountryCode: "DE", Socks5: 1}},
+		{Type: proxylist.ChangeRemoved, Record: store.ProxyListRecord{IP: "192.0.2.3", Port: 8080, CountryCode: "US", HTTP: 1}},
+		{Type: proxylist.ChangeUpdated, Record: store.ProxyListRecord{IP: "192.0.2.4", Port: 1080, CountryCode: "US", Socks5: 1}},
+	})
+
+	var messages []json.RawMessage
+	for {
+		var msg json.RawMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		messages = append(messages, msg)
+		if strings.Contains(string(msg), `"type":"sync"`) {
+			break
+		}
+	}
+	if len(messages) != 3 {
+		t.Fatalf("expected two matching changes and a summary, got %s", messages)
+	}
+	var event feedEvent
+	if err := json.Unmarshal(messages[0], &event); err != nil || event.Type != proxylist.ChangeAdded || event.Proxy.IP != "192.0.2.1" {
+		t.Errorf("unexpected first event %s", messages[0])
+	}
+	var summary feedSummary
+	if err := json.Unmarshal(messages[2], &summary); err != nil || summary.Added != 1 || summary.Updated != 1 || summary.Removed != 0 {
+		t.Errorf("unexpected summary %s", messages[2])
+	}
+}
+
+func TestHandler_ServeFeed_Unavailable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ws/feed", newV2Handler().ServeFeed)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ws/feed", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without a feed, got %d", rec.Code)
+	}
+}
+
+func TestFeed_Redis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	feed := NewFeed(config.Config{ProxySyncInterval: time.Minute}, client)
+	sub := feed.subscribe(store.ProxyListFilters{})
+
+	raw, _ := json.Marshal(feedBatch{
+		Changes: []proxylist.Change{{Type: proxylist.ChangeAdded, Record: store.ProxyListRecord{IP: "192.0.2.1", Port: 1080}}},
+		Last:    true,
+	})
+	// The subscription is made in the background; publish until it is.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sub.ch) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no message from redis")
+		}
+		mr.Publish(feedChannel, string(raw))
+		time.Sleep(20 * time.Millisecond)
+	}
+	if event, ok := (<-sub.ch).(feedEvent); !ok || event.Proxy.IP != "192.0.2.1" {
+		t.Errorf("expected the published change, got %+v", event)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		feed.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+}
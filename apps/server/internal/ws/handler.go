@@ -3,6 +3,7 @@ package ws
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
@@ -11,11 +12,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 
-	"socksproxies.com/server/internal/api"
 	"socksproxies.com/server/internal/checker"
 	"socksproxies.com/server/internal/config"
 	"socksproxies.com/server/internal/geoip"
 	"socksproxies.com/server/internal/rate"
+	"socksproxies.com/server/internal/scheduler"
 	"socksproxies.com/server/internal/store"
 )
 
@@ -27,6 +28,14 @@ type Handler struct {
 	connTracker *ConnectionTracker
 	upgrader    websocket.Upgrader
 	alert       AlertFunc
+	judges      *checker.JudgePool
+	dnsProbe    *checker.DNSProbe
+	asnClasses  *geoip.ASNClassifier
+	politeness  *scheduler.Politeness
+	pool        *scheduler.Scheduler
+	jobs        *JobManager
+	quota       *rate.Limiter
+	feed        *Feed
 }
 
 type AlertFunc func(event string, meta map[string]any, err error)
@@ -39,6 +48,56 @@ func WithAlert(alert AlertFunc) HandlerOption {
 	}
 }
 
+// WithJudgePool shares a judge pool (and its health checks) with the handler.
+func WithJudgePool(pool *checker.JudgePool) HandlerOption {
+	return func(h *Handler) {
+		h.judges = pool
+	}
+}
+
+// WithDNSProbe enables the DNS resolution and leak test for every check.
+func WithDNSProbe(probe *checker.DNSProbe) HandlerOption {
+	return func(h *Handler) {
+		h.dnsProbe = probe
+	}
+}
+
+// WithScheduler runs checks on a shared worker pool instead of one created
+// for the handler.
+func WithScheduler(pool *scheduler.Scheduler) HandlerOption {
+	return func(h *Handler) {
+		h.pool = pool
+	}
+}
+
+// WithJobManager runs v2 check jobs on m, which may keep them in Redis.
+func WithJobManager(m *JobManager) HandlerOption {
+	return func(h *Handler) {
+		h.jobs = m
+	}
+}
+
+// WithCheckQuota meters the proxies each caller checks per day.
+func WithCheckQuota(limiter *rate.Limiter) HandlerOption {
+	return func(h *Handler) {
+		h.quota = limiter
+	}
+}
+
+// WithFeed serves proxy list changes from f on the feed endpoint.
+func WithFeed(f *Feed) HandlerOption {
+	return func(h *Handler) {
+		h.feed = f
+	}
+}
+
+// WithASNClasses classifies exit networks as hosting, isp or mobile.
+func WithASNClasses(classes *geoip.ASNClassifier) HandlerOption {
+	return func(h *Handler) {
+		h.asnClasses = classes
+	}
+}
+
 // Performance: Use RWMutex for read-heavy operations
 type ConnectionTracker struct {
 	mu     sync.RWMutex
@@ -90,11 +149,23 @@ func NewHandler(cfg config.Config, store store.Storer, geo *geoip.Reader, limite
 		limiter:     limiter,
 		connTracker: NewConnectionTracker(cfg.MaxWebSocketConnections),
 	}
+	h.politeness = scheduler.NewPoliteness(cfg.PoliteSubnetConcurrency, cfg.PoliteASNConcurrency, func(ip string) int {
+		return h.geo.LookupASN(ip).Number
+	})
 	for _, opt := range opts {
 		if opt != nil {
 			opt(h)
 		}
 	}
+	if h.pool == nil {
+		h.pool = scheduler.New(cfg.CheckWorkers, cfg.CheckClientQueue)
+	}
+	if h.jobs == nil {
+		h.jobs = NewJobManager(cfg, nil)
+	}
+	if h.judges == nil {
+		h.judges = checker.NewJudgePool(cfg.JudgeURLs, checker.WithConsensus(cfg.JudgeConsensus))
+	}
 
 	// Build allowed origins map from config
 	allowedOrigins := make(map[string]bool)
@@ -114,6 +185,7 @@ func NewHandler(cfg config.Config, store store.Storer, geo *geoip.Reader, limite
 		WriteBufferSize:   4096,
 		HandshakeTimeout:  10 * time.Second,
 		EnableCompression: true,
+		Subprotocols:      []string{subprotocolV2},
 		CheckOrigin: func(r *http.Request) bool {
 			origin := r.Header.Get("Origin")
 			if origin == "" {
@@ -152,11 +224,86 @@ const (
 type payload struct {
 	Proxies  []string `json:"proxies"`
 	Protocol string   `json:"protocol"`
+	// Throughput opts into the download test; ThroughputKB optionally asks
+	// for a smaller payload than the tier allows.
+	Throughput   bool `json:"throughput"`
+	ThroughputKB int  `json:"throughput_kb"`
+	// Tamper opts into fetching the tamper fixtures through the proxy.
+	Tamper bool `json:"tamper"`
+	// LocalDNS has socks5 destinations resolved by the checker rather than
+	// the proxy.
+	LocalDNS bool `json:"local_dns"`
+	// Targets are sites every working proxy is also tested against.
+	Targets []checker.TargetCheck `json:"targets"`
+	// Sampling overrides the configured sampling policy field by field.
+	Sampling *checker.SampleOverride `json:"sampling"`
+	// Prober names the registered prober to run; empty means the standard
+	// judge check.
+	Prober string `json:"prober"`
+}
+
+// statusQueued marks a proxy held back by a politeness cap.
+const statusQueued = "queued"
+
+// progressEvent reports a proxy that is waiting rather than a result.
+type progressEvent struct {
+	Status string `json:"status"`
+	Proxy  string `json:"proxy"`
+	Reason string `json:"reason,omitempty"`
 }
 
 func (h *Handler) Handle(c *gin.Context) {
 	clientIP := c.ClientIP()
 
+	release, ok := h.admit(c, clientIP)
+	if !ok {
+		return
+	}
+	defer release()
+
+	who, err := h.identify(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("[WARN] websocket upgrade failed: %v", err)
+		h.notify("ws_upgrade_failed", map[string]any{
+			"ip":     clientIP,
+			"origin": c.GetHeader("Origin"),
+		}, err)
+		return
+	}
+	defer func() {
+		conn.Close()
+		log.Printf("[INFO] websocket connection closed for %s", clientIP)
+	}()
+
+	// SECURITY: Limit message size to 64KB (sufficient for 500 proxies × ~100 bytes each)
+	// Previously 1MB which was unnecessarily large and could enable memory exhaustion attacks.
+	// Tiers allowed bigger batches get room for them.
+	conn.SetReadLimit(max(64<<10, int64(h.batchLimit(who.tier))*128))
+	stopPings := h.keepAlive(conn, clientIP)
+	defer stopPings()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// A failed write cancels everything running for this connection.
+	out := newOutbox(conn, h.cfg.MaxConcurrent*2, cancel)
+	defer out.close()
+
+	if conn.Subprotocol() == subprotocolV2 {
+		h.serveV2(ctx, conn, clientIP, who, out)
+		return
+	}
+	h.serveV1(ctx, conn, clientIP, who, out)
+}
+
+// admit holds a WebSocket slot for the client, answering 429 when it has
+// none left. release gives the slot back.
+func (h *Handler) admit(c *gin.Context, clientIP string) (release func(), ok bool) {
 	if h.limiter != nil {
 		allowed, count, err := h.limiter.AllowWebsocketWithLimit(
 			c.Request.Context(),
@@ -172,11 +319,8 @@ func (h *Handler) Handle(c *gin.Context) {
 				"connections": count,
 				"limit":       h.cfg.MaxWebSocketConnections,
 			})
-			return
+			return nil, false
 		}
-		defer func() {
-			_ = h.limiter.ReleaseWebsocket(c.Request.Context(), clientIP)
-		}()
 	}
 
 	if !h.connTracker.Acquire(clientIP) {
@@ -186,27 +330,22 @@ func (h *Handler) Handle(c *gin.Context) {
 			"limit":       h.cfg.MaxWebSocketConnections,
 			"retry_after": "60s",
 		})
-		return
-	}
-	defer h.connTracker.Release(clientIP)
-
-	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		log.Printf("[WARN] websocket upgrade failed: %v", err)
-		h.notify("ws_upgrade_failed", map[string]any{
-			"ip":     clientIP,
-			"origin": c.GetHeader("Origin"),
-		}, err)
-		return
+		if h.limiter != nil {
+			_ = h.limiter.ReleaseWebsocket(c.Request.Context(), clientIP)
+		}
+		return nil, false
 	}
-	defer func() {
-		conn.Close()
-		log.Printf("[INFO] websocket connection closed for %s", clientIP)
-	}()
+	return func() {
+		h.connTracker.Release(clientIP)
+		if h.limiter != nil {
+			_ = h.limiter.ReleaseWebsocket(c.Request.Context(), clientIP)
+		}
+	}, true
+}
 
-	// SECURITY: Limit message size to 64KB (sufficient for 500 proxies × ~100 bytes each)
-	// Previously 1MB which was unnecessarily large and could enable memory exhaustion attacks
-	conn.SetReadLimit(64 << 10)
+// keepAlive pings the client and expects its pongs within pongWait. The
+// returned func stops the pings.
+func (h *Handler) keepAlive(conn *websocket.Conn, clientIP string) func() {
 	conn.SetReadDeadline(time.Now().Add(pongWait))
 	conn.SetPongHandler(func(string) error {
 		conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -230,126 +369,132 @@ func (h *Handler) Handle(c *gin.Context) {
 			}
 		}
 	}()
-	defer close(done)
+	return func() { close(done) }
+}
 
+// serveV1 speaks the original protocol: a bare payload per batch, answered
+// with raw results, queued events and a final {"status":"done"}.
+func (h *Handler) serveV1(ctx context.Context, conn *websocket.Conn, clientIP string, who caller, out *outbox) {
 	for {
 		var data payload
 		if err := conn.ReadJSON(&data); err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("[WARN] websocket unexpected close for %s: %v", clientIP, err)
-				h.notify("ws_unexpected_close", map[string]any{"ip": clientIP}, err)
-			}
+			h.logReadError(clientIP, err)
 			return
 		}
 
-		if len(data.Proxies) == 0 {
-			_ = conn.WriteJSON(gin.H{"error": "empty proxy list"})
-			continue
-		}
-
-		if len(data.Proxies) > 500 {
-			_ = conn.WriteJSON(gin.H{"error": "limit exceeded (max 500)"})
-			continue
-		}
-
-		for _, p := range data.Proxies {
-			if api.ContainsSQLInjection(p) || api.ContainsXSS(p) {
-				_ = conn.WriteJSON(gin.H{"error": "invalid input detected"})
+		b, rerr := h.newBatch(ctx, who, data, h.batchLimit(who.tier))
+		if rerr != nil {
+			out.send(ctx, gin.H{"error": rerr.message})
+			if rerr.code == codeInvalidInput {
 				log.Printf("[SECURITY] Potential injection attempt from %s", clientIP)
 				return // Reject entire request on injection attempt
 			}
+			continue
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-		results := make(chan checker.ProxyResult, h.cfg.MaxConcurrent*2)
-		var wg sync.WaitGroup
-		sem := make(chan struct{}, h.cfg.MaxConcurrent)
-
-		// Performance: Batch results to reduce WebSocket writes
-		writerDone := make(chan struct{})
-		go func() {
-			defer close(writerDone)
-			batch := make([]checker.ProxyResult, 0, 10)
-			ticker := time.NewTicker(100 * time.Millisecond)
-			defer ticker.Stop()
-
-			flushBatch := func() {
-				if len(batch) == 0 {
-					return
-				}
-				// Send individual results for backward compatibility
-				for _, r := range batch {
-					if err := conn.WriteJSON(r); err != nil {
-						cancel()
-						return
-					}
-				}
-				batch = batch[:0]
-			}
-
-			for {
-				select {
-				case result, ok := <-results:
-					if !ok {
-						flushBatch()
-						return
-					}
-					batch = append(batch, result)
-					if len(batch) >= 10 {
-						flushBatch()
-					}
-				case <-ticker.C:
-					flushBatch()
-				}
+		batchCtx, cancelBatch := context.WithTimeout(ctx, batchTimeout)
+		summary := h.runBatch(batchCtx, b, func(ev batchEvent) {
+			if ev.Result != nil {
+				out.send(batchCtx, *ev.Result)
+				return
 			}
-		}()
+			out.send(batchCtx, progressEvent{Status: statusQueued, Proxy: ev.Proxy, Reason: ev.Reason})
+		})
+		cancelBatch()
+		done := gin.H{"status": "done"}
+		if summary.Quota != nil {
+			done["quota"] = summary.Quota
+		}
+		out.send(ctx, done)
+	}
+}
 
-	outer:
-		for _, raw := range data.Proxies {
-			if ctx.Err() != nil {
-				break
-			}
-			parsed, err := checker.ParseProxyLine(raw, data.Protocol)
-			if err != nil {
-				sendResult(ctx, results, checker.ProxyResult{Status: false, Protocol: data.Protocol, Error: "invalid proxy", CheckedAt: time.Now().UTC().Format(time.RFC3339)})
-				continue
-			}
+func (h *Handler) logReadError(clientIP string, err error) {
+	if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+		log.Printf("[WARN] websocket unexpected close for %s: %v", clientIP, err)
+		h.notify("ws_unexpected_close", map[string]any{"ip": clientIP}, err)
+	}
+}
 
-			wg.Add(1)
-			select {
-			case sem <- struct{}{}:
-			case <-ctx.Done():
-				wg.Done()
-				break outer
-			}
-			go func(target checker.ProxyTarget) {
-				defer wg.Done()
-				defer func() {
-					if r := recover(); r != nil {
-						log.Printf("[PANIC] Recovered in proxy check: %v", r)
-					}
-					<-sem
-				}()
-
-				res := checker.CheckProxy(ctx, target, h.cfg.JudgeURL, h.geo)
-				_ = h.saveResult(ctx, target, res)
-				sendResult(ctx, results, res)
-			}(parsed)
+// runCheck queues check on the shared worker pool and waits for it to
+// finish. The check is skipped if ctx ends while it waits.
+func (h *Handler) runCheck(ctx context.Context, client string, tier rate.Tier, check func()) error {
+	done := make(chan struct{})
+	if err := h.pool.Submit(ctx, client, tier, func() {
+		defer close(done)
+		if ctx.Err() == nil {
+			check()
 		}
+	}); err != nil {
+		return err
+	}
+	<-done
+	return nil
+}
 
-		wg.Wait()
-		close(results)
-		<-writerDone
-		_ = conn.WriteJSON(gin.H{"status": "done"})
-		cancel()
+// throughputBytes resolves the requested payload size against the tier's cap.
+// Zero means the test is off, either by choice or because the tier lacks it.
+func (h *Handler) throughputBytes(data payload, tier rate.Tier) int64 {
+	if !data.Throughput {
+		return 0
 	}
+	limit := h.cfg.GetThroughputLimitForTier(string(tier))
+	if limit <= 0 {
+		return 0
+	}
+	kb := data.ThroughputKB
+	if kb <= 0 || kb > limit {
+		kb = limit
+	}
+	return int64(kb) << 10
 }
 
-func sendResult(ctx context.Context, results chan<- checker.ProxyResult, res checker.ProxyResult) {
-	select {
-	case results <- res:
-	case <-ctx.Done():
+// checkOptions builds the options for one request's checks.
+func (h *Handler) checkOptions(data payload, throughputBytes int64) checker.CheckOptions {
+	opts := checker.CheckOptions{
+		JudgeURL:        h.cfg.JudgeURL,
+		Judges:          h.judges,
+		TLSJudgeURL:     h.cfg.TLSJudgeURL,
+		IPv4JudgeURL:    h.cfg.IPv4JudgeURL,
+		IPv6JudgeURL:    h.cfg.IPv6JudgeURL,
+		DNSProbe:        h.dnsProbe,
+		LocalDNS:        data.LocalDNS,
+		ThroughputURL:   h.cfg.ThroughputURL,
+		ThroughputBytes: throughputBytes,
+		Targets:         data.Targets,
+		Sampling:        h.samplePolicy(data),
+		Geo:             h.geo,
+		ASNClasses:      h.asnClasses,
 	}
+	if data.Tamper {
+		opts.FixtureURL = h.cfg.FixtureURL
+		opts.TLSFixtureURL = h.cfg.TLSFixtureURL
+	}
+	return opts
+}
+
+// samplePolicy is the configured sampling policy with the request's
+// overrides applied.
+func (h *Handler) samplePolicy(data payload) checker.SamplePolicy {
+	policy := checker.SamplePolicy{
+		Samples:   max(h.cfg.CheckSamples, 1),
+		BackoffMS: int(h.cfg.CheckSampleBackoff.Milliseconds()),
+		FlakyMin:  h.cfg.CheckFlakyMin,
+		FlakyMax:  h.cfg.CheckFlakyMax,
+	}
+	if data.Sampling != nil {
+		policy = policy.Override(*data.Sampling)
+	}
+	return policy
+}
+
+// targetHost is the host a check connects to first.
+func targetHost(target checker.ProxyTarget) string {
+	host, _, err := net.SplitHostPort(target.Address)
+	if err != nil {
+		return target.Address
+	}
+	return host
 }
 
 func (h *Handler) notify(event string, meta map[string]any, err error) {
@@ -360,13 +505,24 @@ func (h *Handler) notify(event string, meta map[string]any, err error) {
 }
 
 func (h *Handler) saveResult(ctx context.Context, target checker.ProxyTarget, res checker.ProxyResult) error {
-	if h.store == nil {
+	// A chain's result describes the route, not any one proxy in it.
+	if h.store == nil || len(target.Chain) > 0 {
 		return nil
 	}
 
+	// In auto mode the result carries the protocol that was detected; an
+	// endpoint that spoke none of them has nothing worth recording.
+	protocol := target.Protocol
+	if strings.EqualFold(protocol, checker.ProtocolAuto) {
+		if res.Protocol == checker.ProtocolAuto {
+			return nil
+		}
+		protocol = res.Protocol
+	}
+
 	proxyID, err := h.store.UpsertProxy(ctx, store.ProxyRecord{
 		Address:     target.Address,
-		Protocol:    target.Protocol,
+		Protocol:    protocol,
 		Country:     res.Country,
 		Anonymity:   res.Anonymity,
 		LastStatus:  res.Status,
@@ -377,15 +533,34 @@ func (h *Handler) saveResult(ctx context.Context, target checker.ProxyTarget, re
 		return err
 	}
 
-	return h.store.InsertCheck(ctx, store.CheckRecord{
+	record := store.CheckRecord{
 		ProxyID:   proxyID,
 		Address:   target.Address,
-		Protocol:  target.Protocol,
+		Protocol:  protocol,
 		Status:    res.Status,
 		Latency:   res.Latency,
 		IP:        res.IP,
 		Country:   res.Country,
 		Anonymity: res.Anonymity,
 		CheckedAt: time.Now().UTC(),
-	})
+	}
+	if res.Phases != nil {
+		record.ConnectMS = res.Phases.ConnectMS
+		record.HandshakeMS = res.Phases.HandshakeMS
+		record.TunnelMS = res.Phases.TunnelMS
+		record.TLSMS = res.Phases.TLSMS
+		record.TTFBMS = res.Phases.TTFBMS
+	}
+	if res.DNS != nil {
+		record.DNSMode = res.DNS.Mode
+		record.RemoteDNS = &res.DNS.RemoteResolved
+		record.DNSLeak = &res.DNS.Leak
+	}
+	if res.Tamper != nil {
+		record.InjectsContent = res.Tamper.InjectsContent
+		record.StripsHeaders = res.Tamper.StripsHeaders
+		record.MITMTLS = res.Tamper.MITMTLS
+	}
+
+	return h.store.InsertCheck(ctx, record)
 }
@@ -2,6 +2,9 @@ package ws
 
 import (
 	"testing"
+
+	"socksproxies.com/server/internal/config"
+	"socksproxies.com/server/internal/rate"
 )
 
 func TestConnectionTracker_Acquire(t *testing.T) {
@@ -160,3 +163,39 @@ func TestConnectionTracker_MultipleIPs(t *testing.T) {
 		}
 	}
 }
+
+func TestHandler_ThroughputBytes(t *testing.T) {
+	h := &Handler{cfg: config.Config{ThroughputMaxKB: config.RateLimitTier{Free: 256, Basic: 2048, Pro: 0}}}
+
+	cases := []struct {
+		name     string
+		data     payload
+		tier     rate.Tier
+		expected int64
+	}{
+		{"not_requested", payload{}, rate.TierFree, 0},
+		{"tier_default", payload{Throughput: true}, rate.TierFree, 256 << 10},
+		{"smaller_request", payload{Throughput: true, ThroughputKB: 64}, rate.TierFree, 64 << 10},
+		{"clamped_to_tier", payload{Throughput: true, ThroughputKB: 4096}, rate.TierBasic, 2048 << 10},
+		{"disabled_for_tier", payload{Throughput: true}, rate.TierPro, 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := h.throughputBytes(tc.data, tc.tier); got != tc.expected {
+				t.Errorf("throughputBytes() = %d, expected %d", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestHandler_CheckOptionsTamper(t *testing.T) {
+	h := &Handler{cfg: config.Config{FixtureURL: "http://fixture.test", TLSFixtureURL: "https://fixture.test"}}
+
+	if opts := h.checkOptions(payload{}, 0); opts.FixtureURL != "" || opts.TLSFixtureURL != "" {
+		t.Errorf("expected no tamper test unless requested, got %q and %q", opts.FixtureURL, opts.TLSFixtureURL)
+	}
+	if opts := h.checkOptions(payload{Tamper: true}, 0); opts.FixtureURL != "http://fixture.test" || opts.TLSFixtureURL != "https://fixture.test" {
+		t.Errorf("expected the configured fixtures when requested, got %q and %q", opts.FixtureURL, opts.TLSFixtureURL)
+	}
+}
@@ -0,0 +1,608 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"socksproxies.com/server/internal/checker"
+	"socksproxies.com/server/internal/config"
+)
+
+const (
+	// maxJobsPerClient caps the jobs one client may have running at once
+	// for tiers without a configured limit.
+	maxJobsPerClient = 4
+	// jobPollInterval is how often a job running on another instance is
+	// checked for new messages.
+	jobPollInterval = time.Second
+	jobStoreTimeout = 2 * time.Second
+	// jobCancelChannel carries the IDs of jobs to cancel to the instance
+	// running them.
+	jobCancelChannel = "check:job:cancel"
+	// maxJobTimeout bounds the longest job, however many proxies it has.
+	maxJobTimeout = 6 * time.Hour
+	// maxMemoryJobResults caps the results a job keeps without Redis; the
+	// rest are only counted in CheckJob.ResultsDropped.
+	maxMemoryJobResults = 10000
+)
+
+// Running jobs are counted per client in Redis, so the limit holds across
+// instances. Counts expire with the longest job in case an instance dies
+// without releasing its jobs.
+var (
+	acquireJobSlotScript = redis.NewScript(`
+		local running = redis.call('INCR', KEYS[1])
+		redis.call('EXPIRE', KEYS[1], ARGV[2])
+		if running > tonumber(ARGV[1]) then
+			redis.call('DECR', KEYS[1])
+			return 0
+		end
+		return 1
+	`)
+	releaseJobSlotScript = redis.NewScript(`
+		if redis.call('DECR', KEYS[1]) <= 0 then
+			redis.call('DEL', KEYS[1])
+		end
+		return 0
+	`)
+)
+
+var (
+	errJobExists   = errors.New("job already exists")
+	errJobNotFound = errors.New("job not found")
+	errTooManyJobs = errors.New("too many running jobs")
+)
+
+type CheckJobStatus string
+
+const (
+	checkJobRunning   CheckJobStatus = "running"
+	checkJobCompleted CheckJobStatus = "completed"
+	checkJobCancelled CheckJobStatus = "cancelled"
+)
+
+// CheckJob describes a check run. Jobs run on the server whether or not
+// anyone is connected, so a client can drop and resume by ID. Only the
+// client that started a job may follow, cancel or read it. Jobs expire the
+// TTL after they finish. ResultsDropped counts the results past what the
+// server could keep, which are missing from pages and downloads.
+type CheckJob struct {
+	ID             string         `json:"id"`
+	Status         CheckJobStatus `json:"status"`
+	Total          int            `json:"total"`
+	Completed      int            `json:"completed"`
+	ResultsDropped int            `json:"results_dropped,omitempty"`
+	LastSeq        int64          `json:"last_seq"`
+	Summary        *batchSummary  `json:"summary,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	ExpiresAt      time.Time      `json:"expires_at"`
+}
+
+// storedJob is a job as kept in Redis, with the client it belongs to.
+type storedJob struct {
+	CheckJob
+	Client string `json:"client"`
+}
+
+// jobResult is one checked proxy of a job. Results are kept in completion
+// order, so pages of them stay stable while the job runs.
+type jobResult struct {
+	Index  int                 `json:"index"`
+	Proxy  string              `json:"proxy"`
+	Result checker.ProxyResult `json:"result"`
+}
+
+// checkJob is a job started by this instance. Its last messages are kept in
+// events, oldest first. Without Redis its first results are kept in results;
+// with Redis they are only kept there.
+type checkJob struct {
+	mu      sync.Mutex
+	meta    CheckJob
+	client  string
+	cancel  context.CancelFunc
+	events  []serverMessage
+	results []jobResult
+	changed chan struct{}
+}
+
+// JobManager runs check jobs and keeps their recent messages for replay:
+// in Redis when available, so any instance can replay a job, and in memory
+// otherwise.
+type JobManager struct {
+	redis      *redis.Client
+	ttl        time.Duration
+	replay     int
+	maxResults int
+	ctx        context.Context
+	stop       context.CancelFunc
+	done       chan struct{}
+	mu         sync.Mutex
+	jobs       map[string]*checkJob
+}
+
+func NewJobManager(cfg config.Config, redis *redis.Client) *JobManager {
+	ctx, stop := context.WithCancel(context.Background())
+	m := &JobManager{
+		redis:      redis,
+		ttl:        cfg.CheckJobTTL,
+		replay:     max(cfg.CheckJobReplay, 1),
+		maxResults: maxMemoryJobResults,
+		ctx:        ctx,
+		stop:       stop,
+		done:       make(chan struct{}),
+		jobs:       make(map[string]*checkJob),
+	}
+	if redis != nil {
+		go m.listenCancels()
+	} else {
+		close(m.done)
+	}
+	return m
+}
+
+// Close cancels every running job.
+func (m *JobManager) Close() {
+	m.stop()
+	<-m.done
+}
+
+// listenCancels cancels the jobs running here that other instances were
+// asked to cancel.
+func (m *JobManager) listenCancels() {
+	defer close(m.done)
+	pubsub := m.redis.Subscribe(m.ctx, jobCancelChannel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			m.cancelLocal(msg.Payload)
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// start runs a job under id unless client already has limit jobs running.
+// run reports through emit and returns the batch summary once done; it is
+// cancelled after jobTimeout.
+func (m *JobManager) start(id, client string, limit, total int, run func(ctx context.Context, emit func(serverMessage)) batchSummary) (*CheckJob, error) {
+	now := time.Now().UTC()
+	job := &checkJob{
+		meta: CheckJob{
+			ID:        id,
+			Status:    checkJobRunning,
+			Total:     total,
+			CreatedAt: now,
+			UpdatedAt: now,
+			ExpiresAt: now.Add(jobTimeout(total) + m.ttl),
+		},
+		client:  client,
+		changed: make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	if _, dup := m.jobs[id]; dup {
+		m.mu.Unlock()
+		return nil, errJobExists
+	}
+	running := 0
+	for _, j := range m.jobs {
+		if j.client == client && j.running() {
+			running++
+		}
+	}
+	if running >= limit {
+		m.mu.Unlock()
+		return nil, errTooManyJobs
+	}
+	if m.redis != nil {
+		if err := m.acquireSlot(client, limit); err != nil {
+			m.mu.Unlock()
+			return nil, err
+		}
+		// Claim the ID across instances.
+		ctx, cancel := context.WithTimeout(m.ctx, jobStoreTimeout)
+		raw, _ := json.Marshal(storedJob{CheckJob: job.meta, Client: client})
+		ok, err := m.redis.SetNX(ctx, checkJobKey(id), raw, time.Until(job.meta.ExpiresAt)).Result()
+		cancel()
+		if err == nil && !ok {
+			err = errJobExists
+		}
+		if err != nil {
+			m.mu.Unlock()
+			m.releaseSlot(client)
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(m.ctx, jobTimeout(total))
+	job.cancel = cancel
+	m.jobs[id] = job
+	m.mu.Unlock()
+
+	meta := job.meta
+	go func() {
+		defer cancel()
+		summary := run(ctx, func(msg serverMessage) {
+			m.append(job, msg)
+		})
+		m.finish(job, summary)
+		if m.redis != nil {
+			m.releaseSlot(client)
+		}
+	}()
+	return &meta, nil
+}
+
+// acquireSlot counts a job against client's limit on every instance.
+func (m *JobManager) acquireSlot(client string, limit int) error {
+	ctx, cancel := context.WithTimeout(m.ctx, jobStoreTimeout)
+	defer cancel()
+	ok, err := acquireJobSlotScript.Run(ctx, m.redis, []string{runningJobsKey(client)}, limit, int(maxJobTimeout.Seconds())).Int()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return errTooManyJobs
+	}
+	return nil
+}
+
+// releaseSlot gives back a slot taken by acquireSlot.
+func (m *JobManager) releaseSlot(client string) {
+	ctx, cancel := context.WithTimeout(context.Background(), jobStoreTimeout)
+	defer cancel()
+	if err := releaseJobSlotScript.Run(ctx, m.redis, []string{runningJobsKey(client)}).Err(); err != nil {
+		log.Printf("[WARN] failed to release job slot of %s: %v", client, err)
+	}
+}
+
+// authorize reports errJobNotFound unless client started the job, so other
+// clients cannot tell it exists.
+func (m *JobManager) authorize(ctx context.Context, id, client string) error {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	m.mu.Unlock()
+	owner := ""
+	if ok {
+		owner = job.client
+	} else {
+		stored, err := m.loadJob(ctx, id)
+		if err != nil {
+			return err
+		}
+		owner = stored.Client
+	}
+	if owner != client {
+		return errJobNotFound
+	}
+	return nil
+}
+
+// cancel stops a running job. Jobs running on another instance are
+// cancelled by that instance.
+func (m *JobManager) cancel(ctx context.Context, id string) error {
+	if m.cancelLocal(id) {
+		return nil
+	}
+	stored, err := m.loadJob(ctx, id)
+	if err != nil {
+		return err
+	}
+	if stored.Status != checkJobRunning {
+		return errJobNotFound
+	}
+	return m.redis.Publish(ctx, jobCancelChannel, id).Err()
+}
+
+// cancelLocal stops a job running on this instance, reporting whether there
+// was one.
+func (m *JobManager) cancelLocal(id string) bool {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok || !job.running() {
+		return false
+	}
+	job.cancel()
+	return true
+}
+
+// follow sends the job's messages after seq since, then keeps streaming
+// until the job finishes, send reports failure or ctx ends. A resuming
+// client (since > 0) first gets a resumed notice, and any client that falls
+// behind the replay buffer is told how many messages it missed for good.
+func (m *JobManager) follow(ctx context.Context, id string, since int64, send func(serverMessage) bool) error {
+	first := true
+	for {
+		msgs, meta, changed, err := m.events(ctx, id, since)
+		if err != nil {
+			return err
+		}
+		if first && since > 0 {
+			if !send(serverMessage{Type: msgCheckProgress, JobID: id, Data: progressData{State: progressResumed, Total: meta.Total}}) {
+				return nil
+			}
+		}
+		first = false
+		if len(msgs) > 0 && msgs[0].Seq > since+1 {
+			if !send(serverMessage{Type: msgCheckProgress, JobID: id, Data: progressData{State: progressMissed, Missed: msgs[0].Seq - since - 1}}) {
+				return nil
+			}
+		}
+		for _, msg := range msgs {
+			if !send(msg) {
+				return nil
+			}
+			since = msg.Seq
+		}
+		if meta.Status != checkJobRunning && since >= meta.LastSeq {
+			return nil
+		}
+
+		if changed == nil {
+			// Running elsewhere: poll.
+			timer := time.NewTimer(jobPollInterval)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			}
+			continue
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// get returns the job with its progress.
+func (m *JobManager) get(ctx context.Context, id string) (CheckJob, error) {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	m.mu.Unlock()
+	if ok {
+		job.mu.Lock()
+		defer job.mu.Unlock()
+		return job.meta, nil
+	}
+	stored, err := m.loadJob(ctx, id)
+	if err != nil {
+		return CheckJob{}, err
+	}
+	meta := stored.CheckJob
+	if meta.Status == checkJobRunning {
+		// Running elsewhere; only the results list is current.
+		count, err := m.redis.LLen(ctx, checkJobResultsKey(id)).Result()
+		if err != nil {
+			return CheckJob{}, err
+		}
+		meta.Completed = int(count)
+	}
+	return meta, nil
+}
+
+// results returns up to limit results from offset on, all of them if limit
+// is not positive.
+func (m *JobManager) results(ctx context.Context, id string, offset, limit int) ([]jobResult, error) {
+	offset = max(offset, 0)
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	m.mu.Unlock()
+	if ok && m.redis == nil {
+		job.mu.Lock()
+		defer job.mu.Unlock()
+		if offset >= len(job.results) {
+			return []jobResult{}, nil
+		}
+		end := len(job.results)
+		if limit > 0 {
+			end = min(end, offset+limit)
+		}
+		return append([]jobResult(nil), job.results[offset:end]...), nil
+	}
+	if !ok {
+		if _, err := m.loadJob(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	stop := int64(-1)
+	if limit > 0 {
+		stop = int64(offset + limit - 1)
+	}
+	items, err := m.redis.LRange(ctx, checkJobResultsKey(id), int64(offset), stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]jobResult, 0, len(items))
+	for _, item := range items {
+		var res jobResult
+		if err := json.Unmarshal([]byte(item), &res); err != nil {
+			continue
+		}
+		out = append(out, res)
+	}
+	return out, nil
+}
+
+// loadJob reads a job that is not running here from Redis.
+func (m *JobManager) loadJob(ctx context.Context, id string) (storedJob, error) {
+	if m.redis == nil {
+		return storedJob{}, errJobNotFound
+	}
+	raw, err := m.redis.Get(ctx, checkJobKey(id)).Result()
+	if errors.Is(err, redis.Nil) {
+		return storedJob{}, errJobNotFound
+	}
+	if err != nil {
+		return storedJob{}, err
+	}
+	var stored storedJob
+	if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+		return storedJob{}, err
+	}
+	return stored, nil
+}
+
+// events returns the buffered messages after seq since along with the job.
+// changed is closed on the next message for jobs running here, and nil for
+// jobs only found in Redis.
+func (m *JobManager) events(ctx context.Context, id string, since int64) ([]serverMessage, CheckJob, <-chan struct{}, error) {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	m.mu.Unlock()
+	if ok {
+		job.mu.Lock()
+		defer job.mu.Unlock()
+		return messagesAfter(job.events, since), job.meta, job.changed, nil
+	}
+	stored, err := m.loadJob(ctx, id)
+	if err != nil {
+		return nil, CheckJob{}, nil, err
+	}
+	items, err := m.redis.LRange(ctx, checkJobEventsKey(id), 0, -1).Result()
+	if err != nil {
+		return nil, CheckJob{}, nil, err
+	}
+	msgs := make([]serverMessage, 0, len(items))
+	for _, item := range items {
+		var msg serverMessage
+		if err := json.Unmarshal([]byte(item), &msg); err != nil {
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	return messagesAfter(msgs, since), stored.CheckJob, nil, nil
+}
+
+// append numbers msg, stores it and wakes the job's followers.
+func (m *JobManager) append(job *checkJob, msg serverMessage) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.meta.LastSeq++
+	msg.Seq = job.meta.LastSeq
+	job.events = append(job.events, msg)
+	if len(job.events) > m.replay {
+		job.events = append(job.events[:0:0], job.events[len(job.events)-m.replay:]...)
+	}
+	var result *jobResult
+	if res, ok := msg.Data.(*checker.ProxyResult); ok && msg.Type == msgCheckResult && msg.Index != nil {
+		result = &jobResult{Index: *msg.Index, Proxy: msg.Proxy, Result: *res}
+		job.meta.Completed++
+		switch {
+		case m.redis != nil:
+		case len(job.results) < m.maxResults:
+			job.results = append(job.results, *result)
+		default:
+			job.meta.ResultsDropped++
+		}
+	}
+
+	if m.redis != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), jobStoreTimeout)
+		pipe := m.redis.Pipeline()
+		if raw, err := json.Marshal(msg); err == nil {
+			key := checkJobEventsKey(job.meta.ID)
+			pipe.RPush(ctx, key, raw)
+			pipe.LTrim(ctx, key, int64(-m.replay), -1)
+			pipe.Expire(ctx, key, m.ttl)
+		}
+		if result != nil {
+			if raw, err := json.Marshal(result); err == nil {
+				key := checkJobResultsKey(job.meta.ID)
+				pipe.RPush(ctx, key, raw)
+				pipe.Expire(ctx, key, m.ttl)
+			}
+		}
+		_, _ = pipe.Exec(ctx)
+		cancel()
+	}
+	close(job.changed)
+	job.changed = make(chan struct{})
+}
+
+func (m *JobManager) finish(job *checkJob, summary batchSummary) {
+	job.mu.Lock()
+	job.meta.Status = checkJobCompleted
+	if summary.Cancelled {
+		job.meta.Status = checkJobCancelled
+	}
+	job.meta.Summary = &summary
+	job.meta.UpdatedAt = time.Now().UTC()
+	job.meta.ExpiresAt = job.meta.UpdatedAt.Add(m.ttl)
+	meta := job.meta
+	close(job.changed)
+	job.changed = make(chan struct{})
+	job.mu.Unlock()
+
+	if m.redis != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), jobStoreTimeout)
+		if raw, err := json.Marshal(storedJob{CheckJob: meta, Client: job.client}); err == nil {
+			_ = m.redis.Set(ctx, checkJobKey(meta.ID), raw, time.Until(meta.ExpiresAt)).Err()
+		}
+		cancel()
+		// Redis has everything from here on.
+		m.forget(meta.ID)
+		return
+	}
+	time.AfterFunc(time.Until(meta.ExpiresAt), func() {
+		m.forget(meta.ID)
+	})
+}
+
+// jobTimeout allows batchTimeout for every full batch of proxies.
+func jobTimeout(total int) time.Duration {
+	batches := max((total+maxBatchProxies-1)/maxBatchProxies, 1)
+	return min(time.Duration(batches)*batchTimeout, maxJobTimeout)
+}
+
+func (m *JobManager) forget(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.jobs, id)
+}
+
+func (j *checkJob) running() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.meta.Status == checkJobRunning
+}
+
+func messagesAfter(msgs []serverMessage, since int64) []serverMessage {
+	for i, msg := range msgs {
+		if msg.Seq > since {
+			return append([]serverMessage(nil), msgs[i:]...)
+		}
+	}
+	return nil
+}
+
+func checkJobKey(id string) string {
+	return "check:job:" + id
+}
+
+func checkJobEventsKey(id string) string {
+	return checkJobKey(id) + ":events"
+}
+
+func checkJobResultsKey(id string) string {
+	return checkJobKey(id) + ":results"
+}
+
+func runningJobsKey(client string) string {
+	return "check:running:" + client
+}
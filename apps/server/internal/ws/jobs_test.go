@@ -0,0 +1,214 @@
+package ws
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"socksproxies.com/server/internal/checker"
+	"socksproxies.com/server/internal/config"
+)
+
+func TestJobManager_ReplayIsBounded(t *testing.T) {
+	m := NewJobManager(config.Config{CheckJobTTL: time.Minute, CheckJobReplay: 3}, nil)
+	defer m.Close()
+
+	emitted := make(chan struct{})
+	if _, err := m.start("job", "client", maxJobsPerClient, 5, func(ctx context.Context, emit func(serverMessage)) batchSummary {
+		for range 5 {
+			emit(serverMessage{Type: msgCheckResult, JobID: "job"})
+		}
+		close(emitted)
+		return batchSummary{Total: 5, Completed: 5}
+	}); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	<-emitted
+	if _, err := m.start("job", "client", maxJobsPerClient, 1, nil); err != errJobExists {
+		t.Fatalf("expected errJobExists, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var got []serverMessage
+	if err := m.follow(ctx, "job", 1, func(msg serverMessage) bool {
+		got = append(got, msg)
+		return true
+	}); err != nil {
+		t.Fatalf("follow: %v", err)
+	}
+
+	// Resumed and missed notices, then the last three of five messages.
+	if len(got) != 5 {
+		t.Fatalf("expected 5 messages, got %+v", got)
+	}
+	if resumed, ok := got[0].Data.(progressData); !ok || resumed.State != progressResumed {
+		t.Errorf("expected a resumed notice, got %+v", got[0])
+	}
+	if missed, ok := got[1].Data.(progressData); !ok || missed.State != progressMissed || missed.Missed != 1 {
+		t.Errorf("expected a notice of 1 missed message, got %+v", got[1])
+	}
+	if got[2].Seq != 3 || got[4].Seq != 5 {
+		t.Errorf("expected seqs 3 to 5, got %d to %d", got[2].Seq, got[4].Seq)
+	}
+
+	if err := m.follow(ctx, "missing", 0, func(serverMessage) bool { return true }); err != errJobNotFound {
+		t.Errorf("expected errJobNotFound, got %v", err)
+	}
+	if err := m.cancel(ctx, "job"); err != errJobNotFound {
+		t.Errorf("expected a finished job to be uncancellable, got %v", err)
+	}
+}
+
+func TestJobManager_LimitsRunningJobsPerClient(t *testing.T) {
+	m := NewJobManager(config.Config{CheckJobTTL: time.Minute, CheckJobReplay: 64}, nil)
+	defer m.Close()
+
+	block := func(ctx context.Context, emit func(serverMessage)) batchSummary {
+		<-ctx.Done()
+		return batchSummary{Cancelled: true}
+	}
+	for i := range maxJobsPerClient {
+		if _, err := m.start(string(rune('a'+i)), "client", maxJobsPerClient, 1, block); err != nil {
+			t.Fatalf("start %d: %v", i, err)
+		}
+	}
+	if _, err := m.start("one-more", "client", maxJobsPerClient, 1, block); err != errTooManyJobs {
+		t.Errorf("expected errTooManyJobs, got %v", err)
+	}
+	if _, err := m.start("other", "other-client", maxJobsPerClient, 1, block); err != nil {
+		t.Errorf("other clients should not be limited: %v", err)
+	}
+}
+
+func TestJobManager_LimitsRunningJobsAcrossInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	cfg := config.Config{CheckJobTTL: time.Minute, CheckJobReplay: 64}
+	a, b := NewJobManager(cfg, client), NewJobManager(cfg, client)
+	defer a.Close()
+	defer b.Close()
+
+	release := make(chan struct{})
+	block := func(ctx context.Context, emit func(serverMessage)) batchSummary {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return batchSummary{}
+	}
+	if _, err := a.start("a", "client", 2, 1, block); err != nil {
+		t.Fatalf("start on a: %v", err)
+	}
+	if _, err := b.start("b", "client", 2, 1, block); err != nil {
+		t.Fatalf("start on b: %v", err)
+	}
+	if _, err := a.start("c", "client", 2, 1, block); err != errTooManyJobs {
+		t.Errorf("expected the limit to count jobs on every instance, got %v", err)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for mr.Exists(runningJobsKey("client")) {
+		if time.Now().After(deadline) {
+			t.Fatal("finished jobs kept their slots")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := b.start("a", "client", 2, 1, block); err != errJobExists {
+		t.Errorf("expected errJobExists, got %v", err)
+	}
+	if mr.Exists(runningJobsKey("client")) {
+		t.Error("expected a refused job to give its slot back")
+	}
+	if _, err := b.start("d", "client", 2, 1, block); err != nil {
+		t.Errorf("expected finished jobs to free their slots, got %v", err)
+	}
+}
+
+func TestJobManager_CancelAcrossInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	cfg := config.Config{CheckJobTTL: time.Minute, CheckJobReplay: 64}
+	a, b := NewJobManager(cfg, client), NewJobManager(cfg, client)
+	defer a.Close()
+	defer b.Close()
+
+	cancelled := make(chan struct{})
+	if _, err := a.start("job", "client", maxJobsPerClient, 1, func(ctx context.Context, emit func(serverMessage)) batchSummary {
+		<-ctx.Done()
+		close(cancelled)
+		return batchSummary{Cancelled: true}
+	}); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// a subscribes in the background; ask until it has heard.
+waiting:
+	for {
+		err := b.cancel(ctx, "job")
+		select {
+		case <-cancelled:
+			break waiting
+		case <-time.After(20 * time.Millisecond):
+			if err != nil {
+				t.Fatalf("cancel from another instance: %v", err)
+			}
+		case <-ctx.Done():
+			t.Fatal("the job was not cancelled")
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := b.get(ctx, "job")
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if job.Status == checkJobCancelled {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the job to end cancelled, got %s", job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := b.cancel(ctx, "job"); err != errJobNotFound {
+		t.Errorf("expected a finished job to be uncancellable, got %v", err)
+	}
+}
+
+func TestJobManager_ResultsAreBounded(t *testing.T) {
+	m := NewJobManager(config.Config{CheckJobTTL: time.Minute, CheckJobReplay: 64}, nil)
+	defer m.Close()
+	m.maxResults = 2
+
+	finished := make(chan struct{})
+	if _, err := m.start("job", "client", maxJobsPerClient, 3, func(ctx context.Context, emit func(serverMessage)) batchSummary {
+		for i := range 3 {
+			emit(serverMessage{Type: msgCheckResult, JobID: "job", Index: &i, Data: &checker.ProxyResult{}})
+		}
+		close(finished)
+		return batchSummary{Total: 3, Completed: 3}
+	}); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	<-finished
+
+	ctx := context.Background()
+	results, err := m.results(ctx, "job", 0, 0)
+	if err != nil || len(results) != 2 || results[1].Index != 1 {
+		t.Fatalf("expected the first 2 results, got %+v (%v)", results, err)
+	}
+	job, err := m.get(ctx, "job")
+	if err != nil || job.Completed != 3 || job.ResultsDropped != 1 {
+		t.Errorf("expected 1 of 3 results to be reported dropped, got %+v (%v)", job, err)
+	}
+}
@@ -0,0 +1,69 @@
+package ws
+
+import (
+	"context"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const writeWait = 10 * time.Second
+
+// outbox is the only writer of a connection's data messages, so concurrent
+// jobs can report without interleaving frames.
+type outbox struct {
+	conn   *websocket.Conn
+	ch     chan any
+	failed chan struct{}
+	done   chan struct{}
+}
+
+// newOutbox starts the writer; onFail is called once if a write fails, after
+// which further messages are dropped.
+func newOutbox(conn *websocket.Conn, size int, onFail func()) *outbox {
+	o := &outbox{
+		conn:   conn,
+		ch:     make(chan any, max(size, 1)),
+		failed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go o.run(onFail)
+	return o
+}
+
+func (o *outbox) run(onFail func()) {
+	defer close(o.done)
+	ok := true
+	for msg := range o.ch {
+		if !ok {
+			continue
+		}
+		_ = o.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := o.conn.WriteJSON(msg); err != nil {
+			ok = false
+			close(o.failed)
+			if onFail != nil {
+				onFail()
+			}
+		}
+	}
+}
+
+// send queues msg unless ctx ends or the connection has failed first.
+func (o *outbox) send(ctx context.Context, msg any) bool {
+	select {
+	case o.ch <- msg:
+		return true
+	case <-o.failed:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// close flushes queued messages and stops the writer. Nothing may be sent
+// afterwards.
+func (o *outbox) close() {
+	close(o.ch)
+	<-o.done
+}
@@ -0,0 +1,108 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"socksproxies.com/server/internal/checker"
+	"socksproxies.com/server/internal/config"
+)
+
+var registerTestProbers sync.Once
+
+// useTestProbers registers "ws-test-slow", which takes 50ms to pass every
+// proxy other than those on port 1, and "ws-test-hang", which fails once the check is cancelled.
+func useTestProbers() {
+	registerTestProbers.Do(func() {
+		checker.RegisterProber("ws-test-slow", checker.ProberFunc(func(ctx context.Context, target checker.ProxyTarget, opts checker.CheckOptions) checker.ProxyResult {
+			time.Sleep(50 * time.Millisecond)
+			host, port, _ := net.SplitHostPort(target.Address)
+			return checker.ProxyResult{IP: host, Port: port, Protocol: target.Protocol, Status: port != "1"}.WithCheckedAt()
+		}))
+		checker.RegisterProber("ws-test-hang", checker.ProberFunc(func(ctx context.Context, target checker.ProxyTarget, opts checker.CheckOptions) checker.ProxyResult {
+			<-ctx.Done()
+			return checker.ProxyResult{Protocol: target.Protocol, Error: ctx.Err().Error()}.WithCheckedAt()
+		}))
+	})
+}
+
+// dialWS serves h on a test server and opens a WebSocket to it, offering
+// the given subprotocols.
+func dialWS(t *testing.T, h *Handler, subprotocols ...string) *websocket.Conn {
+	t.Helper()
+	return dialWSWithHeader(t, h, http.Header{}, subprotocols...)
+}
+
+func dialWSWithHeader(t *testing.T, h *Handler, header http.Header, subprotocols ...string) *websocket.Conn {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ws", h.Handle)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	header.Set("Origin", "http://allowed.test")
+	dialer := websocket.Dialer{Subprotocols: subprotocols}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestHandler_Handle_QueuesCrowdedSubnet(t *testing.T) {
+	useTestProbers()
+
+	h := NewHandler(config.Config{
+		JudgeURL:                "http://judge.invalid",
+		MaxConcurrent:           4,
+		MaxWebSocketConnections: 1,
+		AllowedOrigins:          []string{"http://allowed.test"},
+		CheckClientQueue:        4,
+		PoliteSubnetConcurrency: 1,
+	}, nil, nil, nil)
+	conn := dialWS(t, h)
+
+	request := `{"proxies":["192.0.2.1:1080","192.0.2.2:1080"],"protocol":"socks5","prober":"ws-test-slow"}`
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(request)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var queued, results int
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		var event map[string]any
+		if err := json.Unmarshal(message, &event); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if event["status"] == "done" {
+			break
+		}
+		if event["status"] == statusQueued {
+			queued++
+			if event["reason"] != "subnet" {
+				t.Errorf("expected the subnet cap to be named, got %v", event)
+			}
+			continue
+		}
+		results++
+	}
+	if queued != 1 || results != 2 {
+		t.Errorf("expected 1 queued event and 2 results, got %d and %d", queued, results)
+	}
+}
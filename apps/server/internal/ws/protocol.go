@@ -0,0 +1,238 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// subprotocolV2 negotiates the typed protocol; connections without it speak
+// the original one.
+const subprotocolV2 = "socksproxies.v2"
+
+// Message types of the v2 protocol.
+const (
+	msgCheckStart    = "check.start"
+	msgCheckCancel   = "check.cancel"
+	msgCheckResume   = "check.resume"
+	msgCheckProgress = "check.progress"
+	msgCheckResult   = "check.result"
+	msgCheckSummary  = "check.summary"
+	msgError         = "error"
+)
+
+// Error codes only the v2 protocol uses.
+const (
+	codeInvalidMessage = "INVALID_MESSAGE"
+	codeUnknownType    = "UNKNOWN_TYPE"
+	codeInvalidJobID   = "INVALID_JOB_ID"
+	codeJobExists      = "JOB_EXISTS"
+	codeJobNotFound    = "JOB_NOT_FOUND"
+	codeTooManyJobs    = "TOO_MANY_JOBS"
+	codeJobUnavailable = "JOB_UNAVAILABLE"
+)
+
+// Progress states of a v2 job.
+const (
+	progressStarted = "started"
+	progressQueued  = statusQueued
+	progressResumed = "resumed"
+	progressMissed  = "missed"
+)
+
+const maxJobIDLength = 64
+
+// v2JobNamespace derives job IDs from the IDs v2 clients choose.
+var v2JobNamespace = uuid.MustParse("6f1c2a4e-8d3b-4f5a-9c7e-2b1d0e4f6a85")
+
+// v2JobID scopes a client-chosen job ID to the caller, so clients cannot
+// collide with or reach each other's jobs. Messages keep the client's ID.
+func v2JobID(who caller, id string) string {
+	return uuid.NewSHA1(v2JobNamespace, []byte(who.subject+"\x00"+id)).String()
+}
+
+// clientMessage is anything a v2 client sends. Since is the last sequence
+// number a resuming client saw.
+type clientMessage struct {
+	Type    string  `json:"type"`
+	JobID   string  `json:"job_id"`
+	Options payload `json:"options"`
+	Since   int64   `json:"since"`
+}
+
+// serverMessage is anything a v2 server sends. Seq numbers a job's messages
+// from 1 so a client can resume after the last one it saw; Index and Proxy
+// identify the proxy in the job's list for per-proxy messages.
+type serverMessage struct {
+	Type    string `json:"type"`
+	JobID   string `json:"job_id,omitempty"`
+	Seq     int64  `json:"seq,omitempty"`
+	Index   *int   `json:"index,omitempty"`
+	Proxy   string `json:"proxy,omitempty"`
+	Data    any    `json:"data,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+	Details any    `json:"details,omitempty"`
+}
+
+type progressData struct {
+	State  string `json:"state"`
+	Total  int    `json:"total,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	Missed int64  `json:"missed,omitempty"`
+}
+
+func errorMessage(jobID, code, message string) serverMessage {
+	return serverMessage{Type: msgError, JobID: jobID, Code: code, Message: message}
+}
+
+// serveV2 speaks the typed protocol. Every batch is a server-side job: the
+// connection only follows it, so several can run at once, each can be
+// cancelled on its own, and a client that reconnects can resume one by ID.
+func (h *Handler) serveV2(ctx context.Context, conn *websocket.Conn, clientIP string, who caller, out *outbox) {
+	var (
+		mu        sync.Mutex
+		following = make(map[string]context.CancelFunc)
+		wg        sync.WaitGroup
+	)
+	// Leaving stops the streams, not the jobs.
+	defer func() {
+		mu.Lock()
+		for _, stop := range following {
+			stop()
+		}
+		mu.Unlock()
+		wg.Wait()
+	}()
+
+	follow := func(jobID string, since int64) {
+		if err := h.jobs.authorize(ctx, v2JobID(who, jobID), who.subject); err != nil {
+			if errors.Is(err, errJobNotFound) {
+				out.send(ctx, errorMessage(jobID, codeJobNotFound, "no job with this id"))
+			} else {
+				log.Printf("[WARN] loading check job %s failed: %v", jobID, err)
+				out.send(ctx, errorMessage(jobID, codeJobUnavailable, "job unavailable"))
+			}
+			return
+		}
+		mu.Lock()
+		if _, dup := following[jobID]; dup {
+			mu.Unlock()
+			out.send(ctx, errorMessage(jobID, codeJobExists, "already following this job"))
+			return
+		}
+		followCtx, stop := context.WithCancel(ctx)
+		following[jobID] = stop
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				mu.Lock()
+				delete(following, jobID)
+				mu.Unlock()
+				stop()
+			}()
+			err := h.jobs.follow(followCtx, v2JobID(who, jobID), since, func(msg serverMessage) bool {
+				msg.JobID = jobID
+				return out.send(followCtx, msg)
+			})
+			if errors.Is(err, errJobNotFound) {
+				out.send(ctx, errorMessage(jobID, codeJobNotFound, "no job with this id"))
+			} else if err != nil {
+				log.Printf("[WARN] following check job %s failed: %v", jobID, err)
+			}
+		}()
+	}
+
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			h.logReadError(clientIP, err)
+			return
+		}
+		var msg clientMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			out.send(ctx, errorMessage("", codeInvalidMessage, "invalid message"))
+			continue
+		}
+
+		switch msg.Type {
+		case msgCheckStart:
+			jobID := msg.JobID
+			if jobID == "" {
+				jobID = uuid.NewString()
+			}
+			if len(jobID) > maxJobIDLength {
+				out.send(ctx, errorMessage("", codeInvalidJobID, fmt.Sprintf("job_id too long (max %d)", maxJobIDLength)))
+				continue
+			}
+
+			b, rerr := h.newBatch(ctx, who, msg.Options, h.batchLimit(who.tier))
+			if rerr != nil {
+				out.send(ctx, serverMessage{Type: msgError, JobID: jobID, Code: rerr.code, Message: rerr.message, Details: rerr.details})
+				if rerr.code == codeInvalidInput {
+					log.Printf("[SECURITY] Potential injection attempt from %s", clientIP)
+					return // Reject the connection on injection attempt
+				}
+				continue
+			}
+
+			serverID := v2JobID(who, jobID)
+			_, err := h.jobs.start(serverID, who.subject, h.jobLimit(who.tier), b.total, func(ctx context.Context, emit func(serverMessage)) batchSummary {
+				return h.runJob(ctx, serverID, b, emit)
+			})
+			switch {
+			case errors.Is(err, errJobExists):
+				out.send(ctx, errorMessage(jobID, codeJobExists, "job already exists"))
+			case errors.Is(err, errTooManyJobs):
+				out.send(ctx, errorMessage(jobID, codeTooManyJobs, fmt.Sprintf("too many running jobs (max %d)", h.jobLimit(who.tier))))
+			case err != nil:
+				log.Printf("[WARN] starting check job failed: %v", err)
+				out.send(ctx, errorMessage(jobID, codeJobUnavailable, "could not start job"))
+			default:
+				follow(jobID, 0)
+			}
+
+		case msgCheckResume:
+			follow(msg.JobID, msg.Since)
+
+		case msgCheckCancel:
+			serverID := v2JobID(who, msg.JobID)
+			err := h.jobs.authorize(ctx, serverID, who.subject)
+			if err == nil {
+				err = h.jobs.cancel(ctx, serverID)
+			}
+			if err != nil {
+				out.send(ctx, errorMessage(msg.JobID, codeJobNotFound, "no running job with this id"))
+			}
+			// Otherwise the job answers with a cancelled summary.
+
+		default:
+			out.send(ctx, errorMessage(msg.JobID, codeUnknownType, fmt.Sprintf("unknown message type %q", msg.Type)))
+		}
+	}
+}
+
+// runJob runs one job's batch, reporting its start, every proxy and the
+// summary.
+func (h *Handler) runJob(ctx context.Context, jobID string, b batch, emit func(serverMessage)) batchSummary {
+	emit(serverMessage{Type: msgCheckProgress, JobID: jobID, Data: progressData{State: progressStarted, Total: b.total}})
+	summary := h.runBatch(ctx, b, func(ev batchEvent) {
+		index := ev.Index
+		if ev.Result != nil {
+			emit(serverMessage{Type: msgCheckResult, JobID: jobID, Index: &index, Proxy: ev.Proxy, Data: ev.Result})
+			return
+		}
+		emit(serverMessage{Type: msgCheckProgress, JobID: jobID, Index: &index, Proxy: ev.Proxy, Data: progressData{State: progressQueued, Reason: ev.Reason}})
+	})
+	emit(serverMessage{Type: msgCheckSummary, JobID: jobID, Data: summary})
+	return summary
+}
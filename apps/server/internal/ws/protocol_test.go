@@ -0,0 +1,289 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"socksproxies.com/server/internal/config"
+	"socksproxies.com/server/internal/rate"
+)
+
+func newV2Handler() *Handler {
+	useTestProbers()
+	return NewHandler(config.Config{
+		JudgeURL:                "http://judge.invalid",
+		MaxConcurrent:           4,
+		MaxWebSocketConnections: 2,
+		AllowedOrigins:          []string{"http://allowed.test"},
+		CheckClientQueue:        4,
+		CheckJobTTL:             time.Minute,
+		CheckJobReplay:          1024,
+		APIKeys:                 []string{"test-key"},
+		JWTSecret:               "test-secret",
+	}, nil, nil, nil)
+}
+
+func newV2Conn(t *testing.T) *websocket.Conn {
+	t.Helper()
+	return dialV2(t, newV2Handler())
+}
+
+func dialV2(t *testing.T, h *Handler) *websocket.Conn {
+	t.Helper()
+	conn := dialWS(t, h, subprotocolV2)
+	if conn.Subprotocol() != subprotocolV2 {
+		t.Fatalf("expected %s to be negotiated, got %q", subprotocolV2, conn.Subprotocol())
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// v2Message is a server message with data left raw for the caller to decode.
+type v2Message struct {
+	Type    string          `json:"type"`
+	JobID   string          `json:"job_id"`
+	Seq     int64           `json:"seq"`
+	Index   *int            `json:"index"`
+	Data    json.RawMessage `json:"data"`
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+}
+
+func readV2(t *testing.T, conn *websocket.Conn) v2Message {
+	t.Helper()
+	var msg v2Message
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+func sendV2(t *testing.T, conn *websocket.Conn, msg string) {
+	t.Helper()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestHandler_V2_ConcurrentJobs(t *testing.T) {
+	conn := newV2Conn(t)
+	sendV2(t, conn, `{"type":"check.start","job_id":"a","options":{"proxies":["192.0.2.1:1080","not a proxy"],"protocol":"socks5","prober":"ws-test-slow"}}`)
+	sendV2(t, conn, `{"type":"check.start","job_id":"b","options":{"proxies":["198.51.100.1:1080"],"protocol":"socks5","prober":"ws-test-slow"}}`)
+
+	results := map[string]int{}
+	summaries := map[string]batchSummary{}
+	for len(summaries) < 2 {
+		msg := readV2(t, conn)
+		switch msg.Type {
+		case msgCheckResult:
+			if msg.Index == nil {
+				t.Fatalf("result without index: %+v", msg)
+			}
+			results[msg.JobID]++
+		case msgCheckSummary:
+			var summary batchSummary
+			if err := json.Unmarshal(msg.Data, &summary); err != nil {
+				t.Fatalf("decode summary: %v", err)
+			}
+			summaries[msg.JobID] = summary
+		case msgCheckProgress:
+		default:
+			t.Fatalf("unexpected message %+v", msg)
+		}
+	}
+
+	if results["a"] != 2 || results["b"] != 1 {
+		t.Errorf("expected 2 and 1 results, got %v", results)
+	}
+	a := summaries["a"]
+	if a.Total != 2 || a.Completed != 2 || a.Working != 1 || a.Failed != 1 || a.Cancelled {
+		t.Errorf("unexpected summary for a: %+v", a)
+	}
+	if b := summaries["b"]; b.Total != 1 || b.Working != 1 {
+		t.Errorf("unexpected summary for b: %+v", b)
+	}
+}
+
+func TestHandler_V2_Cancel(t *testing.T) {
+	conn := newV2Conn(t)
+	sendV2(t, conn, `{"type":"check.start","job_id":"slow","options":{"proxies":["192.0.2.1:1080"],"prober":"ws-test-hang"}}`)
+	if msg := readV2(t, conn); msg.Type != msgCheckProgress || msg.JobID != "slow" {
+		t.Fatalf("expected the job to start, got %+v", msg)
+	}
+
+	sendV2(t, conn, `{"type":"check.start","job_id":"slow","options":{"proxies":["192.0.2.1:1080"]}}`)
+	if msg := readV2(t, conn); msg.Type != msgError || msg.Code != codeJobExists {
+		t.Fatalf("expected %s, got %+v", codeJobExists, msg)
+	}
+
+	sendV2(t, conn, `{"type":"check.cancel","job_id":"slow"}`)
+	for {
+		msg := readV2(t, conn)
+		if msg.Type != msgCheckSummary {
+			continue
+		}
+		var summary batchSummary
+		if err := json.Unmarshal(msg.Data, &summary); err != nil {
+			t.Fatalf("decode summary: %v", err)
+		}
+		if !summary.Cancelled {
+			t.Errorf("expected a cancelled summary, got %+v", summary)
+		}
+		break
+	}
+
+	sendV2(t, conn, `{"type":"check.cancel","job_id":"slow"}`)
+	if msg := readV2(t, conn); msg.Code != codeJobNotFound {
+		t.Errorf("expected %s once the job is gone, got %+v", codeJobNotFound, msg)
+	}
+}
+
+func TestHandler_V2_JobsBelongToTheirClient(t *testing.T) {
+	h := newV2Handler()
+	owner := dialV2(t, h)
+	sendV2(t, owner, `{"type":"check.start","job_id":"mine","options":{"proxies":["192.0.2.1:1080"],"prober":"ws-test-hang"}}`)
+	if msg := readV2(t, owner); msg.Type != msgCheckProgress || msg.JobID != "mine" {
+		t.Fatalf("expected the job to start, got %+v", msg)
+	}
+
+	other := dialWSWithHeader(t, h, http.Header{"Authorization": []string{"Bearer test-key"}}, subprotocolV2)
+	_ = other.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, message := range []string{
+		`{"type":"check.resume","job_id":"mine"}`,
+		`{"type":"check.cancel","job_id":"mine"}`,
+	} {
+		sendV2(t, other, message)
+		if msg := readV2(t, other); msg.Code != codeJobNotFound {
+			t.Errorf("%s: expected %s for another client's job, got %+v", message, codeJobNotFound, msg)
+		}
+	}
+	sendV2(t, other, `{"type":"check.start","job_id":"mine","options":{"proxies":["192.0.2.1:1080"],"prober":"ws-test-hang"}}`)
+	if msg := readV2(t, other); msg.Type != msgCheckProgress || msg.JobID != "mine" {
+		t.Errorf("expected another client to reuse the ID, got %+v", msg)
+	}
+
+	sendV2(t, owner, `{"type":"check.cancel","job_id":"mine"}`)
+	for {
+		if msg := readV2(t, owner); msg.Type == msgCheckSummary {
+			break
+		}
+	}
+	sendV2(t, other, `{"type":"check.cancel","job_id":"mine"}`)
+}
+
+func TestHandler_V2_Errors(t *testing.T) {
+	conn := newV2Conn(t)
+	tests := []struct {
+		message string
+		code    string
+	}{
+		{`not json`, codeInvalidMessage},
+		{`{"type":"check.pause"}`, codeUnknownType},
+		{`{"type":"check.start","job_id":"x","options":{"proxies":[]}}`, codeEmptyProxyList},
+		{`{"type":"check.start","options":{"proxies":["192.0.2.1:1080"],"prober":"nope"}}`, codeUnknownProber},
+	}
+	for _, tt := range tests {
+		sendV2(t, conn, tt.message)
+		msg := readV2(t, conn)
+		if msg.Type != msgError || msg.Code != tt.code {
+			t.Errorf("%s: expected %s, got %+v", tt.message, tt.code, msg)
+		}
+	}
+}
+
+func TestHandler_V2_ResumeAfterReconnect(t *testing.T) {
+	h := newV2Handler()
+	first := dialV2(t, h)
+	sendV2(t, first, `{"type":"check.start","job_id":"resume-me","options":{"proxies":["192.0.2.1:1080","192.0.2.2:1080","192.0.2.3:1080","192.0.2.4:1080","192.0.2.5:1080","192.0.2.6:1080"],"protocol":"socks5","prober":"ws-test-slow"}}`)
+
+	// Drop the connection after the first result; the job keeps running.
+	var lastSeq int64
+	seen := map[int]bool{}
+	for {
+		msg := readV2(t, first)
+		lastSeq = msg.Seq
+		if msg.Type == msgCheckResult {
+			seen[*msg.Index] = true
+			break
+		}
+	}
+	first.Close()
+
+	second := dialV2(t, h)
+	sendV2(t, second, fmt.Sprintf(`{"type":"check.resume","job_id":"resume-me","since":%d}`, lastSeq))
+	if msg := readV2(t, second); msg.Type != msgCheckProgress || !strings.Contains(string(msg.Data), progressResumed) {
+		t.Fatalf("expected a resumed notice, got %+v", msg)
+	}
+	for {
+		msg := readV2(t, second)
+		if msg.Seq != lastSeq+1 {
+			t.Fatalf("expected seq %d, got %+v", lastSeq+1, msg)
+		}
+		lastSeq = msg.Seq
+		if msg.Type == msgCheckResult {
+			if seen[*msg.Index] {
+				t.Errorf("result %d delivered twice", *msg.Index)
+			}
+			seen[*msg.Index] = true
+		}
+		if msg.Type == msgCheckSummary {
+			break
+		}
+	}
+	if len(seen) != 6 {
+		t.Errorf("expected all 6 results across both connections, got %d", len(seen))
+	}
+}
+
+func TestHandler_RunBatch_PoolClosed(t *testing.T) {
+	h := newV2Handler()
+	h.pool.Close()
+	who := caller{subject: "192.0.2.1", tier: rate.TierFree}
+	data := payload{Proxies: []string{"192.0.2.10:1080", "192.0.2.11:1080"}, Protocol: "socks5", Prober: "ws-test-slow"}
+
+	b, rerr := h.newBatch(context.Background(), who, data, h.batchLimit(who.tier))
+	if rerr != nil {
+		t.Fatalf("newBatch: %+v", rerr)
+	}
+	var mu sync.Mutex
+	var results []batchEvent
+	summary := h.runBatch(context.Background(), b, func(ev batchEvent) {
+		mu.Lock()
+		results = append(results, ev)
+		mu.Unlock()
+	})
+	if summary.Completed != 2 || summary.Failed != 2 {
+		t.Errorf("expected both proxies to be reported as failed, got %+v", summary)
+	}
+	for _, ev := range results {
+		if ev.Result == nil || !strings.Contains(ev.Result.Error, "not run") {
+			t.Errorf("expected a not-run result for %s, got %+v", ev.Proxy, ev.Result)
+		}
+	}
+}
+
+func TestHandler_RunBatch_RecoversFromPanics(t *testing.T) {
+	h := newV2Handler()
+	h.pool.Close()
+	who := caller{subject: "192.0.2.1", tier: rate.TierFree}
+	data := payload{Proxies: []string{"192.0.2.10:1080", "192.0.2.11:1080"}, Protocol: "socks5", Prober: "ws-test-slow"}
+
+	b, rerr := h.newBatch(context.Background(), who, data, h.batchLimit(who.tier))
+	if rerr != nil {
+		t.Fatalf("newBatch: %+v", rerr)
+	}
+	summary := h.runBatch(context.Background(), b, func(batchEvent) {
+		panic("follower gone wrong")
+	})
+	if summary.Completed != 2 || summary.Failed != 2 {
+		t.Errorf("expected both proxies to be counted despite the panics, got %+v", summary)
+	}
+}
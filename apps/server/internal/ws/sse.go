@@ -0,0 +1,130 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"socksproxies.com/server/internal/api"
+)
+
+// sseHeartbeat keeps idle streams open through proxies that time them out.
+const sseHeartbeat = 15 * time.Second
+
+// StartCheck starts a check job for clients that stream its events over
+// Server-Sent Events instead of a WebSocket.
+func (h *Handler) StartCheck(c *gin.Context) {
+	who, err := h.identify(c)
+	if err != nil {
+		api.RespondError(c, http.StatusUnauthorized, "UNAUTHORIZED", err.Error(), nil)
+		return
+	}
+	job, ok := h.startCheckJob(c, who)
+	if !ok {
+		return
+	}
+	events := "/api/checks/" + job.ID + "/events"
+	c.Header("Location", events)
+	c.JSON(http.StatusAccepted, gin.H{
+		"data":  job,
+		"links": gin.H{"events": events},
+	})
+}
+
+// CheckEvents streams a job's messages as Server-Sent Events: the event name
+// is the v2 message type, the data the v2 message and the id its sequence
+// number, so a reconnecting EventSource resumes through Last-Event-ID. Only
+// the client that started the job may stream it.
+func (h *Handler) CheckEvents(c *gin.Context) {
+	job, ok := h.ownCheckJob(c)
+	if !ok {
+		return
+	}
+	jobID := job.ID
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	since, _ := strconv.ParseInt(lastEventID, 10, 64)
+
+	clientIP := c.ClientIP()
+	if !h.connTracker.Acquire(clientIP) {
+		api.RespondError(c, http.StatusTooManyRequests, "TOO_MANY_STREAMS", "connection limit exceeded for this IP", nil)
+		return
+	}
+	defer h.connTracker.Release(clientIP)
+
+	// Streams outlive the server's write timeout.
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ctx := c.Request.Context()
+	var mu sync.Mutex
+	write := func(frame string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := c.Writer.WriteString(frame); err != nil {
+			return false
+		}
+		c.Writer.Flush()
+		return true
+	}
+
+	// The heartbeat must be done writing before the handler returns and gin
+	// reuses the writer.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	done := make(chan struct{})
+	defer close(done)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(sseHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if !write(": ping\n\n") {
+					return
+				}
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	err := h.jobs.follow(ctx, jobID, since, func(msg serverMessage) bool {
+		return write(sseFrame(msg))
+	})
+	if err != nil {
+		write(sseFrame(errorMessage(jobID, codeJobUnavailable, "check job unavailable")))
+	}
+}
+
+// sseFrame encodes one message. Notices that are not part of the job's
+// sequence carry no id, so they do not move Last-Event-ID.
+func sseFrame(msg serverMessage) string {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return ""
+	}
+	var b strings.Builder
+	if msg.Seq > 0 {
+		fmt.Fprintf(&b, "id: %d\n", msg.Seq)
+	}
+	fmt.Fprintf(&b, "event: %s\ndata: %s\n\n", msg.Type, data)
+	return b.String()
+}
@@ -0,0 +1,121 @@
+package ws
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// readSSE reads events from a stream until the summary.
+func readSSE(t *testing.T, server *httptest.Server, path, lastEventID string) []sseEvent {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("get events: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %q", resp.StatusCode, ct)
+	}
+
+	var events []sseEvent
+	var current sseEvent
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			events = append(events, current)
+			if current.event == msgCheckSummary {
+				return events
+			}
+			current = sseEvent{}
+		case strings.HasPrefix(line, "id: "):
+			current.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			current.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	t.Fatalf("stream ended before the summary: %v", scanner.Err())
+	return nil
+}
+
+func TestHandler_CheckEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := newV2Handler()
+	router := gin.New()
+	router.POST("/api/checks", h.StartCheck)
+	router.GET("/api/checks/:id/events", h.CheckEvents)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := server.Client().Post(server.URL+"/api/checks", "application/json", strings.NewReader(`{"proxies":["192.0.2.1:1080","192.0.2.2:1080","192.0.2.3:1080"],"protocol":"socks5","prober":"ws-test-slow"}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	var created struct {
+		Links struct {
+			Events string `json:"events"`
+		} `json:"links"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusAccepted || created.Links.Events == "" {
+		t.Fatalf("expected 202 with an events link, got %d (%v)", resp.StatusCode, err)
+	}
+
+	events := readSSE(t, server, created.Links.Events, "")
+	results := 0
+	for i, ev := range events {
+		if ev.id != strconv.Itoa(i+1) {
+			t.Errorf("event %d: expected id %d, got %q", i, i+1, ev.id)
+		}
+		if ev.event == msgCheckResult {
+			results++
+		}
+	}
+	if events[0].event != msgCheckProgress || results != 3 {
+		t.Errorf("expected a start, 3 results and a summary, got %+v", events)
+	}
+
+	// Resume after the first result.
+	resumed := readSSE(t, server, created.Links.Events, "2")
+	if resumed[0].id != "" || !strings.Contains(resumed[0].data, progressResumed) {
+		t.Errorf("expected an unnumbered resumed notice first, got %+v", resumed[0])
+	}
+	if len(resumed) != len(events)-1 || resumed[1].id != "3" {
+		t.Errorf("expected the events after id 2, got %+v", resumed)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/checks/nope/events", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown job, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, created.Links.Events, nil)
+	req.Header.Set("Authorization", "Bearer test-key")
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another client's job, got %d", rec.Code)
+	}
+}
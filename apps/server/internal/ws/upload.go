@@ -0,0 +1,728 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"socksproxies.com/server/internal/api"
+	"socksproxies.com/server/internal/checker"
+)
+
+const (
+	// maxUploadProxies and maxUploadMB apply to tiers without configured
+	// upload limits.
+	maxUploadProxies = 10000
+	maxUploadMB      = 20
+	// maxUploadErrors caps the per-line errors returned for one upload.
+	maxUploadErrors = 100
+	maxErrorInput   = 200
+	// exportFlushEvery is how many exported proxies are sent at a time.
+	exportFlushEvery = 1000
+
+	codeInvalidUpload  = "INVALID_UPLOAD"
+	codeUploadTooLarge = "UPLOAD_TOO_LARGE"
+)
+
+var (
+	errUploadTooLarge = errors.New("upload too large")
+	errInvalidEntry   = errors.New("invalid input detected")
+)
+
+// Upload formats. Gzip is detected from the content and may wrap any of them.
+const (
+	uploadFormatTxt  = "txt"
+	uploadFormatCSV  = "csv"
+	uploadFormatJSON = "json"
+)
+
+// lineError is an entry of an upload that will not be checked. Line is the
+// line number for txt and CSV files and the element number for JSON.
+type lineError struct {
+	Line  int    `json:"line"`
+	Input string `json:"input"`
+	Error string `json:"error"`
+}
+
+// uploadReport describes what was read from an uploaded list.
+type uploadReport struct {
+	Filename        string      `json:"filename"`
+	Format          string      `json:"format"`
+	Entries         int         `json:"entries"`
+	Valid           int         `json:"valid"`
+	Invalid         int         `json:"invalid"`
+	Errors          []lineError `json:"errors,omitempty"`
+	ErrorsTruncated bool        `json:"errors_truncated,omitempty"`
+}
+
+// UploadCheckJob starts a check job for a proxy list sent as the "file" part
+// of a multipart form: plain text, CSV or JSON, optionally gzipped. An
+// "options" part takes the WebSocket payload without its proxies, and
+// "format" overrides format detection. The list is spooled to disk, checked
+// line by line and read again by the job as it runs, so it never has to fit
+// in memory. Lines that cannot be checked are reported with the job.
+func (h *Handler) UploadCheckJob(c *gin.Context) {
+	who, err := h.identify(c)
+	if err != nil {
+		api.RespondError(c, http.StatusUnauthorized, "UNAUTHORIZED", err.Error(), nil)
+		return
+	}
+
+	maxBytes := h.uploadMaxBytes()
+	// Leave room for the multipart framing and the other parts.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+1<<20)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		api.RespondError(c, http.StatusBadRequest, codeInvalidUpload, "expected a multipart/form-data body", nil)
+		return
+	}
+
+	list := &uploadedList{maxBytes: maxBytes}
+	defer func() {
+		if list.path != "" {
+			_ = os.Remove(list.path)
+		}
+	}()
+	var data payload
+	if err := readUploadForm(reader, list, &data); err != nil {
+		respondUploadError(c, err, maxBytes)
+		return
+	}
+	if list.path == "" {
+		api.RespondError(c, http.StatusBadRequest, codeInvalidUpload, "file is required", nil)
+		return
+	}
+
+	b, rerr := h.prepareBatch(c.Request.Context(), who, data)
+	if rerr != nil {
+		api.RespondError(c, rerr.status, rerr.code, rerr.message, rerr.details)
+		return
+	}
+
+	limit := h.uploadLimit(who)
+	report, err := list.scan(data.Protocol, limit)
+	if err != nil {
+		respondUploadError(c, err, maxBytes)
+		return
+	}
+	if report.Valid > limit {
+		api.RespondError(c, http.StatusBadRequest, codeLimitExceeded, fmt.Sprintf("limit exceeded (max %d)", limit), nil)
+		return
+	}
+	if report.Valid == 0 {
+		api.RespondError(c, http.StatusBadRequest, codeEmptyProxyList, "no proxies to check", report)
+		return
+	}
+	if slices.ContainsFunc(report.Errors, func(e lineError) bool { return e.Error == errInvalidEntry.Error() }) {
+		log.Printf("[SECURITY] Potential injection attempt from %s", c.ClientIP())
+	}
+
+	// The job owns the file from here on.
+	spooled := *list
+	list.path = ""
+	b.total = report.Valid
+	b.entries = spooled.valid(data.Protocol)
+	job, ok := h.launchCheckJob(c, who, b, func() { _ = os.Remove(spooled.path) })
+	if !ok {
+		return
+	}
+
+	links := checkJobLinks(job.ID)
+	links["export"] = checkJobURL(job.ID) + "/export/txt"
+	c.Header("Location", checkJobURL(job.ID))
+	c.JSON(http.StatusAccepted, gin.H{
+		"data":   job,
+		"upload": report,
+		"links":  links,
+	})
+}
+
+// readUploadForm spools the file part to disk and decodes the others.
+func readUploadForm(reader *multipart.Reader, list *uploadedList, data *payload) error {
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch part.FormName() {
+		case "file":
+			if list.path != "" {
+				err = badRequest(codeInvalidUpload, "only one file may be uploaded")
+				break
+			}
+			list.name = part.FileName()
+			err = list.spool(part)
+		case "options":
+			var raw []byte
+			raw, err = io.ReadAll(io.LimitReader(part, 64<<10))
+			if err == nil && json.Unmarshal(raw, data) != nil {
+				err = badRequest(codeInvalidRequest, "invalid options")
+			}
+			data.Proxies = nil
+		case "format":
+			var raw []byte
+			raw, err = io.ReadAll(io.LimitReader(part, 16))
+			list.format = strings.ToLower(strings.TrimSpace(string(raw)))
+			if err == nil && list.format != uploadFormatTxt && list.format != uploadFormatCSV && list.format != uploadFormatJSON {
+				err = badRequest(codeInvalidUpload, "format must be txt, csv or json")
+			}
+		}
+		part.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func respondUploadError(c *gin.Context, err error, maxBytes int64) {
+	var rerr *requestError
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &rerr):
+		api.RespondError(c, rerr.status, rerr.code, rerr.message, rerr.details)
+	case errors.Is(err, errUploadTooLarge), errors.As(err, &maxErr):
+		api.RespondError(c, http.StatusRequestEntityTooLarge, codeUploadTooLarge, fmt.Sprintf("upload exceeds %d MB", maxBytes>>20), nil)
+	default:
+		api.RespondError(c, http.StatusBadRequest, codeInvalidUpload, "could not read upload: "+err.Error(), nil)
+	}
+}
+
+// uploadLimit is the most proxies a caller's uploaded list may hold.
+func (h *Handler) uploadLimit(who caller) int {
+	if n := h.cfg.CheckUploadMax.ForTier(string(who.tier)); n > 0 {
+		return n
+	}
+	return maxUploadProxies
+}
+
+func (h *Handler) uploadMaxBytes() int64 {
+	mb := h.cfg.CheckUploadMaxMB
+	if mb <= 0 {
+		mb = maxUploadMB
+	}
+	return int64(mb) << 20
+}
+
+// uploadedList is a proxy list spooled to disk. Its entries are read from the
+// file each time they are needed.
+type uploadedList struct {
+	path     string
+	name     string
+	format   string
+	maxBytes int64
+}
+
+func (l *uploadedList) spool(r io.Reader) error {
+	f, err := os.CreateTemp("", "check-upload-*")
+	if err != nil {
+		return err
+	}
+	l.path = f.Name()
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// each reads every entry of the list and calls fn with it and the reason it
+// cannot be checked, if any, until fn returns false.
+func (l *uploadedList) each(protocol string, fn func(line int, raw string, err error) bool) error {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	name := strings.ToLower(l.name)
+	raw := bufio.NewReader(f)
+	var r io.Reader = raw
+	if magic, _ := raw.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(raw)
+		if err != nil {
+			return err
+		}
+		r = gz
+		name = strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".gzip")
+	}
+	br := bufio.NewReader(&cappedReader{r: r, max: l.maxBytes})
+	if l.format == "" {
+		l.format = detectUploadFormat(name, br)
+	}
+
+	return readEntries(br, l.format, func(line int, raw string) bool {
+		return fn(line, raw, checkEntry(raw, protocol))
+	})
+}
+
+// scan reads the whole list once, counting its entries and collecting the
+// errors of those that cannot be checked. It stops early once more than
+// limit entries are valid.
+func (l *uploadedList) scan(protocol string, limit int) (uploadReport, error) {
+	report := uploadReport{Filename: path.Base(l.name)}
+	err := l.each(protocol, func(line int, raw string, err error) bool {
+		report.Entries++
+		if err == nil {
+			report.Valid++
+			return report.Valid <= limit
+		}
+		report.Invalid++
+		if len(report.Errors) == maxUploadErrors {
+			report.ErrorsTruncated = true
+			return true
+		}
+		report.Errors = append(report.Errors, lineError{Line: line, Input: truncateInput(raw), Error: err.Error()})
+		return true
+	})
+	report.Format = l.format
+	return report, err
+}
+
+// valid yields the entries that can be checked, indexed by line from zero.
+func (l *uploadedList) valid(protocol string) func(yield func(int, string) bool) {
+	return func(yield func(int, string) bool) {
+		err := l.each(protocol, func(line int, raw string, err error) bool {
+			if err != nil {
+				return true
+			}
+			return yield(line-1, raw)
+		})
+		if err != nil {
+			log.Printf("[WARN] reading uploaded list %s failed: %v", l.name, err)
+		}
+	}
+}
+
+func checkEntry(raw, protocol string) error {
+	if api.ContainsSQLInjection(raw) || api.ContainsXSS(raw) {
+		return errInvalidEntry
+	}
+	_, err := checker.ParseProxyLine(raw, protocol)
+	return err
+}
+
+func truncateInput(raw string) string {
+	if len(raw) <= maxErrorInput {
+		return raw
+	}
+	cut := maxErrorInput
+	for cut > 0 && !utf8.RuneStart(raw[cut]) {
+		cut--
+	}
+	return raw[:cut] + "…"
+}
+
+// cappedReader fails once more than max bytes have been read, which bounds
+// what a small gzip can expand to.
+type cappedReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	if c.read > c.max {
+		return n, errUploadTooLarge
+	}
+	return n, err
+}
+
+// detectUploadFormat goes by the file extension, then by the first line:
+// JSON starts with a bracket or brace, CSV has commas.
+func detectUploadFormat(name string, r *bufio.Reader) string {
+	switch path.Ext(name) {
+	case ".csv":
+		return uploadFormatCSV
+	case ".json":
+		return uploadFormatJSON
+	case ".txt", ".list":
+		return uploadFormatTxt
+	}
+	head, _ := r.Peek(512)
+	head = bytes.TrimPrefix(head, []byte("\ufeff"))
+	trimmed := bytes.TrimSpace(head)
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return uploadFormatJSON
+	}
+	if firstLine, _, _ := bytes.Cut(trimmed, []byte("\n")); bytes.Contains(firstLine, []byte(",")) {
+		return uploadFormatCSV
+	}
+	return uploadFormatTxt
+}
+
+// readEntries streams the proxy entries of r to yield until it returns false.
+// Blank lines and lines starting with # are skipped in text and CSV.
+func readEntries(r io.Reader, format string, yield func(line int, raw string) bool) error {
+	switch format {
+	case uploadFormatCSV:
+		return readCSVEntries(r, yield)
+	case uploadFormatJSON:
+		return readJSONEntries(r, yield)
+	default:
+		return readTextEntries(r, yield)
+	}
+}
+
+func readTextEntries(r io.Reader, yield func(int, string) bool) error {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := strings.TrimSpace(scanner.Text())
+		if line == 1 {
+			raw = strings.TrimPrefix(raw, "\ufeff")
+		}
+		if raw == "" || strings.HasPrefix(raw, "#") {
+			continue
+		}
+		if !yield(line, raw) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// readCSVEntries reads a CSV with or without a header. With one, the proxy
+// column or the ip/host, port, protocol, username and password columns are
+// used, so proxy list exports can be checked as they are; without, the
+// columns of a row are joined as host:port[:user:pass].
+func readCSVEntries(r io.Reader, yield func(int, string) bool) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	reader.ReuseRecord = true
+
+	var columns map[string]int
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if first {
+			record[0] = strings.TrimPrefix(record[0], "\ufeff")
+			if columns = csvHeader(record); columns != nil {
+				continue
+			}
+		}
+		line, _ := reader.FieldPos(0)
+
+		var raw string
+		if columns == nil {
+			fields := make([]string, 0, len(record))
+			for _, field := range record {
+				if field = strings.TrimSpace(field); field != "" {
+					fields = append(fields, field)
+				}
+			}
+			raw = strings.Join(fields, ":")
+		} else {
+			get := func(names ...string) string {
+				for _, name := range names {
+					if i, ok := columns[name]; ok && i < len(record) {
+						if value := strings.TrimSpace(record[i]); value != "" {
+							return value
+						}
+					}
+				}
+				return ""
+			}
+			raw = get("proxy")
+			if raw == "" {
+				raw = composeEntry(get("ip", "host"), get("port"), firstProtocol(get("protocol", "protocols")), get("username", "user"), get("password", "pass"))
+			}
+		}
+		if raw == "" {
+			continue
+		}
+		if !yield(line, raw) {
+			return nil
+		}
+	}
+}
+
+func csvHeader(record []string) map[string]int {
+	columns := make(map[string]int, len(record))
+	for i, name := range record {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"proxy", "ip", "host"} {
+		if _, ok := columns[name]; ok {
+			return columns
+		}
+	}
+	return nil
+}
+
+// jsonEntry is an object in a JSON list. The fields of the proxy list export
+// are understood.
+type jsonEntry struct {
+	Proxy     string      `json:"proxy"`
+	IP        string      `json:"ip"`
+	Host      string      `json:"host"`
+	Port      json.Number `json:"port"`
+	Protocol  string      `json:"protocol"`
+	Protocols []string    `json:"protocols"`
+	Username  string      `json:"username"`
+	Password  string      `json:"password"`
+}
+
+// readJSONEntries reads an array of strings or objects, either bare or as
+// the "data" or "proxies" field of an object, decoding one element at a time.
+func readJSONEntries(r io.Reader, yield func(int, string) bool) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == json.Delim('{') {
+		if err := seekJSONList(dec); err != nil {
+			return err
+		}
+	} else if tok != json.Delim('[') {
+		return errors.New("expected a JSON array or object")
+	}
+
+	for n := 1; dec.More(); n++ {
+		var element json.RawMessage
+		if err := dec.Decode(&element); err != nil {
+			return err
+		}
+		var raw string
+		if err := json.Unmarshal(element, &raw); err != nil {
+			var entry jsonEntry
+			if json.Unmarshal(element, &entry) == nil {
+				raw = entry.Proxy
+				if raw == "" {
+					protocol := entry.Protocol
+					if protocol == "" && len(entry.Protocols) > 0 {
+						protocol = entry.Protocols[0]
+					}
+					host := entry.IP
+					if host == "" {
+						host = entry.Host
+					}
+					raw = composeEntry(host, entry.Port.String(), firstProtocol(protocol), entry.Username, entry.Password)
+				}
+			} else {
+				raw = string(element)
+			}
+		}
+		if !yield(n, strings.TrimSpace(raw)) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// seekJSONList advances dec into the array under "data" or "proxies".
+func seekJSONList(dec *json.Decoder) error {
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key == "data" || key == "proxies" {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if tok != json.Delim('[') {
+				return fmt.Errorf("%s must be an array", key)
+			}
+			return nil
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return err
+		}
+	}
+	return errors.New(`expected a "data" or "proxies" array`)
+}
+
+// composeEntry builds a line ParseProxyLine understands from its parts.
+func composeEntry(host, port, protocol, username, password string) string {
+	if host == "" && port == "" {
+		return ""
+	}
+	address := net.JoinHostPort(host, port)
+	if protocol == "" {
+		if username != "" {
+			return address + ":" + username + ":" + password
+		}
+		return address
+	}
+	u := url.URL{Scheme: protocol, Host: address}
+	if username != "" {
+		u.User = url.UserPassword(username, password)
+	}
+	return u.String()
+}
+
+// firstProtocol takes the first of a list such as "HTTP|SOCKS5".
+func firstProtocol(value string) string {
+	first, _, _ := strings.Cut(value, "|")
+	first, _, _ = strings.Cut(first, ",")
+	return strings.ToLower(strings.TrimSpace(first))
+}
+
+// ExportCheckJob downloads the proxies of a finished job in a proxy list
+// export format (txt, csv, json, clash or surfshark). Only working proxies
+// are included unless status=all.
+func (h *Handler) ExportCheckJob(c *gin.Context) {
+	format := strings.ToLower(strings.TrimPrefix(c.Param("format"), "."))
+	job, ok := h.ownCheckJob(c)
+	if !ok {
+		return
+	}
+	if job.Status == checkJobRunning {
+		api.RespondError(c, http.StatusConflict, "CHECK_JOB_NOT_READY", "check job is still running", nil)
+		return
+	}
+	results, err := h.jobs.results(c.Request.Context(), job.ID, 0, 0)
+	if err != nil {
+		respondCheckJobError(c, err)
+		return
+	}
+	slices.SortFunc(results, func(a, b jobResult) int { return a.Index - b.Index })
+
+	if !api.IsExportFormatSupported(format) {
+		api.RespondError(c, http.StatusBadRequest, "INVALID_FORMAT", fmt.Sprintf("unsupported export format: %s", format), nil)
+		return
+	}
+	if c.Query("status") != "all" {
+		results = slices.DeleteFunc(results, func(r jobResult) bool { return !r.Result.Status })
+	}
+
+	api.SetExportHeaders(c, format, fmt.Sprintf("check-%s.%s", job.ID, format))
+	c.Header("X-Total-Count", strconv.Itoa(len(results)))
+	if job.ResultsDropped > 0 {
+		c.Header("X-Results-Dropped", strconv.Itoa(job.ResultsDropped))
+	}
+	c.Status(http.StatusOK)
+	if err := writeCheckJobExport(c.Writer, format, results); err != nil {
+		log.Printf("[WARN] export of check job %s failed: %v", job.ID, err)
+		abortResponse(c)
+	}
+}
+
+// writeCheckJobExport streams results in format, flushing as it goes.
+func writeCheckJobExport(w gin.ResponseWriter, format string, results []jobResult) error {
+	out, err := api.NewProxyListWriter(w, format, api.WithThroughputColumns())
+	if err != nil {
+		return err
+	}
+	for i, r := range results {
+		if err := out.Write(proxyListItem(r.Proxy, r.Result)); err != nil {
+			return err
+		}
+		if i%exportFlushEvery == exportFlushEvery-1 {
+			if err := out.Flush(); err != nil {
+				return err
+			}
+			w.Flush()
+		}
+	}
+	return out.Close()
+}
+
+// abortResponse drops the connection of a response that failed part way,
+// so the client sees a broken download rather than a short one.
+func abortResponse(c *gin.Context) {
+	if conn, _, err := c.Writer.Hijack(); err == nil {
+		_ = conn.Close()
+	}
+}
+
+// proxyListItem presents a check result the way the proxy list does. raw is
+// the line that was checked, the address of proxies the result has none for.
+func proxyListItem(raw string, res checker.ProxyResult) api.ProxyListItem {
+	host, portStr := res.IP, res.Port
+	if host == "" || portStr == "" {
+		if target, err := checker.ParseProxyLine(raw, res.Protocol); err == nil {
+			host, portStr, _ = net.SplitHostPort(target.Address)
+		}
+	}
+	port, _ := strconv.Atoi(portStr)
+	item := api.ProxyListItem{
+		Host:        host,
+		IP:          host,
+		Port:        port,
+		IPVersion:   res.IPVersion,
+		Delay:       int(res.Latency),
+		CountryCode: res.Country,
+		Anon:        res.Anon,
+		Protocols:   []string{},
+		LastSeen:    res.CheckedAt,
+	}
+	if res.EntryGeo != nil {
+		item.City = res.EntryGeo.City
+		item.ASN = res.EntryGeo.ASN
+		item.Org = res.EntryGeo.Org
+	}
+	if res.Anonymity != "" {
+		item.AnonymityLevel = strings.ToUpper(res.Anonymity[:1]) + res.Anonymity[1:]
+	}
+	if res.Throughput != nil {
+		item.ThroughputKBps, item.ThroughputCompleted = &res.Throughput.KBps, &res.Throughput.Completed
+	}
+	if res.Status {
+		item.ChecksUp, item.Uptime = 1, 100
+	} else {
+		item.ChecksDown = 1
+	}
+
+	protocols := res.Protocols
+	if len(protocols) == 0 && res.Protocol != "" {
+		protocols = []string{res.Protocol}
+	}
+	// The list has a column per protocol; the variants that leave name
+	// resolution to the proxy go in their base protocol's.
+	for _, protocol := range protocols {
+		var name string
+		switch strings.ToLower(protocol) {
+		case "http":
+			item.HTTP, name = 1, "HTTP"
+		case "https":
+			item.SSL, name = 1, "HTTPS"
+		case "socks4", "socks4a":
+			item.Socks4, name = 1, "SOCKS4"
+		case "socks5", "socks5h", "socks":
+			item.Socks5, name = 1, "SOCKS5"
+		default:
+			continue
+		}
+		if !slices.Contains(item.Protocols, name) {
+			item.Protocols = append(item.Protocols, name)
+		}
+	}
+	return item
+}
@@ -0,0 +1,253 @@
+package ws
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"socksproxies.com/server/internal/checker"
+)
+
+func TestReadEntries(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+		want   []string
+		lines  []int
+	}{
+		{
+			name:   "text",
+			format: uploadFormatTxt,
+			input:  "\ufeff# list\n192.0.2.1:1080\n\n  socks5://192.0.2.2:1080  \n",
+			want:   []string{"192.0.2.1:1080", "socks5://192.0.2.2:1080"},
+			lines:  []int{2, 4},
+		},
+		{
+			name:   "csv export",
+			format: uploadFormatCSV,
+			input:  "ip,port,country_code,protocols\n192.0.2.1,1080,US,SOCKS5|HTTP\n2001:db8::1,3128,DE,HTTP\n",
+			want:   []string{"socks5://192.0.2.1:1080", "http://[2001:db8::1]:3128"},
+			lines:  []int{2, 3},
+		},
+		{
+			name:   "csv without header",
+			format: uploadFormatCSV,
+			input:  "192.0.2.1,1080\n192.0.2.2,1080,user,pass\n",
+			want:   []string{"192.0.2.1:1080", "192.0.2.2:1080:user:pass"},
+			lines:  []int{1, 2},
+		},
+		{
+			name:   "json array",
+			format: uploadFormatJSON,
+			input:  `["192.0.2.1:1080", {"ip":"192.0.2.2","port":"8080","protocol":"http","username":"u","password":"p"}, 42]`,
+			want:   []string{"192.0.2.1:1080", "http://u:p@192.0.2.2:8080", "42"},
+			lines:  []int{1, 2, 3},
+		},
+		{
+			name:   "json export",
+			format: uploadFormatJSON,
+			input:  `{"meta":{"total":1},"data":[{"host":"192.0.2.1","ip":"192.0.2.1","port":1080,"protocols":["SOCKS5"]}]}`,
+			want:   []string{"socks5://192.0.2.1:1080"},
+			lines:  []int{1},
+		},
+	}
+	for _, tt := range tests {
+		var got []string
+		var lines []int
+		err := readEntries(strings.NewReader(tt.input), tt.format, func(line int, raw string) bool {
+			got = append(got, raw)
+			lines = append(lines, line)
+			return true
+		})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) || !slices.Equal(lines, tt.lines) {
+			t.Errorf("%s: got %q at %v, want %q at %v", tt.name, got, lines, tt.want, tt.lines)
+		}
+	}
+}
+
+func uploadRequest(t *testing.T, filename string, content []byte, options string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if options != "" {
+		_ = form.WriteField("options", options)
+	}
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatalf("create part: %v", err)
+	}
+	_, _ = part.Write(content)
+	_ = form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/checks/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer test-key")
+	return req
+}
+
+func TestProxyListItem(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       string
+		res       checker.ProxyResult
+		host      string
+		port      int
+		protocols []string
+		socks4    int
+		socks5    int
+	}{
+		{
+			name: "checked address", raw: "192.0.2.1:1080",
+			res:  checker.ProxyResult{IP: "192.0.2.1", Port: "1080", Protocol: "socks5h"},
+			host: "192.0.2.1", port: 1080, protocols: []string{"SOCKS5"}, socks5: 1,
+		},
+		{
+			name: "hostname without a result address", raw: "socks4a://proxy.example:1080",
+			res:  checker.ProxyResult{Protocol: "socks4a"},
+			host: "proxy.example", port: 1080, protocols: []string{"SOCKS4"}, socks4: 1,
+		},
+		{
+			name: "detected variants", raw: "192.0.2.2:1080",
+			res:  checker.ProxyResult{IP: "192.0.2.2", Port: "1080", Protocols: []string{"socks5", "socks5h", "socks4"}},
+			host: "192.0.2.2", port: 1080, protocols: []string{"SOCKS5", "SOCKS4"}, socks4: 1, socks5: 1,
+		},
+	}
+	for _, tt := range tests {
+		item := proxyListItem(tt.raw, tt.res)
+		if item.ThroughputKBps != nil || item.ThroughputCompleted != nil {
+			t.Errorf("%s: expected no throughput without a throughput test", tt.name)
+		}
+		if item.Host != tt.host || item.IP != tt.host || item.Port != tt.port {
+			t.Errorf("%s: expected %s:%d, got host %q ip %q port %d", tt.name, tt.host, tt.port, item.Host, item.IP, item.Port)
+		}
+		if !slices.Equal(item.Protocols, tt.protocols) || item.Socks4 != tt.socks4 || item.Socks5 != tt.socks5 {
+			t.Errorf("%s: expected %v, got %v (socks4 %d, socks5 %d)", tt.name, tt.protocols, item.Protocols, item.Socks4, item.Socks5)
+		}
+	}
+
+	item := proxyListItem("192.0.2.3:1080", checker.ProxyResult{Protocol: "socks5", Throughput: &checker.ThroughputResult{KBps: 512.5, Completed: true}})
+	if item.ThroughputKBps == nil || *item.ThroughputKBps != 512.5 || item.ThroughputCompleted == nil || !*item.ThroughputCompleted {
+		t.Errorf("expected the throughput test in the item, got %v %v", item.ThroughputKBps, item.ThroughputCompleted)
+	}
+}
+
+func TestHandler_UploadCheckJob(t *testing.T) {
+	router := checkJobRouter(newV2Handler())
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte("proxy\n192.0.2.1:1080\n198.51.100.7:1\nnot a proxy\n203.0.113.9:1080\n"))
+	_ = zw.Close()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, uploadRequest(t, "list.csv.gz", gz.Bytes(), `{"protocol":"socks5","prober":"ws-test-slow"}`))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		Data   CheckJob     `json:"data"`
+		Upload uploadReport `json:"upload"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	report := created.Upload
+	if report.Format != uploadFormatCSV || report.Valid != 3 || report.Invalid != 1 || created.Data.Total != 3 {
+		t.Errorf("unexpected upload report %+v", report)
+	}
+	if len(report.Errors) != 1 || report.Errors[0].Line != 4 || report.Errors[0].Input != "not a proxy" {
+		t.Errorf("expected the bad line to be reported, got %+v", report.Errors)
+	}
+
+	path := "/api/v1/checks/" + created.Data.ID
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var status struct {
+			Data    CheckJob    `json:"data"`
+			Results []jobResult `json:"results"`
+		}
+		rec := serveCheckJob(router, http.MethodGet, path, "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if status.Data.Status != checkJobRunning {
+			if status.Data.Completed != 3 {
+				t.Errorf("expected 3 checked proxies, got %+v", status.Data)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job did not finish")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	rec = serveCheckJob(router, http.MethodGet, path+"/export/txt", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "192.0.2.1:1080\n203.0.113.9:1080\n" {
+		t.Errorf("expected the working proxies in line order, got %d %q", rec.Code, rec.Body.String())
+	}
+	rec = serveCheckJob(router, http.MethodGet, path+"/export/json?status=all", "")
+	var exported struct {
+		Data []struct {
+			IP        string   `json:"ip"`
+			Port      int      `json:"port"`
+			Protocols []string `json:"protocols"`
+			Uptime    int      `json:"uptime"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &exported); err != nil || len(exported.Data) != 3 {
+		t.Fatalf("expected every proxy in the JSON export, got %s (%v)", rec.Body.String(), err)
+	}
+	if d := exported.Data[1]; d.IP != "198.51.100.7" || d.Port != 1 || d.Uptime != 0 || !slices.Equal(d.Protocols, []string{"SOCKS5"}) {
+		t.Errorf("unexpected exported proxy %+v", d)
+	}
+	rec = serveCheckJob(router, http.MethodGet, path+"/export/csv", "")
+	if header, _, _ := strings.Cut(rec.Body.String(), "\n"); !strings.HasSuffix(header, ",throughput_kbps,throughput_completed") {
+		t.Errorf("expected the CSV export to carry the throughput columns, got %q", header)
+	}
+	if rec := serveCheckJob(router, http.MethodGet, path+"/export/xml", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %d", rec.Code)
+	}
+}
+
+func TestHandler_UploadCheckJob_Rejects(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := newV2Handler()
+	h.cfg.CheckUploadMax.Basic = 2
+	router := checkJobRouter(h)
+
+	tests := []struct {
+		name    string
+		content string
+		code    string
+	}{
+		{name: "too many proxies", content: "192.0.2.1:1080\n192.0.2.2:1080\n192.0.2.3:1080\n", code: codeLimitExceeded},
+		{name: "nothing valid", content: "bogus\n\n", code: codeEmptyProxyList},
+		{name: "bad json", content: `["192.0.2.1:1080"`, code: codeInvalidUpload},
+	}
+	for _, tt := range tests {
+		name := "list.txt"
+		if strings.HasPrefix(tt.content, "[") {
+			name = "list.json"
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, uploadRequest(t, name, []byte(tt.content), ""))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.code) {
+			t.Errorf("%s: expected 400 %s, got %d %s", tt.name, tt.code, rec.Code, rec.Body.String())
+		}
+	}
+}
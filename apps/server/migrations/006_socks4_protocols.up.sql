@@ -0,0 +1,7 @@
+-- Socks5Proxies SOCKS4a protocol support
+-- Version: 006
+
+ALTER TABLE socksproxies.proxies DROP CONSTRAINT IF EXISTS proxies_protocol_check;
+ALTER TABLE socksproxies.proxies
+    ADD CONSTRAINT proxies_protocol_check
+    CHECK (protocol IN ('socks5', 'socks4', 'socks4a', 'http', 'https'));
@@ -0,0 +1,10 @@
+-- Socks5Proxies per-phase check latency
+-- Version: 007
+
+ALTER TABLE socksproxies.checks ADD COLUMN IF NOT EXISTS connect_ms INTEGER DEFAULT 0;
+ALTER TABLE socksproxies.checks ADD COLUMN IF NOT EXISTS handshake_ms INTEGER DEFAULT 0;
+ALTER TABLE socksproxies.checks ADD COLUMN IF NOT EXISTS tunnel_ms INTEGER DEFAULT 0;
+ALTER TABLE socksproxies.checks ADD COLUMN IF NOT EXISTS tls_ms INTEGER DEFAULT 0;
+ALTER TABLE socksproxies.checks ADD COLUMN IF NOT EXISTS ttfb_ms INTEGER DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_checks_handshake_ms ON socksproxies.checks(handshake_ms);
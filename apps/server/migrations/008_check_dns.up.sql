@@ -0,0 +1,13 @@
+-- Socks5Proxies socks5h protocol and DNS leak results
+-- Version: 008
+
+ALTER TABLE socksproxies.proxies DROP CONSTRAINT IF EXISTS proxies_protocol_check;
+ALTER TABLE socksproxies.proxies
+    ADD CONSTRAINT proxies_protocol_check
+    CHECK (protocol IN ('socks5', 'socks5h', 'socks4', 'socks4a', 'http', 'https'));
+
+ALTER TABLE socksproxies.checks ADD COLUMN IF NOT EXISTS dns_mode VARCHAR(10) DEFAULT '';
+ALTER TABLE socksproxies.checks ADD COLUMN IF NOT EXISTS remote_dns BOOLEAN;
+ALTER TABLE socksproxies.checks ADD COLUMN IF NOT EXISTS dns_leak BOOLEAN;
+
+CREATE INDEX IF NOT EXISTS idx_checks_dns_leak ON socksproxies.checks(dns_leak) WHERE dns_leak = TRUE;
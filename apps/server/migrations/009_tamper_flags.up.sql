@@ -0,0 +1,14 @@
+-- Socks5Proxies content tampering and TLS interception flags
+-- Version: 009
+
+ALTER TABLE socksproxies.checks ADD COLUMN IF NOT EXISTS injects_content BOOLEAN;
+ALTER TABLE socksproxies.checks ADD COLUMN IF NOT EXISTS strips_headers BOOLEAN;
+ALTER TABLE socksproxies.checks ADD COLUMN IF NOT EXISTS mitm_tls BOOLEAN;
+
+-- Latest known flags per listed proxy, for filtering the public list.
+ALTER TABLE socksproxies.proxy_list ADD COLUMN IF NOT EXISTS injects_content BOOLEAN;
+ALTER TABLE socksproxies.proxy_list ADD COLUMN IF NOT EXISTS strips_headers BOOLEAN;
+ALTER TABLE socksproxies.proxy_list ADD COLUMN IF NOT EXISTS mitm_tls BOOLEAN;
+
+CREATE INDEX IF NOT EXISTS idx_checks_tampered ON socksproxies.checks(checked_at DESC)
+    WHERE injects_content = TRUE OR strips_headers = TRUE OR mitm_tls = TRUE;
@@ -2,6 +2,7 @@
 
 import { useState, useMemo, useCallback, memo } from "react";
 import clsx from "clsx";
+import { formatHostPort } from "../../../lib/format";
 
 interface ResultRow {
   ip: string;
@@ -12,6 +13,17 @@ interface ResultRow {
   country?: string;
   anonymity?: string;
   error?: string;
+  egress?: "ipv4" | "ipv6" | "dual";
+  dns?: {
+    mode: "remote" | "local";
+    leak: boolean;
+  };
+  throughput?: {
+    bytes: number;
+    kbps: number;
+    duration_ms: number;
+    completed: boolean;
+  };
 }
 
 interface ResultTableProps {
@@ -39,6 +51,10 @@ function exportToCSV(data: ResultRow[]): string {
     "Latency",
     "Country",
     "Anonymity",
+    "Throughput KB/s",
+    "Transfer Complete",
+    "Egress",
+    "DNS Leak",
     "Error",
   ];
   const rows = data.map((row) => [
@@ -49,6 +65,10 @@ function exportToCSV(data: ResultRow[]): string {
     row.status ? row.latency.toString() : "",
     row.country || "",
     row.anonymity || "",
+    row.throughput ? row.throughput.kbps.toString() : "",
+    row.throughput ? (row.throughput.completed ? "Yes" : "No") : "",
+    row.egress || "",
+    row.dns ? (row.dns.leak ? "Yes" : "No") : "",
     row.error || "",
   ]);
   return [headers, ...rows].map((row) => row.join(",")).join("\n");
@@ -142,7 +162,7 @@ const ResultRow = memo(function ResultRow({
       )}
     >
       <td className="px-4 py-3 font-mono text-xs">
-        {row.ip}:{row.port}
+        {formatHostPort(row.ip, row.port)}
         {row.error && (
           <div className="text-[10px] text-red-500">{row.error}</div>
         )}
@@ -190,7 +210,7 @@ export function ResultTable({ data }: ResultTableProps) {
 
   // Performance: Memoize copy handler
   const handleCopy = useCallback((row: ResultRow, idx: number) => {
-    const proxyString = `${row.protocol}://${row.ip}:${row.port}`;
+    const proxyString = `${row.protocol}://${formatHostPort(row.ip, row.port)}`;
     navigator.clipboard.writeText(proxyString);
     const id = `${row.ip}-${row.port}-${idx}`;
     setCopiedId(id);
@@ -3,6 +3,7 @@
 import Link from "next/link";
 import { memo, useMemo, useState, useCallback } from "react";
 import type { ProxyData } from "../../types/proxy";
+import { formatHostPort } from "../../lib/format";
 
 function escapeCsv(value: string | number | undefined | null) {
   if (value === undefined || value === null) return "";
@@ -51,7 +52,7 @@ function buildCsv(data: ProxyData[]) {
 }
 
 function buildPlainList(data: ProxyData[]) {
-  return data.map((proxy) => `${proxy.ip}:${proxy.port}`).join("\n");
+  return data.map((proxy) => formatHostPort(proxy.ip, proxy.port)).join("\n");
 }
 
 function buildClashConfig(data: ProxyData[]) {
@@ -73,10 +74,11 @@ function buildClashConfig(data: ProxyData[]) {
 function buildSurfsharkList(data: ProxyData[]) {
   return data
     .map((proxy) => {
-      if (proxy.socks5) return `socks5://${proxy.ip}:${proxy.port}`;
-      if (proxy.socks4) return `socks4://${proxy.ip}:${proxy.port}`;
-      if (proxy.ssl) return `https://${proxy.ip}:${proxy.port}`;
-      return `http://${proxy.ip}:${proxy.port}`;
+      const address = formatHostPort(proxy.ip, proxy.port);
+      if (proxy.socks5) return `socks5://${address}`;
+      if (proxy.socks4) return `socks4://${address}`;
+      if (proxy.ssl) return `https://${address}`;
+      return `http://${address}`;
     })
     .join("\n");
 }
@@ -2,7 +2,7 @@ import Link from "next/link";
 import { ArrowRight } from "lucide-react";
 import type { ProxyData } from "../../types/proxy";
 import { countryCodeToFlag } from "../../lib/flags";
-import { formatRelativeTime } from "../../lib/format";
+import { formatHostPort, formatRelativeTime } from "../../lib/format";
 import { LiveUpdateBadge } from "../shared/LiveUpdateBadge";
 
 interface ProxyListHeroProps {
@@ -45,7 +45,7 @@ export function ProxyListHero({ proxies, cacheAge = 0 }: ProxyListHeroProps) {
                   </span>
                   <div>
                     <p className="font-mono text-xs">
-                      {proxy.ip}:{proxy.port}
+                      {formatHostPort(proxy.ip, proxy.port)}
                     </p>
                     <p className="text-xs text-ink-muted dark:text-sand-400">
                       {proxy.country_name || proxy.country_code || "Unknown"} •
@@ -3,6 +3,15 @@
 import { useCallback, useEffect, useRef, useState } from "react";
 import { env } from "../lib/env";
 
+export interface ProxyGeo {
+  ip: string;
+  country?: string;
+  city?: string;
+  asn?: number;
+  org?: string;
+  asn_class?: "hosting" | "isp" | "mobile";
+}
+
 export interface ProxyResult {
   ip: string;
   port: string;
@@ -13,6 +22,58 @@ export interface ProxyResult {
   anonymity?: string;
   error?: string;
   checkedAt?: string;
+  ip_version?: number;
+  exit_ip?: string;
+  exit_ipv4?: string;
+  exit_ipv6?: string;
+  egress?: "ipv4" | "ipv6" | "dual";
+  dns?: {
+    mode: "remote" | "local";
+    remote_resolved: boolean;
+    leak: boolean;
+    resolvers?: string[];
+    error?: string;
+  };
+  entry_geo?: ProxyGeo;
+  exit_geo?: ProxyGeo;
+  exit_differs?: boolean;
+  sampling?: {
+    attempts: number;
+    successes: number;
+    success_ratio: number;
+    min_ms?: number;
+    median_ms?: number;
+    p95_ms?: number;
+    verdict: "ok" | "flaky" | "dead";
+  };
+  hops?: {
+    address: string;
+    protocol: string;
+    latency_ms: number;
+  }[];
+  tamper?: {
+    injects_content?: boolean;
+    strips_headers?: boolean;
+    mitm_tls?: boolean;
+    length_delta?: number;
+    missing_headers?: string[];
+    error?: string;
+  };
+  throughput?: {
+    bytes: number;
+    kbps: number;
+    duration_ms: number;
+    completed: boolean;
+    error?: string;
+  };
+  targets?: {
+    url: string;
+    pass: boolean;
+    status?: number;
+    latency_ms: number;
+    failures?: string[];
+    error?: string;
+  }[];
 }
 
 // Performance: Batch state updates to reduce re-renders
@@ -104,6 +165,10 @@ export function useProxyChecker() {
           ws.current?.close();
           return;
         }
+        // Progress events for proxies held back by subnet/ASN caps.
+        if (payload && "status" in payload && payload.status === "queued") {
+          return;
+        }
         if (payload && "error" in payload) {
           setError(payload.error || "Scan failed.");
           setIsScanning(false);
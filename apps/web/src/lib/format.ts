@@ -16,3 +16,8 @@ export function formatRelativeTime(
   const diffSeconds = Math.max(0, (now.getTime() - parsed.getTime()) / 1000);
   return formatRelativeSeconds(diffSeconds);
 }
+
+// formatHostPort brackets IPv6 addresses so the port stays unambiguous.
+export function formatHostPort(ip: string, port: string | number): string {
+  return ip.includes(":") ? `[${ip}]:${port}` : `${ip}:${port}`;
+}
@@ -2,10 +2,13 @@ import { z } from "zod";
 
 export const ProxyProtocolSchema = z.enum([
   "socks5",
+  "socks5h",
   "socks4",
+  "socks4a",
   "socks",
   "http",
   "https",
+  "auto",
 ]);
 
 export const ProxyResultSchema = z.object({
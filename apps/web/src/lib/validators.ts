@@ -4,20 +4,28 @@ export interface ParsedProxyInput {
   ignored: string[];
 }
 
-const urlPattern = /^(socks5|socks4|socks|http|https):\/\/[^\s]+$/i;
-const basicPattern = /^([\w.-]+):(\d+)(?::([^:]+):([^:]+))?$/;
+const urlPattern = /^(socks5h?|socks4a?|socks|http|https):\/\/[^\s]+$/i;
+const basicPattern = /^([\w.-]+|\[[0-9a-f:.]+\]):(\d+)(?::([^:]+):([^:]+))?$/i;
 
 // SECURITY: Patterns to detect potential injection attempts
 const sqlInjectionPattern =
   /(\b(SELECT|INSERT|UPDATE|DELETE|DROP|CREATE|ALTER|EXEC|UNION)\b|--|;)/i;
 const xssPattern = /<script[^>]*>|javascript:|on\w+\s*=/i;
 
+// Chains such as "socks5://a:1080 -> http://b:3128" are checked hop by hop.
+const chainSeparator = "->";
+const maxChainHops = 5;
+
 export function isValidProxyLine(line: string): boolean {
   // SECURITY: Reject lines with potential injection patterns
   if (sqlInjectionPattern.test(line) || xssPattern.test(line)) {
     return false;
   }
-  return urlPattern.test(line) || basicPattern.test(line);
+  const hops = line.split(chainSeparator).map((hop) => hop.trim());
+  if (hops.length > maxChainHops) {
+    return false;
+  }
+  return hops.every((hop) => urlPattern.test(hop) || basicPattern.test(hop));
 }
 
 export function sanitizeProxyLine(line: string): string {
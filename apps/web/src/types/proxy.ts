@@ -2,6 +2,7 @@ export interface ProxyData {
   host: string;
   ip: string;
   port: number;
+  ip_version?: number;
   delay: number;
   country_code: string;
   country_name: string;
@@ -22,6 +23,9 @@ export interface ProxyData {
   checks_up: number;
   checks_down: number;
   last_seen?: string;
+  injects_content?: boolean;
+  strips_headers?: boolean;
+  mitm_tls?: boolean;
 }
 
 export interface ProxyListResponse {